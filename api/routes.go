@@ -17,37 +17,92 @@ func SetupRoutes(router *gin.Engine) {
 	//180 calls per minute
 	router.Use(middleware.RateLimit(180, time.Minute))
 
+	setupWellKnownRoutes(router)
+
 	apiGroup := router.Group("/api/v1")
 	{
 		setupAuthRoutes(apiGroup)
 		setupUserRoutes(apiGroup)
+		setupOAuthRoutes(apiGroup)
+		setupRoleRoutes(apiGroup)
+		setupPermissionRoutes(apiGroup)
+		setupCasbinRoutes(apiGroup)
+		setupOrganizationRoutes(apiGroup)
+		setupDepartmentRoutes(apiGroup)
 	}
 
 }
 
+// Well-known routes
+func setupWellKnownRoutes(router *gin.Engine) {
+	jwksController := controller.NewJwksController()
+	wellKnownGroup := router.Group("/.well-known")
+	{
+		wellKnownGroup.GET("/jwks.json", jwksController.GetJwks)
+	}
+}
+
 // Auth routes
 func setupAuthRoutes(apiGroup *gin.RouterGroup) {
 	authController := controller.NewAuthController()
+	mfaController := controller.NewMfaController()
+	accessTokenController := controller.NewAccessTokenController()
+	sessionController := controller.NewSessionController()
+	oidcController := controller.NewOidcController()
 	//public route
 	publicGroup := apiGroup.Group("/auth")
 	{
 		publicGroup.POST("/register", authController.Register)
 		publicGroup.POST("/login", authController.Login)
 		publicGroup.POST("/refresh", authController.RefreshToken)
+		publicGroup.POST("/mfa/verify", mfaController.Verify)
+		publicGroup.POST("/mfa/enroll", mfaController.Enroll)
+		publicGroup.POST("/forgot-password", authController.ForgotPassword)
+		publicGroup.POST("/reset-password", authController.ResetPassword)
+		publicGroup.POST("/password-expired", authController.ChangeExpiredPassword)
+		publicGroup.POST("/magic-link", authController.SendMagicLink)
+		publicGroup.POST("/magic-link/login", authController.MagicLinkLogin)
+		publicGroup.GET("/verify-email", authController.VerifyEmail)
+		publicGroup.POST("/resend-verification", authController.ResendVerification)
+		publicGroup.GET("/oidc/providers", oidcController.GetProviders)
+		publicGroup.GET("/oidc/:provider/login", oidcController.Login)
+		publicGroup.GET("/oidc/:provider/callback", oidcController.Callback)
 	}
 
-	//auth route
+	//auth route, account management needs an interactive login
 	authGroup := apiGroup.Group("/auth")
-	authGroup.Use(middleware.JwtAuth())
+	authGroup.Use(middleware.JwtAuth(), middleware.DenyAccessToken())
 	{
 		authGroup.GET("/user", authController.GetUserInfo)
-		authGroup.POST("/change-password", authController.ChangePassword)
+		authGroup.POST("/logout", authController.Logout)
+		authGroup.GET("/tokens", accessTokenController.GetTokens)
+		authGroup.GET("/sessions", sessionController.GetSessions)
+		authGroup.GET("/identities", oidcController.GetIdentities)
+	}
+
+	//credentials and grants, never changed by an admin acting as the user
+	credentialGroup := apiGroup.Group("/auth")
+	credentialGroup.Use(middleware.JwtAuth(), middleware.DenyAccessToken(), middleware.DenyImpersonation())
+	{
+		credentialGroup.POST("/change-password", authController.ChangePassword)
+		credentialGroup.POST("/change-email", authController.ChangeEmail)
+		credentialGroup.POST("/logout-all", authController.LogoutAll)
+		credentialGroup.POST("/mfa/setup", mfaController.Setup)
+		credentialGroup.POST("/mfa/enable", mfaController.Enable)
+		credentialGroup.POST("/mfa/disable", mfaController.Disable)
+		credentialGroup.POST("/mfa/recovery-codes", mfaController.RegenerateRecoveryCodes)
+		credentialGroup.POST("/tokens", accessTokenController.CreateToken)
+		credentialGroup.DELETE("/tokens/:id", accessTokenController.RevokeToken)
+		credentialGroup.DELETE("/sessions/:id", sessionController.RevokeSession)
 	}
 }
 
 // User routes
 func setupUserRoutes(apiGroup *gin.RouterGroup) {
 	userController := controller.NewUserController()
+	mfaController := controller.NewMfaController()
+	sessionController := controller.NewSessionController()
+	impersonationController := controller.NewImpersonationController()
 
 	//base routeGroup
 	baseUserGroup := apiGroup.Group("/users")
@@ -56,14 +111,143 @@ func setupUserRoutes(apiGroup *gin.RouterGroup) {
 	baseUserGroup.GET("", middleware.PermissionAuth("user:list"), userController.GetUsers)
 	baseUserGroup.GET("/:id", middleware.AnyPermissionAuth("user:list", "user:read"), userController.GetUser)
 	baseUserGroup.POST("", middleware.RoleOrPermissionAuth("admin", "user:create"), userController.CreateUser)
-	baseUserGroup.PUT("/:id", middleware.RoleAndPermissionAuth("admin", "user:update"), userController.UpdateUser)
+	//users holding user:update:own, implied by user:edit, may update themselves
+	baseUserGroup.PUT("/:id", middleware.ResourceAuth("user:update", middleware.UserResource), userController.UpdateUser)
 	baseUserGroup.DELETE("/:id", middleware.AllPermissionsAuth("user:delete", "user:manage"), userController.DeleteUser)
 
 	//admin group
 	adminGroup := apiGroup.Group("/admin/users")
 	adminGroup.Use(middleware.JwtAuth())
 	adminGroup.Use(middleware.RoleAuth("admin"))
+	//admins of an organization only reach its users
+	adminGroup.Use(middleware.TenantUser())
 	{ //delete user
 		adminGroup.DELETE("/:id", userController.DeleteUser)
+		//ban or enable user
+		adminGroup.PUT("/:id/status", userController.UpdateUserStatus)
+		//reset 2fa of a user who lost the device
+		adminGroup.DELETE("/:id/mfa", mfaController.ResetUser)
+		//unlock a user locked out by failed logins
+		adminGroup.POST("/:id/unlock", userController.UnlockUser)
+		//sessions of a user
+		adminGroup.GET("/:id/sessions", sessionController.GetUserSessions)
+		adminGroup.DELETE("/:id/sessions/:sid", sessionController.RevokeUserSession)
+		//act as a user, only from an interactive admin login
+		adminGroup.POST("/:id/impersonate", middleware.DenyAccessToken(), middleware.DenyImpersonation(), impersonationController.Impersonate)
+		adminGroup.GET("/:id/impersonations", impersonationController.GetLogs)
+	}
+}
+
+// OAuth2 authorization server routes
+func setupOAuthRoutes(apiGroup *gin.RouterGroup) {
+	oauthController := controller.NewOAuthController()
+	oauthClientController := controller.NewOAuthClientController()
+
+	//client authenticated endpoints
+	oauthGroup := apiGroup.Group("/oauth")
+	{
+		oauthGroup.POST("/token", oauthController.Token)
+		oauthGroup.POST("/introspect", oauthController.Introspect)
+		oauthGroup.POST("/revoke", oauthController.Revoke)
+	}
+
+	//consent needs an interactive login
+	authorizeGroup := apiGroup.Group("/oauth")
+	authorizeGroup.Use(middleware.JwtAuth(), middleware.DenyAccessToken())
+	{
+		authorizeGroup.GET("/authorize", oauthController.Authorize)
+		authorizeGroup.POST("/authorize", middleware.DenyImpersonation(), oauthController.Approve)
+	}
+
+	//client registration, clients are shared by every organization
+	adminGroup := apiGroup.Group("/admin/oauth/clients")
+	adminGroup.Use(middleware.JwtAuth())
+	adminGroup.Use(middleware.PlatformAdmin())
+	{
+		adminGroup.GET("", oauthClientController.GetClients)
+		adminGroup.POST("", oauthClientController.CreateClient)
+		adminGroup.DELETE("/:id", oauthClientController.DeleteClient)
+		adminGroup.POST("/:id/secret", oauthClientController.RotateSecret)
+	}
+}
+
+// Role routes
+func setupRoleRoutes(apiGroup *gin.RouterGroup) {
+	roleController := controller.NewRoleController()
+
+	roleGroup := apiGroup.Group("/roles")
+	roleGroup.Use(middleware.JwtAuth())
+	roleGroup.Use(middleware.PermissionAuth("system:config"))
+	{
+		roleGroup.GET("", roleController.GetRoles)
+		roleGroup.GET("/:id", roleController.GetRole)
+		roleGroup.POST("", roleController.CreateRole)
+		roleGroup.PUT("/:id", roleController.UpdateRole)
+		roleGroup.DELETE("/:id", roleController.DeleteRole)
+		roleGroup.POST("/:id/permissions", roleController.AddPermission)
+		roleGroup.DELETE("/:id/permissions/:permission", roleController.RemovePermission)
+		//allow or forbid passwordless login for the members
+		roleGroup.PUT("/:id/magic-link", roleController.SetMagicLink)
+	}
+}
+
+// Permission catalog routes
+func setupPermissionRoutes(apiGroup *gin.RouterGroup) {
+	permissionController := controller.NewPermissionController()
+
+	permissionGroup := apiGroup.Group("/permissions")
+	permissionGroup.Use(middleware.JwtAuth())
+	permissionGroup.Use(middleware.PermissionAuth("system:config"))
+	{
+		permissionGroup.GET("", permissionController.GetPermissions)
+	}
+}
+
+// Casbin policy routes, changes reach the other instances over redis
+func setupCasbinRoutes(apiGroup *gin.RouterGroup) {
+	casbinController := controller.NewCasbinController()
+
+	casbinGroup := apiGroup.Group("/casbin")
+	casbinGroup.Use(middleware.JwtAuth())
+	casbinGroup.Use(middleware.PermissionAuth("system:config"))
+	casbinGroup.Use(middleware.PlatformAdmin())
+	casbinGroup.Use(middleware.DenyImpersonation())
+	{
+		casbinGroup.GET("/policies", casbinController.GetPolicies)
+		casbinGroup.POST("/policies", casbinController.AddPolicy)
+		casbinGroup.DELETE("/policies", casbinController.RemovePolicy)
+		casbinGroup.POST("/groupings", casbinController.AddGrouping)
+		casbinGroup.DELETE("/groupings", casbinController.RemoveGrouping)
+	}
+}
+
+// Organization routes, tenants are managed by the platform admins
+func setupOrganizationRoutes(apiGroup *gin.RouterGroup) {
+	organizationController := controller.NewOrganizationController()
+
+	organizationGroup := apiGroup.Group("/organizations")
+	organizationGroup.Use(middleware.JwtAuth())
+	organizationGroup.Use(middleware.PlatformAdmin())
+	{
+		organizationGroup.GET("", organizationController.GetOrganizations)
+		organizationGroup.GET("/:id", organizationController.GetOrganization)
+		organizationGroup.POST("", organizationController.CreateOrganization)
+		organizationGroup.PUT("/:id", organizationController.UpdateOrganization)
+	}
+}
+
+// Department routes, the tree of the organization of the request
+func setupDepartmentRoutes(apiGroup *gin.RouterGroup) {
+	departmentController := controller.NewDepartmentController()
+
+	departmentGroup := apiGroup.Group("/departments")
+	departmentGroup.Use(middleware.JwtAuth())
+	departmentGroup.Use(middleware.PermissionAuth("system:config"))
+	{
+		departmentGroup.GET("", departmentController.GetDepartments)
+		departmentGroup.GET("/:id", departmentController.GetDepartment)
+		departmentGroup.POST("", departmentController.CreateDepartment)
+		departmentGroup.PUT("/:id", departmentController.UpdateDepartment)
+		departmentGroup.DELETE("/:id", departmentController.DeleteDepartment)
 	}
 }
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"strconv"
+
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Personal access token Controller
+type AccessTokenController struct {
+	tokenService services.IPersonalAccessTokenService
+}
+
+// Create AccessTokenController
+func NewAccessTokenController() *AccessTokenController {
+	return &AccessTokenController{
+		tokenService: services.NewPersonalAccessTokenService(),
+	}
+}
+
+// Create token request params
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0"`
+}
+
+// List tokens of the current user
+func (c *AccessTokenController) GetTokens(ctx *gin.Context) {
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	tokens, err := c.tokenService.List(userId.(uint64))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	var tokenList []gin.H
+	for _, token := range tokens {
+		tokenList = append(tokenList, gin.H{
+			"id":           token.Id,
+			"name":         token.Name,
+			"prefix":       token.Prefix,
+			"scopes":       token.Scopes,
+			"expires_at":   token.ExpiresAt,
+			"last_used_at": token.LastUsedAt,
+			"revoked_at":   token.RevokedAt,
+			"created_at":   token.CreatedAt,
+		})
+	}
+	utils.Success(ctx, gin.H{
+		"list": tokenList,
+	})
+}
+
+// Create a token, the plain token is only returned once
+func (c *AccessTokenController) CreateToken(ctx *gin.Context) {
+	var req CreateAccessTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	token, record, err := c.tokenService.Create(userId.(uint64), req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"id":         record.Id,
+		"name":       record.Name,
+		"token":      token,
+		"prefix":     record.Prefix,
+		"scopes":     record.Scopes,
+		"expires_at": record.ExpiresAt,
+	})
+}
+
+// Revoke a token
+func (c *AccessTokenController) RevokeToken(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	tokenId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid tokenId", nil)
+		return
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	if err := c.tokenService.Revoke(userId.(uint64), tokenId); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "revoke token successfully", nil)
+}
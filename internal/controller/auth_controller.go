@@ -1,11 +1,24 @@
 package controller
 
 import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
 	"bpf.com/internal/services"
+	"bpf.com/pkg/config"
 	"bpf.com/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
 
+// cookie binding a magic link to the browser that requested it
+const (
+	magicLinkCookie     = "magic_link_nonce"
+	magicLinkCookiePath = "/api/v1/auth/magic-link"
+)
+
 // auth Controller
 type AuthController struct {
 	authService services.IAuthService
@@ -21,7 +34,7 @@ func NewAuthController() *AuthController {
 // Register quest params
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
-	Password string `json:"password" binding:"required,min=6,max=20"`
+	Password string `json:"password" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Nickname string `json:"nickname" binding:"required,min=2,max=50"`
 }
@@ -37,10 +50,53 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+// Logout request params
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Forgot password request params
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Reset password request params
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// Magic link request params
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Magic link login request params
+type MagicLinkLoginRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// Resend verification request params
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Change email request params
+type ChangeEmailRequest struct {
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+}
+
+// Expired password change request params
+type ChangeExpiredPasswordRequest struct {
+	PasswordToken string `json:"password_token" binding:"required"`
+	NewPassword   string `json:"new_password" binding:"required"`
+}
+
 // Change password request params
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6,max=20"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 // User Register
@@ -68,26 +124,61 @@ func (c *AuthController) Login(ctx *gin.Context) {
 		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
 		return
 	}
-	accessToken, refreshToken, user, err := c.authService.Login(req.Username, req.Password)
+	result, err := c.authService.Login(req.Username, req.Password, clientInfo(ctx))
 	if err != nil {
+		var lockedErr *services.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+			utils.FailWithMessage(ctx, utils.TOO_MANY_REQUESTS, err.Error(), nil)
+			return
+		}
 		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
 		return
 	}
-	utils.Success(ctx, gin.H{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
+	utils.Success(ctx, loginResponse(result))
+}
+
+// device info of the request
+func clientInfo(ctx *gin.Context) services.ClientInfo {
+	return services.ClientInfo{
+		Ip:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+}
+
+// build the login response, only the pending token is returned while
+// a password change or 2fa is pending
+func loginResponse(result *services.LoginResult) gin.H {
+	if result.PasswordExpired {
+		return gin.H{
+			"password_expired": true,
+			"password_token":   result.PasswordToken,
+		}
+	}
+	if result.MfaRequired {
+		return gin.H{
+			"mfa_required": true,
+			"mfa_enroll":   result.MfaEnroll,
+			"mfa_token":    result.MfaToken,
+		}
+	}
+	user := result.User
+	data := gin.H{
+		"access_token":  result.AccessToken,
+		"refresh_token": result.RefreshToken,
 		"user": gin.H{
-			"id":       user.Id,
-			"username": user.Username,
-			"nickname": user.Nickname,
-			"email":    user.Email,
-			"role": gin.H{
-				"id":   user.Role.Id,
-				"name": user.Role.Name,
-				"code": user.Role.Code,
-			},
+			"id":             user.Id,
+			"username":       user.Username,
+			"nickname":       user.Nickname,
+			"email":          user.Email,
+			"roles":          userRoles(user),
+			"email_verified": user.IsEmailVerified(),
 		},
-	})
+	}
+	if len(result.RecoveryCodes) > 0 {
+		data["recovery_codes"] = result.RecoveryCodes
+	}
+	return data
 }
 
 // Refresh Token
@@ -97,13 +188,14 @@ func (c *AuthController) RefreshToken(ctx *gin.Context) {
 		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
 		return
 	}
-	accessToken, err := c.authService.RefreshToken(req.RefreshToken)
+	accessToken, refreshToken, err := c.authService.RefreshToken(req.RefreshToken, clientInfo(ctx))
 	if err != nil {
-		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, err.Error(), nil)
 		return
 	}
 	utils.Success(ctx, gin.H{
-		"access_token": accessToken,
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
 	})
 }
 
@@ -134,15 +226,13 @@ func (c *AuthController) GetUserInfo(ctx *gin.Context) {
 	}
 	utils.Success(ctx, gin.H{
 		"user": gin.H{
-			"id":       user.Id,
-			"username": user.Username,
-			"nickname": user.Nickname,
-			"email":    user.Email,
-			"role": gin.H{
-				"id":   user.Role.Id,
-				"name": user.Role.Name,
-				"code": user.Role.Code,
-			},
+			"id":             user.Id,
+			"username":       user.Username,
+			"nickname":       user.Nickname,
+			"email":          user.Email,
+			"roles":          userRoles(user),
+			"email_verified": user.IsEmailVerified(),
+			"pending_email":  user.PendingEmail,
 		},
 	})
 }
@@ -166,3 +256,164 @@ func (c *AuthController) ChangePassword(ctx *gin.Context) {
 	}
 	utils.SuccessWithMessage(ctx, "change password successfully", nil)
 }
+
+// Replace an expired password and finish the login
+func (c *AuthController) ChangeExpiredPassword(ctx *gin.Context) {
+	var req ChangeExpiredPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	result, err := c.authService.ChangeExpiredPassword(req.PasswordToken, req.NewPassword, clientInfo(ctx))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, loginResponse(result))
+}
+
+// Email a passwordless login link, the nonce cookie binds it to this browser
+func (c *AuthController) SendMagicLink(ctx *gin.Context) {
+	var req MagicLinkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	nonce, err := c.authService.SendMagicLink(req.Email, ctx.ClientIP())
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	setMagicLinkCookie(ctx, nonce, int(services.MagicLinkExp().Seconds()))
+	utils.SuccessWithMessage(ctx, "if the email allows passwordless login, a login link has been sent", nil)
+}
+
+// Exchange a magic link for the token pair
+func (c *AuthController) MagicLinkLogin(ctx *gin.Context) {
+	var req MagicLinkLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	nonce, _ := ctx.Cookie(magicLinkCookie)
+	result, err := c.authService.MagicLinkLogin(req.Token, nonce, clientInfo(ctx))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, err.Error(), nil)
+		return
+	}
+	setMagicLinkCookie(ctx, "", -1)
+	utils.Success(ctx, loginResponse(result))
+}
+
+// set or clear the magic link nonce cookie, maxAge -1 clears it
+func setMagicLinkCookie(ctx *gin.Context, nonce string, maxAge int) {
+	secure := ctx.Request.TLS != nil || strings.HasPrefix(config.GetAppConfig().Server.PublicUrl, "https://")
+	ctx.SetSameSite(http.SameSiteStrictMode)
+	ctx.SetCookie(magicLinkCookie, nonce, maxAge, magicLinkCookiePath, "", secure, true)
+}
+
+// Logout this device
+func (c *AuthController) Logout(ctx *gin.Context) {
+	var req LogoutRequest
+	//refresh token is optional
+	_ = ctx.ShouldBindJSON(&req)
+	claims, exists := ctx.Get("claims")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	if err := c.authService.Logout(claims.(*utils.JWTClaims), req.RefreshToken); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "logout successfully", nil)
+}
+
+// Logout all devices
+func (c *AuthController) LogoutAll(ctx *gin.Context) {
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	if err := c.authService.LogoutAll(userId.(uint64)); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "logout all devices successfully", nil)
+}
+
+// Forgot password, always answers the same so emails are not revealed
+func (c *AuthController) ForgotPassword(ctx *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	if err := c.authService.ForgotPassword(req.Email, ctx.ClientIP()); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "if the email is registered, a reset link has been sent", nil)
+}
+
+// Reset password
+func (c *AuthController) ResetPassword(ctx *gin.Context) {
+	var req ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	if err := c.authService.ResetPassword(req.Token, req.NewPassword); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "reset password successfully", nil)
+}
+
+// Verify email by the link sent by mail
+func (c *AuthController) VerifyEmail(ctx *gin.Context) {
+	token := ctx.Query("token")
+	if token == "" {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "token not found", nil)
+		return
+	}
+	if err := c.authService.VerifyEmail(token); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "verify email successfully", nil)
+}
+
+// Resend the verification link
+func (c *AuthController) ResendVerification(ctx *gin.Context) {
+	var req ResendVerificationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	if err := c.authService.ResendVerification(req.Email); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "if the email needs verification, a link has been sent", nil)
+}
+
+// Change email, the new address takes effect once verified
+func (c *AuthController) ChangeEmail(ctx *gin.Context) {
+	var req ChangeEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	if err := c.authService.ChangeEmail(userId.(uint64), req.Password, req.Email); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "a verification link has been sent to the new email", nil)
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Casbin policy Controller
+type CasbinController struct {
+	casbinService services.ICasbinService
+}
+
+// Create CasbinController
+func NewCasbinController() *CasbinController {
+	return &CasbinController{
+		casbinService: services.NewCasbinService(),
+	}
+}
+
+// p line request params, the subject is user:<id> or role:<code>, the domain defaults to casbin.domain
+type CasbinPolicyRequest struct {
+	Subject string `json:"subject" binding:"required,max=100"`
+	Domain  string `json:"domain" binding:"max=100"`
+	Object  string `json:"object" binding:"required,max=100"`
+	Action  string `json:"action" binding:"required,max=100"`
+}
+
+// g line request params, the subject is user:<id> or role:<code>, the role a role code
+type CasbinGroupingRequest struct {
+	Subject string `json:"subject" binding:"required,max=100"`
+	Role    string `json:"role" binding:"required,max=100"`
+	Domain  string `json:"domain" binding:"max=100"`
+}
+
+// List policies and groupings
+func (c *CasbinController) GetPolicies(ctx *gin.Context) {
+	policies, err := c.casbinService.ListPolicies()
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	groupings, err := c.casbinService.ListGroupings()
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"policies":  policies,
+		"groupings": groupings,
+	})
+}
+
+// Add a policy
+func (c *CasbinController) AddPolicy(ctx *gin.Context) {
+	var req CasbinPolicyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	if err := c.casbinService.AddPolicy(req.Subject, req.Domain, req.Object, req.Action); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "add policy successfully", nil)
+}
+
+// Remove a policy
+func (c *CasbinController) RemovePolicy(ctx *gin.Context) {
+	var req CasbinPolicyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	if err := c.casbinService.RemovePolicy(req.Subject, req.Domain, req.Object, req.Action); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "remove policy successfully", nil)
+}
+
+// Give a subject a role
+func (c *CasbinController) AddGrouping(ctx *gin.Context) {
+	var req CasbinGroupingRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	if err := c.casbinService.AddGrouping(req.Subject, req.Role, req.Domain); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "add grouping successfully", nil)
+}
+
+// Take a role from a subject
+func (c *CasbinController) RemoveGrouping(ctx *gin.Context) {
+	var req CasbinGroupingRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	if err := c.casbinService.RemoveGrouping(req.Subject, req.Role, req.Domain); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "remove grouping successfully", nil)
+}
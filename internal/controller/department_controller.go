@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"strconv"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Department Controller
+type DepartmentController struct {
+	deptService services.IDepartmentService
+}
+
+// Create DepartmentController
+func NewDepartmentController() *DepartmentController {
+	return &DepartmentController{
+		deptService: services.NewDepartmentService(),
+	}
+}
+
+// Create and update department request params
+type DepartmentRequest struct {
+	Name     string  `json:"name" binding:"required,max=50"`
+	ParentId *uint64 `json:"parent_id"`
+	Sort     int     `json:"sort"`
+}
+
+func departmentResponse(dept *models.Department) gin.H {
+	return gin.H{
+		"id":         dept.Id,
+		"tenant_id":  dept.TenantId,
+		"parent_id":  dept.ParentId,
+		"name":       dept.Name,
+		"path":       dept.Path,
+		"sort":       dept.Sort,
+		"created_at": dept.CreatedAt,
+		"updated_at": dept.UpdatedAt,
+	}
+}
+
+// nest the departments under their parents, the list has parents before children
+func departmentTree(depts []*models.Department) []gin.H {
+	nodes := make(map[uint64]gin.H, len(depts))
+	tree := []gin.H{}
+	for _, dept := range depts {
+		node := departmentResponse(dept)
+		node["children"] = []gin.H{}
+		nodes[dept.Id] = node
+		if dept.ParentId != nil {
+			if parent, ok := nodes[*dept.ParentId]; ok {
+				parent["children"] = append(parent["children"].([]gin.H), node)
+				continue
+			}
+		}
+		tree = append(tree, node)
+	}
+	return tree
+}
+
+// department id from the path, fails the request when invalid
+func departmentIdParam(ctx *gin.Context) (uint64, bool) {
+	deptId, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid departmentId", nil)
+		return 0, false
+	}
+	return deptId, true
+}
+
+// Get department tree
+func (c *DepartmentController) GetDepartments(ctx *gin.Context) {
+	depts, err := c.deptService.WithContext(ctx.Request.Context()).ListDepartments()
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"list": departmentTree(depts),
+	})
+}
+
+// Get department
+func (c *DepartmentController) GetDepartment(ctx *gin.Context) {
+	deptId, ok := departmentIdParam(ctx)
+	if !ok {
+		return
+	}
+	dept, err := c.deptService.WithContext(ctx.Request.Context()).GetDepartmentById(deptId)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.NOT_FOUND, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, departmentResponse(dept))
+}
+
+// Create department
+func (c *DepartmentController) CreateDepartment(ctx *gin.Context) {
+	var req DepartmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	dept := &models.Department{
+		Name:     req.Name,
+		ParentId: req.ParentId,
+		Sort:     req.Sort,
+	}
+	if err := c.deptService.WithContext(ctx.Request.Context()).CreateDepartment(dept); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, departmentResponse(dept))
+}
+
+// Update department, a new parent moves its whole subtree
+func (c *DepartmentController) UpdateDepartment(ctx *gin.Context) {
+	deptId, ok := departmentIdParam(ctx)
+	if !ok {
+		return
+	}
+	var req DepartmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	dept := &models.Department{
+		Name:     req.Name,
+		ParentId: req.ParentId,
+		Sort:     req.Sort,
+	}
+	dept.Id = deptId
+	if err := c.deptService.WithContext(ctx.Request.Context()).UpdateDepartment(dept); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, departmentResponse(dept))
+}
+
+// Delete department
+func (c *DepartmentController) DeleteDepartment(ctx *gin.Context) {
+	deptId, ok := departmentIdParam(ctx)
+	if !ok {
+		return
+	}
+	if err := c.deptService.WithContext(ctx.Request.Context()).DeleteDepartment(deptId); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "delete department successfully", nil)
+}
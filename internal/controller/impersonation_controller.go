@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"strconv"
+
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Admin impersonation Controller
+type ImpersonationController struct {
+	impersonationService services.IImpersonationService
+}
+
+// Create ImpersonationController
+func NewImpersonationController() *ImpersonationController {
+	return &ImpersonationController{
+		impersonationService: services.NewImpersonationService(),
+	}
+}
+
+// Issue a short lived access token to act as the user
+func (c *ImpersonationController) Impersonate(ctx *gin.Context) {
+	actorId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	idStr := ctx.Param("id")
+	userId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid userId", nil)
+		return
+	}
+	token, expiresAt, err := c.impersonationService.Impersonate(actorId.(uint64), userId, clientInfo(ctx))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"access_token": token,
+		"expires_at":   expiresAt,
+	})
+}
+
+// List the impersonation audit trail of a user
+func (c *ImpersonationController) GetLogs(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	userId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid userId", nil)
+		return
+	}
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+	logs, total, err := c.impersonationService.ListLogs(userId, page, pageSize)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	var logList []gin.H
+	for _, log := range logs {
+		logList = append(logList, gin.H{
+			"id":         log.Id,
+			"actor_id":   log.ActorId,
+			"user_id":    log.UserId,
+			"token_id":   log.TokenId,
+			"action":     log.Action,
+			"method":     log.Method,
+			"path":       log.Path,
+			"status":     log.Status,
+			"ip":         log.Ip,
+			"user_agent": log.UserAgent,
+			"created_at": log.CreatedAt,
+		})
+	}
+	utils.Success(ctx, gin.H{
+		"list":  logList,
+		"total": total,
+	})
+}
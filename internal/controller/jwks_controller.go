@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"net/http"
+
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS Controller
+type JwksController struct{}
+
+// Create JwksController
+func NewJwksController() *JwksController {
+	return &JwksController{}
+}
+
+// Get the public signing keys, the body is a bare JWK Set as RFC 7517 requires
+func (c *JwksController) GetJwks(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, utils.GetKeyRing().JWKS())
+}
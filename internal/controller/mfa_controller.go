@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"strconv"
+
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Mfa Controller
+type MfaController struct {
+	authService services.IAuthService
+	mfaService  services.IMfaService
+	userService services.IUserService
+}
+
+// Create MfaController
+func NewMfaController() *MfaController {
+	return &MfaController{
+		authService: services.NewAuthService(),
+		mfaService:  services.NewMfaService(),
+		userService: services.NewUserService(),
+	}
+}
+
+// Mfa pending token request params
+type MfaTokenRequest struct {
+	MfaToken string `json:"mfa_token" binding:"required"`
+}
+
+// Mfa verify request params
+type MfaVerifyRequest struct {
+	MfaToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// Mfa code request params
+type MfaCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Exchange the mfa pending token and a code for the token pair
+func (c *MfaController) Verify(ctx *gin.Context) {
+	var req MfaVerifyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	result, err := c.authService.VerifyMfa(req.MfaToken, req.Code, clientInfo(ctx))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, loginResponse(result))
+}
+
+// Start the enrollment required by the role during login
+func (c *MfaController) Enroll(ctx *gin.Context) {
+	var req MfaTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	enrollment, err := c.authService.BeginMfaEnrollment(req.MfaToken)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, enrollment)
+}
+
+// Start the enrollment of the current user
+func (c *MfaController) Setup(ctx *gin.Context) {
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	user, err := c.userService.GetUserById(userId.(uint64))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	enrollment, err := c.mfaService.BeginEnrollment(user)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, enrollment)
+}
+
+// Confirm the enrollment of the current user
+func (c *MfaController) Enable(ctx *gin.Context) {
+	var req MfaCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	user, err := c.userService.GetUserById(userId.(uint64))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	codes, err := c.mfaService.Enable(user, req.Code)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// Disable 2fa of the current user
+func (c *MfaController) Disable(ctx *gin.Context) {
+	var req MfaCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	user, err := c.userService.GetUserById(userId.(uint64))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	if err := c.mfaService.Disable(user, req.Code); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "disable 2fa successfully", nil)
+}
+
+// Regenerate the recovery codes of the current user
+func (c *MfaController) RegenerateRecoveryCodes(ctx *gin.Context) {
+	var req MfaCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	user, err := c.userService.GetUserById(userId.(uint64))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	codes, err := c.mfaService.RegenerateRecoveryCodes(user, req.Code)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// Reset 2fa of a user (admin)
+func (c *MfaController) ResetUser(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	userId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid userId", nil)
+		return
+	}
+	if err := c.mfaService.Reset(userId); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "reset 2fa successfully", nil)
+}
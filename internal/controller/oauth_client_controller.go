@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"strconv"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// OAuth client admin Controller
+type OAuthClientController struct {
+	clientService services.IOAuthClientService
+}
+
+// Create OAuthClientController
+func NewOAuthClientController() *OAuthClientController {
+	return &OAuthClientController{
+		clientService: services.NewOAuthClientService(),
+	}
+}
+
+// Create client request params
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectUris []string `json:"redirect_uris"`
+	Grants       []string `json:"grants" binding:"required,min=1"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	Public       bool     `json:"public"`
+	FirstParty   bool     `json:"first_party"`
+}
+
+// client fields shown to admins, the secret only when just generated
+func oauthClientResponse(client *models.OAuthClient, secret string) gin.H {
+	data := gin.H{
+		"id":            client.Id,
+		"client_id":     client.ClientId,
+		"name":          client.Name,
+		"redirect_uris": client.RedirectUris,
+		"grants":        client.Grants,
+		"scopes":        client.Scopes,
+		"public":        client.Public,
+		"first_party":   client.FirstParty,
+		"status":        client.Status,
+		"created_at":    client.CreatedAt,
+	}
+	if secret != "" {
+		data["client_secret"] = secret
+	}
+	return data
+}
+
+// List clients
+func (c *OAuthClientController) GetClients(ctx *gin.Context) {
+	clients, err := c.clientService.List()
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	var clientList []gin.H
+	for _, client := range clients {
+		clientList = append(clientList, oauthClientResponse(client, ""))
+	}
+	utils.Success(ctx, gin.H{
+		"list": clientList,
+	})
+}
+
+// Register a client, the secret is only returned once
+func (c *OAuthClientController) CreateClient(ctx *gin.Context) {
+	var req CreateOAuthClientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	client, secret, err := c.clientService.Create(services.OAuthClientInput{
+		Name:         req.Name,
+		RedirectUris: req.RedirectUris,
+		Grants:       req.Grants,
+		Scopes:       req.Scopes,
+		Public:       req.Public,
+		FirstParty:   req.FirstParty,
+	})
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, oauthClientResponse(client, secret))
+}
+
+// Delete a client
+func (c *OAuthClientController) DeleteClient(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid clientId", nil)
+		return
+	}
+	if err := c.clientService.Delete(id); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "delete client successfully", nil)
+}
+
+// Replace the secret of a client
+func (c *OAuthClientController) RotateSecret(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid clientId", nil)
+		return
+	}
+	client, secret, err := c.clientService.RotateSecret(id)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, oauthClientResponse(client, secret))
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// OAuth2 authorization server Controller
+type OAuthController struct {
+	oauthService  services.IOAuthService
+	clientService services.IOAuthClientService
+}
+
+// Create OAuthController
+func NewOAuthController() *OAuthController {
+	return &OAuthController{
+		oauthService:  services.NewOAuthService(),
+		clientService: services.NewOAuthClientService(),
+	}
+}
+
+// Authorization request params
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type" binding:"required"`
+	ClientId            string `form:"client_id" json:"client_id" binding:"required"`
+	RedirectUri         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// Consent answer params
+type ApproveRequest struct {
+	AuthorizeRequest
+	Approve bool `json:"approve"`
+}
+
+// Token request params, sent form encoded
+type OAuthTokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectUri  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+}
+
+// Introspection and revocation params, sent form encoded
+type OAuthTokenParamRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+}
+
+func (r AuthorizeRequest) toService() services.AuthorizeRequest {
+	return services.AuthorizeRequest{
+		ResponseType:        r.ResponseType,
+		ClientId:            r.ClientId,
+		RedirectUri:         r.RedirectUri,
+		Scope:               r.Scope,
+		State:               r.State,
+		CodeChallenge:       r.CodeChallenge,
+		CodeChallengeMethod: r.CodeChallengeMethod,
+	}
+}
+
+// Validate an authorization request and return what the consent screen shows
+func (c *OAuthController) Authorize(ctx *gin.Context) {
+	var req AuthorizeRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	info, err := c.oauthService.Authorize(userId.(uint64), req.toService())
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"client": gin.H{
+			"client_id":   info.Client.ClientId,
+			"name":        info.Client.Name,
+			"first_party": info.Client.FirstParty,
+		},
+		"redirect_uri":     info.RedirectUri,
+		"scopes":           info.Scopes,
+		"consent_required": info.ConsentRequired,
+	})
+}
+
+// Approve or deny a request, the client sends the user agent to the returned uri
+func (c *OAuthController) Approve(ctx *gin.Context) {
+	var req ApproveRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	redirectUri, err := c.oauthService.Approve(userId.(uint64), req.toService(), req.Approve)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"redirect_uri": redirectUri,
+	})
+}
+
+// Token endpoint, answers in the RFC 6749 format
+func (c *OAuthController) Token(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+	client, ok := c.authenticateClient(ctx)
+	if !ok {
+		return
+	}
+	var req OAuthTokenRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		oauthErrorResponse(ctx, http.StatusBadRequest, services.OAuthInvalidRequest, err.Error())
+		return
+	}
+	token, err := c.oauthService.Token(client, services.TokenRequest{
+		GrantType:    req.GrantType,
+		Code:         req.Code,
+		RedirectUri:  req.RedirectUri,
+		CodeVerifier: req.CodeVerifier,
+		RefreshToken: req.RefreshToken,
+		Scope:        req.Scope,
+	})
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if errors.As(err, &oauthErr) {
+			oauthErrorResponse(ctx, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+			return
+		}
+		oauthErrorResponse(ctx, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, token)
+}
+
+// Token introspection (RFC 7662), for confidential clients such as resource servers
+func (c *OAuthController) Introspect(ctx *gin.Context) {
+	client, ok := c.authenticateClient(ctx)
+	if !ok {
+		return
+	}
+	if client.Public {
+		oauthErrorResponse(ctx, http.StatusUnauthorized, services.OAuthInvalidClient, "public clients can not introspect tokens")
+		return
+	}
+	var req OAuthTokenParamRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		oauthErrorResponse(ctx, http.StatusBadRequest, services.OAuthInvalidRequest, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, c.oauthService.Introspect(req.Token))
+}
+
+// Token revocation (RFC 7009), unknown tokens still succeed
+func (c *OAuthController) Revoke(ctx *gin.Context) {
+	client, ok := c.authenticateClient(ctx)
+	if !ok {
+		return
+	}
+	var req OAuthTokenParamRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		oauthErrorResponse(ctx, http.StatusBadRequest, services.OAuthInvalidRequest, err.Error())
+		return
+	}
+	if err := c.oauthService.Revoke(client, req.Token); err != nil {
+		oauthErrorResponse(ctx, http.StatusServiceUnavailable, "temporarily_unavailable", err.Error())
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// authenticate the client by http basic or by the form params
+func (c *OAuthController) authenticateClient(ctx *gin.Context) (*models.OAuthClient, bool) {
+	clientId, clientSecret, basic := ctx.Request.BasicAuth()
+	if basic {
+		//basic credentials are form encoded first (RFC 6749 section 2.3.1)
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId = ctx.PostForm("client_id")
+		clientSecret = ctx.PostForm("client_secret")
+	}
+	client, err := c.clientService.Authenticate(clientId, clientSecret)
+	if err != nil {
+		if basic {
+			ctx.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		oauthErrorResponse(ctx, http.StatusUnauthorized, services.OAuthInvalidClient, "client authentication failed")
+		return nil, false
+	}
+	return client, true
+}
+
+// error body of the oauth endpoints
+func oauthErrorResponse(ctx *gin.Context, status int, code, description string) {
+	ctx.JSON(status, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// External identity provider login Controller
+type OidcController struct {
+	authService services.IAuthService
+	oidcService services.IOidcService
+}
+
+// Create OidcController
+func NewOidcController() *OidcController {
+	return &OidcController{
+		authService: services.NewAuthService(),
+		oidcService: services.NewOidcService(),
+	}
+}
+
+// Provider callback params
+type OidcCallbackRequest struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+// List configured providers
+func (c *OidcController) GetProviders(ctx *gin.Context) {
+	utils.Success(ctx, gin.H{
+		"list": c.oidcService.Providers(),
+	})
+}
+
+// Start a provider login, the client sends the user to the returned url
+func (c *OidcController) Login(ctx *gin.Context) {
+	authUrl, err := c.oidcService.AuthorizationURL(ctx.Param("provider"))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"authorization_url": authUrl,
+	})
+}
+
+// Finish a provider login with the code and state of the redirect
+func (c *OidcController) Callback(ctx *gin.Context) {
+	var req OidcCallbackRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	if req.Error != "" {
+		message := req.Error
+		if req.ErrorDescription != "" {
+			message += ": " + req.ErrorDescription
+		}
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, message, nil)
+		return
+	}
+	if req.Code == "" {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "code is required", nil)
+		return
+	}
+	user, err := c.oidcService.Authenticate(ctx.Param("provider"), req.Code, req.State)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, err.Error(), nil)
+		return
+	}
+	result, err := c.authService.ExternalLogin(user, clientInfo(ctx))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, loginResponse(result))
+}
+
+// List identities linked to the current user
+func (c *OidcController) GetIdentities(ctx *gin.Context) {
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	identities, err := c.oidcService.ListIdentities(userId.(uint64))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"list": identities,
+	})
+}
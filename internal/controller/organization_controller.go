@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"strconv"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Organization Controller, for platform admins
+type OrganizationController struct {
+	orgService services.IOrganizationService
+}
+
+// Create OrganizationController
+func NewOrganizationController() *OrganizationController {
+	return &OrganizationController{
+		orgService: services.NewOrganizationService(),
+	}
+}
+
+// Create organization request params
+type CreateOrganizationRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Code        string `json:"code" binding:"required,max=50"`
+	Description string `json:"description" binding:"max=200"`
+}
+
+// Update organization request params
+type UpdateOrganizationRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=200"`
+}
+
+func organizationResponse(org *models.Organization) gin.H {
+	return gin.H{
+		"id":          org.Id,
+		"name":        org.Name,
+		"code":        org.Code,
+		"description": org.Description,
+		"created_at":  org.CreatedAt,
+		"updated_at":  org.UpdatedAt,
+	}
+}
+
+// organization id from the path, fails the request when invalid
+func organizationIdParam(ctx *gin.Context) (uint64, bool) {
+	orgId, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid organizationId", nil)
+		return 0, false
+	}
+	return orgId, true
+}
+
+// Get organization list
+func (c *OrganizationController) GetOrganizations(ctx *gin.Context) {
+	orgs, err := c.orgService.ListOrganizations()
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	var orgList []gin.H
+	for _, org := range orgs {
+		orgList = append(orgList, organizationResponse(org))
+	}
+	utils.Success(ctx, gin.H{
+		"list": orgList,
+	})
+}
+
+// Get organization
+func (c *OrganizationController) GetOrganization(ctx *gin.Context) {
+	orgId, ok := organizationIdParam(ctx)
+	if !ok {
+		return
+	}
+	org, err := c.orgService.GetOrganizationById(orgId)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.NOT_FOUND, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, organizationResponse(org))
+}
+
+// Create organization
+func (c *OrganizationController) CreateOrganization(ctx *gin.Context) {
+	var req CreateOrganizationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	org := &models.Organization{
+		Name:        req.Name,
+		Code:        req.Code,
+		Description: req.Description,
+	}
+	if err := c.orgService.CreateOrganization(org); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, organizationResponse(org))
+}
+
+// Update organization
+func (c *OrganizationController) UpdateOrganization(ctx *gin.Context) {
+	orgId, ok := organizationIdParam(ctx)
+	if !ok {
+		return
+	}
+	var req UpdateOrganizationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	org := &models.Organization{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	org.Id = orgId
+	if err := c.orgService.UpdateOrganization(org); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, organizationResponse(org))
+}
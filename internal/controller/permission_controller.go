@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"bpf.com/pkg/permission"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Permission catalog Controller
+type PermissionController struct{}
+
+// Create PermissionController
+func NewPermissionController() *PermissionController {
+	return &PermissionController{}
+}
+
+// List every declared permission by module
+func (c *PermissionController) GetPermissions(ctx *gin.Context) {
+	utils.Success(ctx, gin.H{
+		"list": permission.Groups(),
+	})
+}
@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"strconv"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Role Controller
+type RoleController struct {
+	roleService services.IRoleService
+}
+
+// Create RoleController
+func NewRoleController() *RoleController {
+	return &RoleController{
+		roleService: services.NewRoleService(),
+	}
+}
+
+// Create and update role request params
+type RoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Code        string   `json:"code" binding:"required,max=50"`
+	Description string   `json:"description" binding:"max=200"`
+	Permissions []string `json:"permissions"`
+	ParentId    *uint64  `json:"parent_id"`
+	//all when empty, custom lists the departments in DataScopeDepts
+	DataScope      string   `json:"data_scope" binding:"omitempty,oneof=all dept dept_and_below self custom"`
+	DataScopeDepts []uint64 `json:"data_scope_depts"`
+}
+
+// Role permission request params
+type RolePermissionRequest struct {
+	Permission string `json:"permission" binding:"required"`
+}
+
+// Magic link switch request params
+type SetMagicLinkRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// role fields shown to admins
+func roleResponse(role *models.Role) gin.H {
+	return gin.H{
+		"id":                 role.Id,
+		"tenant_id":          role.TenantId,
+		"name":               role.Name,
+		"code":               role.Code,
+		"description":        role.Description,
+		"permissions":        role.Permissions,
+		"magic_link_enabled": role.MagicLinkEnabled,
+		"parent_id":          role.ParentId,
+		"data_scope":         role.DataScope,
+		"data_scope_depts":   role.DataScopeDepts,
+		"created_at":         role.CreatedAt,
+		"updated_at":         role.UpdatedAt,
+	}
+}
+
+// role id from the path, fails the request when invalid
+func roleIdParam(ctx *gin.Context) (uint64, bool) {
+	roleId, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid roleId", nil)
+		return 0, false
+	}
+	return roleId, true
+}
+
+// Get role list
+func (c *RoleController) GetRoles(ctx *gin.Context) {
+	roles, err := c.roleService.WithContext(ctx.Request.Context()).ListRoles()
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	var roleList []gin.H
+	for _, role := range roles {
+		roleList = append(roleList, roleResponse(role))
+	}
+	utils.Success(ctx, gin.H{
+		"list": roleList,
+	})
+}
+
+// Get role
+func (c *RoleController) GetRole(ctx *gin.Context) {
+	roleId, ok := roleIdParam(ctx)
+	if !ok {
+		return
+	}
+	role, err := c.roleService.WithContext(ctx.Request.Context()).GetRoleById(roleId)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.NOT_FOUND, "role not found", nil)
+		return
+	}
+	utils.Success(ctx, roleResponse(role))
+}
+
+// Create role
+func (c *RoleController) CreateRole(ctx *gin.Context) {
+	var req RoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	role := &models.Role{
+		Name:           req.Name,
+		Code:           req.Code,
+		Description:    req.Description,
+		Permissions:    req.Permissions,
+		ParentId:       req.ParentId,
+		DataScope:      req.DataScope,
+		DataScopeDepts: req.DataScopeDepts,
+	}
+	if err := c.roleService.WithContext(ctx.Request.Context()).CreateRole(role); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, roleResponse(role))
+}
+
+// Update role
+func (c *RoleController) UpdateRole(ctx *gin.Context) {
+	roleId, ok := roleIdParam(ctx)
+	if !ok {
+		return
+	}
+	var req RoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	role := &models.Role{
+		Name:           req.Name,
+		Code:           req.Code,
+		Description:    req.Description,
+		Permissions:    req.Permissions,
+		ParentId:       req.ParentId,
+		DataScope:      req.DataScope,
+		DataScopeDepts: req.DataScopeDepts,
+	}
+	role.Id = roleId
+	if err := c.roleService.WithContext(ctx.Request.Context()).UpdateRole(role); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, roleResponse(role))
+}
+
+// Delete role
+func (c *RoleController) DeleteRole(ctx *gin.Context) {
+	roleId, ok := roleIdParam(ctx)
+	if !ok {
+		return
+	}
+	if err := c.roleService.WithContext(ctx.Request.Context()).DeleteRole(roleId); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "delete role successfully", nil)
+}
+
+// Add a permission to a role
+func (c *RoleController) AddPermission(ctx *gin.Context) {
+	roleId, ok := roleIdParam(ctx)
+	if !ok {
+		return
+	}
+	var req RolePermissionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	role, err := c.roleService.WithContext(ctx.Request.Context()).AddPermission(roleId, req.Permission)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, roleResponse(role))
+}
+
+// Remove a permission from a role
+func (c *RoleController) RemovePermission(ctx *gin.Context) {
+	roleId, ok := roleIdParam(ctx)
+	if !ok {
+		return
+	}
+	role, err := c.roleService.WithContext(ctx.Request.Context()).RemovePermission(roleId, ctx.Param("permission"))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, roleResponse(role))
+}
+
+// Enable or disable magic link login for a role
+func (c *RoleController) SetMagicLink(ctx *gin.Context) {
+	roleId, ok := roleIdParam(ctx)
+	if !ok {
+		return
+	}
+	var req SetMagicLinkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	role, err := c.roleService.WithContext(ctx.Request.Context()).SetMagicLinkEnabled(roleId, *req.Enabled)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, roleResponse(role))
+}
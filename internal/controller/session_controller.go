@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"strconv"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/services"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Login session Controller
+type SessionController struct {
+	sessionService services.ISessionService
+}
+
+// Create SessionController
+func NewSessionController() *SessionController {
+	return &SessionController{
+		sessionService: services.NewSessionService(),
+	}
+}
+
+// build the session list, the session of the current token is marked
+func sessionList(sessions []*models.Session, currentFamilyId string) []gin.H {
+	var list []gin.H
+	for _, session := range sessions {
+		list = append(list, gin.H{
+			"id":           session.Id,
+			"user_agent":   session.UserAgent,
+			"ip":           session.Ip,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      currentFamilyId != "" && session.FamilyId == currentFamilyId,
+		})
+	}
+	return list
+}
+
+// List sessions of the current user
+func (c *SessionController) GetSessions(ctx *gin.Context) {
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	sessions, err := c.sessionService.List(userId.(uint64))
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	var currentFamilyId string
+	if claims, ok := ctx.Get("claims"); ok {
+		currentFamilyId = claims.(*utils.JWTClaims).SessionId
+	}
+	utils.Success(ctx, gin.H{
+		"list": sessionList(sessions, currentFamilyId),
+	})
+}
+
+// Revoke a session of the current user
+func (c *SessionController) RevokeSession(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	sessionId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid sessionId", nil)
+		return
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		utils.FailWithMessage(ctx, utils.UNAUTHORIZED, "user not found", nil)
+		return
+	}
+	if err := c.sessionService.Revoke(userId.(uint64), sessionId); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "revoke session successfully", nil)
+}
+
+// List sessions of a user
+func (c *SessionController) GetUserSessions(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	userId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid userId", nil)
+		return
+	}
+	sessions, err := c.sessionService.List(userId)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.Success(ctx, gin.H{
+		"list": sessionList(sessions, ""),
+	})
+}
+
+// Revoke a session of a user
+func (c *SessionController) RevokeUserSession(ctx *gin.Context) {
+	userId, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid userId", nil)
+		return
+	}
+	sessionId, err := strconv.ParseUint(ctx.Param("sid"), 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid sessionId", nil)
+		return
+	}
+	if err := c.sessionService.Revoke(userId, sessionId); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "revoke session successfully", nil)
+}
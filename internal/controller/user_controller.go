@@ -8,6 +8,7 @@ import (
 	"bpf.com/internal/models"
 	"bpf.com/internal/services"
 	"bpf.com/pkg/cache"
+	"bpf.com/pkg/middleware"
 	"bpf.com/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -27,17 +28,27 @@ func NewUserController() *UserController {
 // Create User Request
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
-	Password string `json:"password" binding:"required,min=6,max=20"`
+	Password string `json:"password" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Nickname string `json:"nickname" binding:"required,min=2,max=50"`
-	RoleId   uint   `json:"role_id" binding:"required"`
+	//default roles of the organization when empty, other roles need user:assign-role
+	RoleIds []uint64 `json:"role_ids"`
+	//department of the user, none when empty
+	DepartmentId *uint64 `json:"department_id"`
 }
 
 // Update User Request
 type UpdateUserRequest struct {
-	Nickname string `json:"nickname" binding:"required,min=2,max=50"`
-	Email    string `json:"email" binding:"required,email"`
-	RoleId   uint   `json:"roleId" binding:"required"`
+	Nickname string   `json:"nickname" binding:"required,min=2,max=50"`
+	Email    string   `json:"email" binding:"required,email"`
+	RoleIds  []uint64 `json:"roleIds" binding:"omitempty,min=1"`
+	//moves the user to another department, kept when empty
+	DepartmentId *uint64 `json:"departmentId"`
+}
+
+// Update User Status Request
+type UpdateUserStatusRequest struct {
+	Status *int `json:"status" binding:"required"`
 }
 
 // Query User Request
@@ -47,6 +58,19 @@ type QueryUserRequest struct {
 	PageSize int    `json:"pageSize"`
 }
 
+// assigned roles of a user, inherited parents are not listed
+func userRoles(user *models.User) []gin.H {
+	roles := make([]gin.H, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roles = append(roles, gin.H{
+			"id":   role.Id,
+			"name": role.Name,
+			"code": role.Code,
+		})
+	}
+	return roles
+}
+
 // Get User list
 func (c *UserController) GetUsers(ctx *gin.Context) {
 	//get page pramas
@@ -63,7 +87,7 @@ func (c *UserController) GetUsers(ctx *gin.Context) {
 	pageSize := req.PageSize
 	Search := req.Search
 
-	users, total, err := c.userService.ListUsers(pageNum, pageSize, Search)
+	users, total, err := c.userService.WithContext(ctx.Request.Context()).ListUsers(pageNum, pageSize, Search)
 	if err != nil {
 		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
 		return
@@ -75,17 +99,15 @@ func (c *UserController) GetUsers(ctx *gin.Context) {
 	var userList []gin.H
 	for _, user := range users {
 		userList = append(userList, gin.H{
-			"id":       user.Id,
-			"username": user.Username,
-			"email":    user.Email,
-			"nickname": user.Nickname,
-			"role": gin.H{
-				"id":   user.Role.Id,
-				"name": user.Role.Name,
-				"code": user.Role.Code,
-			},
-			"created_at": user.CreatedAt,
-			"updated_at": user.UpdatedAt,
+			"id":            user.Id,
+			"tenant_id":     user.TenantId,
+			"department_id": user.DepartmentId,
+			"username":      user.Username,
+			"email":         user.Email,
+			"nickname":      user.Nickname,
+			"roles":         userRoles(user),
+			"created_at":    user.CreatedAt,
+			"updated_at":    user.UpdatedAt,
 		})
 	}
 	utils.Success(ctx, gin.H{
@@ -104,7 +126,7 @@ func (c *UserController) GetUser(ctx *gin.Context) {
 		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "无效的用户ID", nil)
 		return
 	}
-	user, err := c.userService.GetUserById(id)
+	user, err := c.userService.WithContext(ctx.Request.Context()).GetUserById(id)
 	if err != nil {
 		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
 		return
@@ -115,17 +137,15 @@ func (c *UserController) GetUser(ctx *gin.Context) {
 	}
 
 	utils.Success(ctx, gin.H{
-		"id":       user.Id,
-		"username": user.Username,
-		"email":    user.Email,
-		"nickname": user.Nickname,
-		"role": gin.H{
-			"id":   user.Role.Id,
-			"name": user.Role.Name,
-			"code": user.Role.Code,
-		},
-		"created_at": user.CreatedAt,
-		"updated_at": user.UpdatedAt,
+		"id":            user.Id,
+		"tenant_id":     user.TenantId,
+		"department_id": user.DepartmentId,
+		"username":      user.Username,
+		"email":         user.Email,
+		"nickname":      user.Nickname,
+		"roles":         userRoles(user),
+		"created_at":    user.CreatedAt,
+		"updated_at":    user.UpdatedAt,
 	})
 }
 
@@ -136,23 +156,25 @@ func (c *UserController) CreateUser(ctx *gin.Context) {
 		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
 		return
 	}
-	user := &models.User{
-		Username: req.Username,
-		Email:    req.Email,
-		Nickname: req.Nickname,
-		RoleId:   req.RoleId,
-	}
-	if err := user.SetPassword(req.Password); err != nil {
-		utils.FailWithMessage(ctx, utils.ERROR, "set password fail: "+err.Error(), nil)
+	//user:create alone creates users with the default roles
+	if len(req.RoleIds) > 0 && !middleware.HasPermission(ctx, models.PermUserAssignRole) {
+		utils.FailWithMessage(ctx, utils.FORBIDDEN, "access control require permission: "+models.PermUserAssignRole, nil)
 		return
 	}
-	if err := c.userService.CreateUser(user); err != nil {
+	user := &models.User{
+		Username:     req.Username,
+		Email:        req.Email,
+		Nickname:     req.Nickname,
+		DepartmentId: req.DepartmentId,
+	}
+	if err := c.userService.WithContext(ctx.Request.Context()).CreateUser(user, req.Password, req.RoleIds); err != nil {
 		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
 		return
 	}
 	utils.Success(ctx, gin.H{
-		"user_id":  user.Id,
-		"username": user.Username,
+		"user_id":   user.Id,
+		"tenant_id": user.TenantId,
+		"username":  user.Username,
 	})
 }
 
@@ -170,8 +192,23 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
 		return
 	}
+	//owners editing their own profile keep their roles and department
+	if req.RoleIds != nil && ctx.GetBool("ownerAccess") {
+		utils.FailWithMessage(ctx, utils.FORBIDDEN, "can not change your own roles", nil)
+		return
+	}
+	//user:update alone does not allow handing out roles
+	if req.RoleIds != nil && !middleware.HasPermission(ctx, models.PermUserAssignRole) {
+		utils.FailWithMessage(ctx, utils.FORBIDDEN, "access control require permission: "+models.PermUserAssignRole, nil)
+		return
+	}
+	if req.DepartmentId != nil && ctx.GetBool("ownerAccess") {
+		utils.FailWithMessage(ctx, utils.FORBIDDEN, "can not change your own department", nil)
+		return
+	}
 
-	user, err := c.userService.GetUserById(userId)
+	userService := c.userService.WithContext(ctx.Request.Context())
+	user, err := userService.GetUserById(userId)
 	if err != nil {
 		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
 		return
@@ -181,11 +218,19 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 		return
 	}
 
+	//owners confirm a new email through /auth/change-email
+	if ctx.GetBool("ownerAccess") && req.Email != user.Email {
+		utils.FailWithMessage(ctx, utils.FORBIDDEN, "change your own email through /auth/change-email", nil)
+		return
+	}
+
 	user.Nickname = req.Nickname
 	user.Email = req.Email
-	user.RoleId = req.RoleId
+	if req.DepartmentId != nil {
+		user.DepartmentId = req.DepartmentId
+	}
 
-	if err := c.userService.UpdateUser(user); err != nil {
+	if err := userService.UpdateUser(user, req.RoleIds); err != nil {
 		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
 		return
 	}
@@ -201,9 +246,44 @@ func (c *UserController) DeleteUser(ctx *gin.Context) {
 		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid userId", nil)
 		return
 	}
-	if err := c.userService.DeleteUser(userId); err != nil {
+	if err := c.userService.WithContext(ctx.Request.Context()).DeleteUser(userId); err != nil {
 		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
 		return
 	}
 	utils.SuccessWithMessage(ctx, "delete user successfully", nil)
 }
+
+// Update user status
+func (c *UserController) UpdateUserStatus(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	userId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid userId", nil)
+		return
+	}
+	var req UpdateUserStatusRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, err.Error(), nil)
+		return
+	}
+	if err := c.userService.WithContext(ctx.Request.Context()).UpdateUserStatus(userId, *req.Status); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "update user status successfully", nil)
+}
+
+// Unlock a user locked out by failed logins
+func (c *UserController) UnlockUser(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	userId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.FailWithMessage(ctx, utils.INVALID_PARAMS, "invalid userId", nil)
+		return
+	}
+	if err := c.userService.WithContext(ctx.Request.Context()).UnlockUser(userId); err != nil {
+		utils.FailWithMessage(ctx, utils.ERROR, err.Error(), nil)
+		return
+	}
+	utils.SuccessWithMessage(ctx, "unlock user successfully", nil)
+}
@@ -0,0 +1,39 @@
+// internal/models/casbin_rule.go
+package models
+
+// casbin policy line, ptype p or g followed by its values, same layout as the casbin gorm adapter
+type CasbinRule struct {
+	Id    uint64 `gorm:"primarykey" json:"id"`
+	Ptype string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"ptype"`
+	V0    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v0"`
+	V1    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v1"`
+	V2    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v2"`
+	V3    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v3"`
+	V4    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v4"`
+	V5    string `gorm:"size:100;uniqueIndex:idx_casbin_rule" json:"v5"`
+}
+
+func (CasbinRule) TableName() string {
+	return "t_sys_casbin_rules"
+}
+
+// build a rule from a policy line without its ptype
+func NewCasbinRule(ptype string, values []string) *CasbinRule {
+	rule := &CasbinRule{Ptype: ptype}
+	fields := []*string{&rule.V0, &rule.V1, &rule.V2, &rule.V3, &rule.V4, &rule.V5}
+	for i, value := range values {
+		if i < len(fields) {
+			*fields[i] = value
+		}
+	}
+	return rule
+}
+
+// the policy line with its ptype first, trailing empty values dropped
+func (r *CasbinRule) Line() []string {
+	line := []string{r.Ptype, r.V0, r.V1, r.V2, r.V3, r.V4, r.V5}
+	for len(line) > 1 && line[len(line)-1] == "" {
+		line = line[:len(line)-1]
+	}
+	return line
+}
@@ -0,0 +1,50 @@
+// internal/models/department.go
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// a node of the department tree of an organization
+type Department struct {
+	BaseModel
+	TenantId uint64  `gorm:"index;not null;default:1" json:"tenant_id"`
+	ParentId *uint64 `gorm:"index" json:"parent_id"`
+	Name     string  `gorm:"size:50;not null" json:"name"`
+	//ids from the root down to the department, as /1/4/9/, so a subtree is a path prefix
+	Path string `gorm:"size:500;index" json:"path"`
+	//siblings are ordered by sort then id
+	Sort int `gorm:"default:0" json:"sort"`
+}
+
+func (Department) TableName() string {
+	return "t_sys_departments"
+}
+
+// path of a department below the parent path, "" for a root department
+func DepartmentPath(parentPath string, id uint64) string {
+	if parentPath == "" {
+		parentPath = "/"
+	}
+	return parentPath + strconv.FormatUint(id, 10) + "/"
+}
+
+type DepartmentIds []uint64
+
+func (d *DepartmentIds) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("类型断言为[]byte失败")
+	}
+	return json.Unmarshal(bytes, d)
+}
+
+func (d DepartmentIds) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	return json.Marshal(d)
+}
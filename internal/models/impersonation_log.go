@@ -0,0 +1,26 @@
+// internal/models/impersonation_log.go
+package models
+
+// impersonation actions
+const (
+	ImpersonationStart   = "start"
+	ImpersonationRequest = "request"
+)
+
+// audit entry of an admin acting as a user, one for the token and one per request
+type ImpersonationLog struct {
+	BaseModel
+	ActorId   uint64 `gorm:"index;not null" json:"actor_id"`
+	UserId    uint64 `gorm:"index;not null" json:"user_id"`
+	TokenId   string `gorm:"size:64;index" json:"token_id"`
+	Action    string `gorm:"size:20;not null" json:"action"`
+	Method    string `gorm:"size:10" json:"method"`
+	Path      string `gorm:"size:255" json:"path"`
+	Status    int    `json:"status"`
+	Ip        string `gorm:"size:64" json:"ip"`
+	UserAgent string `gorm:"size:255" json:"user_agent"`
+}
+
+func (ImpersonationLog) TableName() string {
+	return "t_sys_impersonation_logs"
+}
@@ -0,0 +1,24 @@
+// internal/models/magic_link.go
+package models
+
+import "time"
+
+// single-use passwordless login link, bound to the browser holding the nonce cookie.
+// Only hashes of the token and the nonce are stored
+type MagicLink struct {
+	BaseModel
+	UserId    uint64     `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	NonceHash string     `gorm:"size:64;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RequestIp string     `gorm:"size:64" json:"request_ip"`
+}
+
+func (MagicLink) TableName() string {
+	return "t_sys_magic_links"
+}
+
+func (l *MagicLink) IsValid() bool {
+	return l.UsedAt == nil && time.Now().Before(l.ExpiresAt)
+}
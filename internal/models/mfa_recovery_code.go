@@ -0,0 +1,16 @@
+// internal/models/mfa_recovery_code.go
+package models
+
+import "time"
+
+// one-time recovery code for a user with 2FA enabled, only the hash is stored
+type MfaRecoveryCode struct {
+	BaseModel
+	UserId   uint64     `gorm:"index;not null" json:"user_id"`
+	CodeHash string     `gorm:"size:64;not null" json:"-"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
+func (MfaRecoveryCode) TableName() string {
+	return "t_sys_mfa_recovery_codes"
+}
@@ -0,0 +1,67 @@
+// internal/models/oauth_client.go
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// oauth grant types
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+type StringList []string
+
+func (l *StringList) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("类型断言为[]byte失败")
+	}
+	return json.Unmarshal(bytes, l)
+}
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
+func (l StringList) Contains(value string) bool {
+	for _, item := range l {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// app allowed to get tokens from go-bpf, public clients have no secret and must use pkce
+type OAuthClient struct {
+	BaseModel
+	ClientId     string      `gorm:"size:64;uniqueIndex;not null" json:"client_id"`
+	SecretHash   string      `gorm:"size:64" json:"-"`
+	Name         string      `gorm:"size:100;not null" json:"name"`
+	RedirectUris StringList  `gorm:"type:json" json:"redirect_uris"`
+	Grants       StringList  `gorm:"type:json" json:"grants"`
+	Scopes       Permissions `gorm:"type:json" json:"scopes"`
+	Public       bool        `gorm:"default:false" json:"public"`
+	FirstParty   bool        `gorm:"default:false" json:"first_party"`
+	Status       int         `gorm:"default:1" json:"status"`
+}
+
+func (OAuthClient) TableName() string {
+	return "t_sys_oauth_clients"
+}
+
+func (c *OAuthClient) IsActive() bool {
+	return c.Status == StatusActive
+}
+
+func (c *OAuthClient) AllowsGrant(grant string) bool {
+	return c.Grants.Contains(grant)
+}
@@ -0,0 +1,24 @@
+// internal/models/oauth_consent.go
+package models
+
+// scopes a user approved for an oauth client
+type OAuthConsent struct {
+	BaseModel
+	UserId   uint64      `gorm:"not null;uniqueIndex:idx_consent_user_client" json:"user_id"`
+	ClientId string      `gorm:"size:64;not null;uniqueIndex:idx_consent_user_client" json:"client_id"`
+	Scopes   Permissions `gorm:"type:json" json:"scopes"`
+}
+
+func (OAuthConsent) TableName() string {
+	return "t_sys_oauth_consents"
+}
+
+// every scope was approved before
+func (c *OAuthConsent) Covers(scopes []string) bool {
+	for _, scope := range scopes {
+		if !c.Scopes.HasPermission(scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,14 @@
+// internal/models/organization.go
+package models
+
+// a tenant, users and roles belong to exactly one organization
+type Organization struct {
+	BaseModel
+	Name        string `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Code        string `gorm:"size:50;uniqueIndex;not null" json:"code"`
+	Description string `gorm:"size:200" json:"description"`
+}
+
+func (Organization) TableName() string {
+	return "t_sys_organizations"
+}
@@ -0,0 +1,13 @@
+// internal/models/password_history.go
+package models
+
+// previous password hash of a user, checked so old passwords are not reused
+type PasswordHistory struct {
+	BaseModel
+	UserId   uint64 `gorm:"index;not null" json:"user_id"`
+	Password string `gorm:"size:255;not null" json:"-"`
+}
+
+func (PasswordHistory) TableName() string {
+	return "t_sys_password_histories"
+}
@@ -0,0 +1,22 @@
+// internal/models/password_reset.go
+package models
+
+import "time"
+
+// single-use password reset token, only the hash is stored
+type PasswordReset struct {
+	BaseModel
+	UserId    uint64     `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RequestIp string     `gorm:"size:64" json:"request_ip"`
+}
+
+func (PasswordReset) TableName() string {
+	return "t_sys_password_resets"
+}
+
+func (r *PasswordReset) IsValid() bool {
+	return r.UsedAt == nil && time.Now().Before(r.ExpiresAt)
+}
@@ -0,0 +1,38 @@
+// internal/models/permission.go
+package models
+
+import "bpf.com/pkg/permission"
+
+// permissions of the built-in modules, roles and routes may only use declared ones
+func init() {
+	permission.Register("user", "User accounts",
+		permission.Permission{Code: PermUserView, Description: "View own profile and basic user info"},
+		permission.Permission{Code: PermUserEdit, Description: "Edit own profile",
+			Implies: []string{PermUserUpdateOwn}},
+		permission.Permission{Code: PermUserList, Description: "List all users"},
+		permission.Permission{Code: PermUserRead, Description: "Read any user"},
+		permission.Permission{Code: PermUserCreate, Description: "Create users"},
+		permission.Permission{Code: PermUserUpdate, Description: "Update any user",
+			Implies: []string{PermUserUpdateOwn}},
+		permission.Permission{Code: PermUserUpdateOwn, Description: "Update own user"},
+		permission.Permission{Code: PermUserDelete, Description: "Delete users"},
+		permission.Permission{Code: PermUserManage, Description: "Manage users, required with user:delete",
+			Implies: []string{PermUserRead, PermUserUpdate}},
+		permission.Permission{Code: PermUserAssignRole, Description: "Assign roles to users"},
+	)
+	permission.Register("content", "Content",
+		permission.Permission{Code: PermContentView, Description: "View content"},
+		permission.Permission{Code: PermContentCreate, Description: "Create content"},
+		permission.Permission{Code: PermContentEdit, Description: "Edit any content",
+			Implies: []string{PermContentEditOwn}},
+		permission.Permission{Code: PermContentDelete, Description: "Delete any content",
+			Implies: []string{PermContentDeleteOwn}},
+		permission.Permission{Code: PermContentEditOwn, Description: "Edit own content"},
+		permission.Permission{Code: PermContentDeleteOwn, Description: "Delete own content"},
+	)
+	permission.Register("system", "System administration",
+		permission.Permission{Code: PermSystemConfig, Description: "Manage roles and system configuration"},
+		permission.Permission{Code: PermSystemLog, Description: "Read system logs"},
+		permission.Permission{Code: PermSystemBackup, Description: "Run and restore backups"},
+	)
+}
@@ -0,0 +1,38 @@
+// internal/models/personal_access_token.go
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// personal access token prefix, lets JwtAuth tell them apart from JWTs
+const PersonalAccessTokenPrefix = "bpf_pat_"
+
+// long-lived named token for scripts and CI, only the hash is stored
+type PersonalAccessToken struct {
+	BaseModel
+	UserId     uint64      `gorm:"index;not null" json:"user_id"`
+	Name       string      `gorm:"size:100;not null" json:"name"`
+	Prefix     string      `gorm:"size:20;not null" json:"prefix"`
+	TokenHash  string      `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes     Permissions `gorm:"type:json" json:"scopes"`
+	ExpiresAt  *time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time  `json:"revoked_at"`
+}
+
+func (PersonalAccessToken) TableName() string {
+	return "t_sys_access_tokens"
+}
+
+func (t *PersonalAccessToken) IsValid() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
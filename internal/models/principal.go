@@ -0,0 +1,130 @@
+// internal/models/principal.go
+package models
+
+import (
+	"context"
+
+	"bpf.com/pkg/datascope"
+)
+
+// what authorization needs to know about a user, built once from the user and
+// its roles so permission checks do not load the user again
+type Principal struct {
+	UserId        uint64 `json:"user_id"`
+	TenantId      uint64 `json:"tenant_id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Status        int    `json:"status"`
+	AuthSource    string `json:"auth_source"`
+	EmailVerified bool   `json:"email_verified"`
+	MfaEnabled    bool   `json:"mfa_enabled"`
+	//assigned role codes followed by the inherited ones
+	Roles []string `json:"roles"`
+	//permissions of every role and its parents
+	Permissions Permissions `json:"permissions"`
+	//widest data scope of the assigned roles
+	DataScope datascope.Scope `json:"data_scope"`
+}
+
+// flatten the roles of a user and their parent chains
+func NewPrincipal(user *User) *Principal {
+	principal := &Principal{
+		UserId:        user.Id,
+		TenantId:      user.TenantId,
+		Username:      user.Username,
+		Email:         user.Email,
+		Status:        user.Status,
+		AuthSource:    user.AuthSource,
+		EmailVerified: user.IsEmailVerified(),
+		MfaEnabled:    user.MfaEnabled,
+		Roles:         user.RoleCodes(),
+		Permissions:   Permissions{},
+		DataScope:     newDataScope(user),
+	}
+	for _, assigned := range user.Roles {
+		for role, depth := assigned, 0; role != nil && depth < MaxRoleDepth; role, depth = role.Parent, depth+1 {
+			if role != assigned && !principal.HasRole(role.Code) {
+				principal.Roles = append(principal.Roles, role.Code)
+			}
+			for _, permission := range role.Permissions {
+				principal.Permissions.AddPermission(permission)
+			}
+		}
+	}
+	return principal
+}
+
+// union of the data scopes of the assigned roles, one unrestricted role lifts the restriction.
+// Scopes relative to the department give nothing to users without one
+func newDataScope(user *User) datascope.Scope {
+	scope := datascope.Scope{Restricted: true, UserId: user.Id}
+	for _, role := range user.Roles {
+		switch role.DataScope {
+		case DataScopeDept:
+			if user.DepartmentId != nil {
+				scope.Departments = appendId(scope.Departments, *user.DepartmentId)
+			}
+		case DataScopeDeptAndBelow:
+			if user.DepartmentId != nil {
+				scope.Subtrees = appendId(scope.Subtrees, *user.DepartmentId)
+			}
+		case DataScopeCustom:
+			for _, id := range role.DataScopeDepts {
+				scope.Departments = appendId(scope.Departments, id)
+			}
+		case DataScopeSelf:
+		default:
+			return datascope.Scope{}
+		}
+	}
+	return scope
+}
+
+func appendId(ids []uint64, id uint64) []uint64 {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+func (p *Principal) IsActive() bool {
+	return p.Status == StatusActive
+}
+
+// superusers form the platform tier, they act across every organization
+func (p *Principal) IsPlatformAdmin() bool {
+	return p.HasRole(RoleSuperuser)
+}
+
+// an assigned or inherited role
+func (p *Principal) HasRole(code string) bool {
+	for _, role := range p.Roles {
+		if role == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasPermission(permission string) bool {
+	return p.Permissions.HasPermission(permission)
+}
+
+type callerKey struct{}
+
+// the context acts for the principal, services read it back to refuse changes
+// the caller may not make whatever permission let the request through
+func WithCaller(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, callerKey{}, principal)
+}
+
+// principal the context acts for
+func CallerFromContext(ctx context.Context) (*Principal, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	principal, ok := ctx.Value(callerKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
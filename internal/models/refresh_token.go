@@ -0,0 +1,36 @@
+// internal/models/refresh_token.go
+package models
+
+import "time"
+
+// RefreshToken is one link of a refresh token family.
+// Every rotation marks the presented token as used and adds a new one
+// to the same family; presenting a used token revokes the whole family.
+type RefreshToken struct {
+	BaseModel
+	UserId    uint64     `gorm:"index;not null" json:"user_id"`
+	FamilyId  string     `gorm:"size:64;index;not null" json:"family_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	//set for tokens granted to an oauth client, empty for go-bpf logins
+	ClientId string      `gorm:"size:64;index" json:"client_id"`
+	Scopes   Permissions `gorm:"type:json" json:"scopes"`
+}
+
+func (RefreshToken) TableName() string {
+	return "t_sys_refresh_tokens"
+}
+
+func (t *RefreshToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+func (t *RefreshToken) IsUsed() bool {
+	return t.UsedAt != nil
+}
+
+func (t *RefreshToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
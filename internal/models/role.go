@@ -5,6 +5,8 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+
+	registry "bpf.com/pkg/permission"
 )
 
 const (
@@ -12,11 +14,22 @@ const (
 	PermUserCreate = "user:create"
 	PermUserEdit   = "user:edit"
 	PermUserDelete = "user:delete"
+	PermUserList   = "user:list"
+	PermUserRead   = "user:read"
+	PermUserUpdate = "user:update"
+	PermUserManage = "user:manage"
+	//own scoped, the resource has to belong to the user
+	PermUserUpdateOwn = "user:update:own"
+	//changing the roles of a user, not implied by user:update or user:manage
+	PermUserAssignRole = "user:assign-role"
 
 	PermContentView   = "content:view"
 	PermContentCreate = "content:create"
 	PermContentEdit   = "content:edit"
 	PermContentDelete = "content:delete"
+	//own scoped, granted as a whole by content:*:own
+	PermContentEditOwn   = "content:edit:own"
+	PermContentDeleteOwn = "content:delete:own"
 
 	PermSystemConfig = "system:config"
 	PermSystemLog    = "system:log"
@@ -42,9 +55,26 @@ func (p Permissions) Value() (driver.Value, error) {
 	return json.Marshal(p)
 }
 
+// a held permission matches exactly, as a wildcard pattern such as user:* or
+// content:*:own, or through the permissions it implies such as user:manage
 func (p Permissions) HasPermission(permission string) bool {
 	for _, perm := range p {
-		if perm == permission || perm == "*" {
+		if registry.Match(perm, permission) {
+			return true
+		}
+		for _, implied := range registry.Implied(perm) {
+			if registry.Match(implied, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exact match, unlike HasPermission the * permission does not cover others
+func (p Permissions) Contains(permission string) bool {
+	for _, perm := range p {
+		if perm == permission {
 			return true
 		}
 	}
@@ -71,18 +101,56 @@ func (p *Permissions) RemovePermission(permission string) {
 
 type Role struct {
 	BaseModel
-	Name        string      `gorm:"size:50;uniqueIndex;not null" json:"name"`
-	Code        string      `gorm:"size:50;uniqueIndex;not null" json:"code"`
+	//names and codes are unique within the organization
+	TenantId    uint64      `gorm:"uniqueIndex:idx_role_tenant_name;uniqueIndex:idx_role_tenant_code;not null;default:1" json:"tenant_id"`
+	Name        string      `gorm:"size:50;uniqueIndex:idx_role_tenant_name;not null" json:"name"`
+	Code        string      `gorm:"size:50;uniqueIndex:idx_role_tenant_code;not null" json:"code"`
 	Description string      `gorm:"size:200" json:"description"`
 	Permissions Permissions `gorm:"type:json" json:"permissions"`
+	//members may log in with a link sent by email
+	MagicLinkEnabled bool `gorm:"default:false" json:"magic_link_enabled"`
+	//permissions of the parent chain are inherited, the chain is attached by the repository
+	ParentId *uint64 `gorm:"index" json:"parent_id"`
+	Parent   *Role   `gorm:"foreignKey:ParentId" json:"-"`
+	//users and other department owned rows the members see, not inherited by child roles
+	DataScope      string        `gorm:"size:20;default:all" json:"data_scope"`
+	DataScopeDepts DepartmentIds `gorm:"type:json" json:"data_scope_depts"`
 }
 
+// data scopes of a role
+const (
+	DataScopeAll          = "all"
+	DataScopeDept         = "dept"
+	DataScopeDeptAndBelow = "dept_and_below"
+	DataScopeSelf         = "self"
+	DataScopeCustom       = "custom"
+)
+
+// deepest parent chain followed, guards against cycles in stored data
+const MaxRoleDepth = 8
+
 func (Role) TableName() string {
 	return "t_sys_roles"
 }
 
+// own permissions and the ones inherited from the parent chain
 func (r *Role) HasPermission(permission string) bool {
-	return r.Permissions.HasPermission(permission)
+	for role, depth := r, 0; role != nil && depth < MaxRoleDepth; role, depth = role.Parent, depth+1 {
+		if role.Permissions.HasPermission(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// the role is the code or inherits from the role with the code
+func (r *Role) Is(code string) bool {
+	for role, depth := r, 0; role != nil && depth < MaxRoleDepth; role, depth = role.Parent, depth+1 {
+		if role.Code == code {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *Role) AddPermission(permission string) {
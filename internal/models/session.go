@@ -0,0 +1,24 @@
+// internal/models/session.go
+package models
+
+import "time"
+
+// login session of a device, one per refresh token family
+type Session struct {
+	BaseModel
+	UserId     uint64     `gorm:"index;not null" json:"user_id"`
+	FamilyId   string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	UserAgent  string     `gorm:"size:255" json:"user_agent"`
+	Ip         string     `gorm:"size:64" json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+func (Session) TableName() string {
+	return "t_sys_sessions"
+}
+
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
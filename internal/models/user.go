@@ -5,7 +5,13 @@ import (
 	"errors"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"bpf.com/pkg/hasher"
+)
+
+// password backends
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLdap  = "ldap"
 )
 
 const (
@@ -17,53 +23,103 @@ const (
 
 type User struct {
 	BaseModel
+	//organization of the user, usernames and emails stay unique across organizations
+	TenantId  uint64     `gorm:"index;not null;default:1" json:"tenant_id"`
 	Username  string     `gorm:"size:50;uniqueIndex;not null" json:"username"`
-	Password  string     `gorm:"size:100;not null" json:"-"`
+	Password  string     `gorm:"size:255;not null" json:"-"`
 	Email     string     `gorm:"size:100;uniqueIndex;not null" json:"email"`
 	Phone     string     `gorm:"size:20" json:"phone"`
 	Nickname  string     `gorm:"size:50" json:"nickname"`
-	RoleId    uint       `gorm:"default:3" json:"role_id"`
-	Role      *Role      `gorm:"foreignKey:RoleId" json:"role,omitempty"`
+	Roles     []*Role    `gorm:"many2many:t_sys_user_roles" json:"roles,omitempty"`
 	Status    int        `gorm:"default:1" json:"status"`
 	LastLogin *time.Time `json:"last_login"`
+	//mfa secret is kept while enrolling, mfa is on once enabled
+	MfaEnabled bool   `gorm:"default:false" json:"mfa_enabled"`
+	MfaSecret  string `gorm:"size:64" json:"-"`
+	//email change waits here until the new address is verified
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PendingEmail    string     `gorm:"size:100" json:"pending_email,omitempty"`
+	//backend owning the password, directory users have no usable local password
+	AuthSource string `gorm:"size:20;default:local" json:"auth_source"`
+	//starts the password max age, null until the first change
+	PasswordChangedAt *time.Time `json:"password_changed_at"`
+	//department the user works in, data scopes of roles are relative to it
+	DepartmentId *uint64     `gorm:"index" json:"department_id"`
+	Department   *Department `gorm:"foreignKey:DepartmentId" json:"-"`
 }
 
 func (User) TableName() string {
 	return "t_sys_users"
 }
 
+// users always see their own row whatever their data scope
+func (User) OwnerColumn() string {
+	return "id"
+}
+
 func (u *User) SetPassword(password string) error {
 	if len(password) == 0 {
 		return errors.New("密码不能为空")
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hasher.Hash(password)
 	if err != nil {
 		return err
 	}
 
-	u.Password = string(hashedPassword)
+	u.Password = hashedPassword
 	return nil
 }
 
 func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
+	return hasher.Verify(password, u.Password)
+}
+
+// the password hash was made with outdated hashing parameters
+func (u *User) PasswordNeedsRehash() bool {
+	return hasher.NeedsRehash(u.Password)
 }
 
 func (u *User) IsActive() bool {
 	return u.Status == 1
 }
 
+func (u *User) IsLocal() bool {
+	return u.AuthSource == "" || u.AuthSource == AuthSourceLocal
+}
+
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
 func (u *User) IsAdmin() bool {
-	if u.Role != nil {
-		return u.Role.Code == RoleAdmin
+	return u.HasRole(RoleAdmin)
+}
+
+// one of the roles is the code or inherits from it
+func (u *User) HasRole(code string) bool {
+	for _, role := range u.Roles {
+		if role.Is(code) {
+			return true
+		}
 	}
 	return false
 }
 
+// codes of the assigned roles
+func (u *User) RoleCodes() []string {
+	codes := make([]string, 0, len(u.Roles))
+	for _, role := range u.Roles {
+		codes = append(codes, role.Code)
+	}
+	return codes
+}
+
+// effective permissions are the union over every role and its parents
 func (u *User) HasPermission(permission string) bool {
-	if u.Role != nil {
-		return u.Role.HasPermission(permission)
+	for _, role := range u.Roles {
+		if role.HasPermission(permission) {
+			return true
+		}
 	}
 	return false
 }
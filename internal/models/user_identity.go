@@ -0,0 +1,18 @@
+// internal/models/user_identity.go
+package models
+
+import "time"
+
+// external identity linked to a user, one per provider subject
+type UserIdentity struct {
+	BaseModel
+	UserId      uint64     `gorm:"index;not null" json:"user_id"`
+	Provider    string     `gorm:"size:50;not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_identity_provider_subject" json:"subject"`
+	Email       string     `gorm:"size:100" json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "t_sys_user_identities"
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"fmt"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Casbin rule repository interface
+type ICasbinRuleRepository interface {
+	Create(rule *models.CasbinRule) error
+	Delete(rule *models.CasbinRule) error
+	CreateAll(rules []*models.CasbinRule) error
+	DeleteAll(rules []*models.CasbinRule) error
+	DeleteFiltered(ptype string, fieldIndex int, fieldValues ...string) error
+	ReplaceAll(rules []*models.CasbinRule) error
+	List() ([]*models.CasbinRule, error)
+	Count() (int64, error)
+}
+
+// CasbinRuleRepository implements ICasbinRuleRepository
+type CasbinRuleRepository struct {
+	db *gorm.DB
+}
+
+// create CasbinRuleRepository
+func NewCasbinRuleRepository() *CasbinRuleRepository {
+	return &CasbinRuleRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save rule
+func (r *CasbinRuleRepository) Create(rule *models.CasbinRule) error {
+	return r.db.Create(rule).Error
+}
+
+// delete the rule with exactly the same values
+func (r *CasbinRuleRepository) Delete(rule *models.CasbinRule) error {
+	return r.db.Where("ptype = ? AND v0 = ? AND v1 = ? AND v2 = ? AND v3 = ? AND v4 = ? AND v5 = ?",
+		rule.Ptype, rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5).
+		Delete(&models.CasbinRule{}).Error
+}
+
+// save rules in one transaction
+func (r *CasbinRuleRepository) CreateAll(rules []*models.CasbinRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(rules, 100).Error
+}
+
+// delete the rules with exactly the same values in one transaction
+func (r *CasbinRuleRepository) DeleteAll(rules []*models.CasbinRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		repo := &CasbinRuleRepository{db: tx}
+		for _, rule := range rules {
+			if err := repo.Delete(rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// delete rules whose values from fieldIndex on match, empty values match anything
+func (r *CasbinRuleRepository) DeleteFiltered(ptype string, fieldIndex int, fieldValues ...string) error {
+	db := r.db.Where("ptype = ?", ptype)
+	for i, value := range fieldValues {
+		index := fieldIndex + i
+		if value == "" || index > 5 {
+			continue
+		}
+		db = db.Where(fmt.Sprintf("v%d = ?", index), value)
+	}
+	return db.Delete(&models.CasbinRule{}).Error
+}
+
+// replace every rule in one transaction
+func (r *CasbinRuleRepository) ReplaceAll(rules []*models.CasbinRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.CasbinRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rules, 100).Error
+	})
+}
+
+// all rules
+func (r *CasbinRuleRepository) List() ([]*models.CasbinRule, error) {
+	var rules []*models.CasbinRule
+	err := r.db.Order("id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// count rules
+func (r *CasbinRuleRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.CasbinRule{}).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Department repository interface
+type IDepartmentRepository interface {
+	WithContext(ctx context.Context) IDepartmentRepository
+	Create(dept *models.Department, parentPath string) error
+	Update(dept *models.Department) error
+	Move(dept *models.Department, oldPath string) error
+	Delete(id uint64) error
+	FindById(id uint64) (*models.Department, error)
+	FindByIds(ids []uint64) ([]*models.Department, error)
+	FindByName(parentId *uint64, name string) (*models.Department, error)
+	List() ([]*models.Department, error)
+	CountChildren(id uint64) (int64, error)
+	CountUsers(id uint64) (int64, error)
+}
+
+// DepartmentRepository implements IDepartmentRepository
+type DepartmentRepository struct {
+	db *gorm.DB
+}
+
+// create DepartmentRepository
+func NewDepartmentRepository() *DepartmentRepository {
+	return &DepartmentRepository{
+		db: database.GetDB(),
+	}
+}
+
+// repository running its queries with ctx, a tenant scoped ctx restricts them to the tenant
+func (r *DepartmentRepository) WithContext(ctx context.Context) IDepartmentRepository {
+	return &DepartmentRepository{
+		db: r.db.WithContext(ctx),
+	}
+}
+
+// save department below the parent path, the path needs the new id so it is set in the same transaction
+func (r *DepartmentRepository) Create(dept *models.Department, parentPath string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dept).Error; err != nil {
+			return err
+		}
+		dept.Path = models.DepartmentPath(parentPath, dept.Id)
+		return tx.Model(dept).Update("path", dept.Path).Error
+	})
+}
+
+// update department, the path is changed by Move only
+func (r *DepartmentRepository) Update(dept *models.Department) error {
+	return r.db.Omit("path").Save(dept).Error
+}
+
+// save department under its new parent and rewrite the paths of its subtree
+func (r *DepartmentRepository) Move(dept *models.Department, oldPath string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("path").Save(dept).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Department{}).
+			Where("path LIKE ?", oldPath+"%").
+			Update("path", gorm.Expr("CONCAT(?, SUBSTRING(path, ?))", dept.Path, len(oldPath)+1)).Error
+	})
+}
+
+// delete department
+func (r *DepartmentRepository) Delete(id uint64) error {
+	return r.db.Delete(&models.Department{}, id).Error
+}
+
+// find department by id
+func (r *DepartmentRepository) FindById(id uint64) (*models.Department, error) {
+	var dept models.Department
+	err := r.db.First(&dept, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &dept, nil
+}
+
+// find departments by ids, missing ids are simply not returned
+func (r *DepartmentRepository) FindByIds(ids []uint64) ([]*models.Department, error) {
+	var depts []*models.Department
+	if len(ids) == 0 {
+		return depts, nil
+	}
+	err := r.db.Where("id IN ?", ids).Order("id ASC").Find(&depts).Error
+	return depts, err
+}
+
+// find a department by name among its siblings
+func (r *DepartmentRepository) FindByName(parentId *uint64, name string) (*models.Department, error) {
+	var dept models.Department
+	db := r.db.Where("name = ?", name)
+	if parentId == nil {
+		db = db.Where("parent_id IS NULL")
+	} else {
+		db = db.Where("parent_id = ?", *parentId)
+	}
+	if err := db.First(&dept).Error; err != nil {
+		return nil, err
+	}
+	return &dept, nil
+}
+
+// all departments, parents before children and siblings in order
+func (r *DepartmentRepository) List() ([]*models.Department, error) {
+	var depts []*models.Department
+	err := r.db.Order("LENGTH(path) ASC, sort ASC, id ASC").Find(&depts).Error
+	return depts, err
+}
+
+// count departments right below the department
+func (r *DepartmentRepository) CountChildren(id uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Department{}).Where("parent_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// count users of the department, including the ones outside the data scope of the caller
+func (r *DepartmentRepository) CountUsers(id uint64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(context.Background()).Model(&models.User{}).Where("department_id = ?", id).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Impersonation log repository interface
+type IImpersonationLogRepository interface {
+	Create(log *models.ImpersonationLog) error
+	ListByUser(userId uint64, page, pageSize int) ([]*models.ImpersonationLog, int64, error)
+}
+
+// ImpersonationLogRepository implements IImpersonationLogRepository
+type ImpersonationLogRepository struct {
+	db *gorm.DB
+}
+
+// create ImpersonationLogRepository
+func NewImpersonationLogRepository() *ImpersonationLogRepository {
+	return &ImpersonationLogRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save audit entry
+func (r *ImpersonationLogRepository) Create(log *models.ImpersonationLog) error {
+	return r.db.Create(log).Error
+}
+
+// audit entries of an impersonated user, newest first
+func (r *ImpersonationLogRepository) ListByUser(userId uint64, page, pageSize int) ([]*models.ImpersonationLog, int64, error) {
+	var logs []*models.ImpersonationLog
+	var total int64
+	query := r.db.Model(&models.ImpersonationLog{}).Where("user_id = ?", userId)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&logs).Error
+	return logs, total, err
+}
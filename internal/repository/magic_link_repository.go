@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Magic link repository interface
+type IMagicLinkRepository interface {
+	Create(link *models.MagicLink) error
+	FindByHash(tokenHash string) (*models.MagicLink, error)
+	MarkUsed(id uint64) (bool, error)
+	InvalidateByUser(userId uint64) error
+}
+
+// MagicLinkRepository implements IMagicLinkRepository
+type MagicLinkRepository struct {
+	db *gorm.DB
+}
+
+// create MagicLinkRepository
+func NewMagicLinkRepository() *MagicLinkRepository {
+	return &MagicLinkRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save login link
+func (r *MagicLinkRepository) Create(link *models.MagicLink) error {
+	return r.db.Create(link).Error
+}
+
+// find login link by hash
+func (r *MagicLinkRepository) FindByHash(tokenHash string) (*models.MagicLink, error) {
+	var link models.MagicLink
+	err := r.db.Where("token_hash = ?", tokenHash).First(&link).Error
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// mark link used, false means it was already used
+func (r *MagicLinkRepository) MarkUsed(id uint64) (bool, error) {
+	result := r.db.Model(&models.MagicLink{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// invalidate every unused link of a user
+func (r *MagicLinkRepository) InvalidateByUser(userId uint64) error {
+	return r.db.Model(&models.MagicLink{}).
+		Where("user_id = ? AND used_at IS NULL", userId).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Mfa recovery code repository interface
+type IMfaRecoveryCodeRepository interface {
+	ReplaceForUser(userId uint64, codeHashes []string) error
+	DeleteByUser(userId uint64) error
+	UseCode(userId uint64, codeHash string) (bool, error)
+	CountUnused(userId uint64) (int64, error)
+}
+
+// MfaRecoveryCodeRepository implements IMfaRecoveryCodeRepository
+type MfaRecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+// create MfaRecoveryCodeRepository
+func NewMfaRecoveryCodeRepository() *MfaRecoveryCodeRepository {
+	return &MfaRecoveryCodeRepository{
+		db: database.GetDB(),
+	}
+}
+
+// replace all recovery codes of a user
+func (r *MfaRecoveryCodeRepository) ReplaceForUser(userId uint64, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userId).Delete(&models.MfaRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]*models.MfaRecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, &models.MfaRecoveryCode{UserId: userId, CodeHash: hash})
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// delete all recovery codes of a user
+func (r *MfaRecoveryCodeRepository) DeleteByUser(userId uint64) error {
+	return r.db.Unscoped().Where("user_id = ?", userId).Delete(&models.MfaRecoveryCode{}).Error
+}
+
+// consume an unused recovery code, false if no such code
+func (r *MfaRecoveryCodeRepository) UseCode(userId uint64, codeHash string) (bool, error) {
+	result := r.db.Model(&models.MfaRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Limit(1).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// count unused recovery codes
+func (r *MfaRecoveryCodeRepository) CountUnused(userId uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.MfaRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userId).
+		Count(&count).Error
+	return count, err
+}
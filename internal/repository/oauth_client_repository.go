@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// OAuth client repository interface
+type IOAuthClientRepository interface {
+	Create(client *models.OAuthClient) error
+	Update(client *models.OAuthClient) error
+	Delete(id uint64) error
+	FindById(id uint64) (*models.OAuthClient, error)
+	FindByClientId(clientId string) (*models.OAuthClient, error)
+	List() ([]*models.OAuthClient, error)
+}
+
+// OAuthClientRepository implements IOAuthClientRepository
+type OAuthClientRepository struct {
+	db *gorm.DB
+}
+
+// create OAuthClientRepository
+func NewOAuthClientRepository() *OAuthClientRepository {
+	return &OAuthClientRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save client
+func (r *OAuthClientRepository) Create(client *models.OAuthClient) error {
+	return r.db.Create(client).Error
+}
+
+// update client
+func (r *OAuthClientRepository) Update(client *models.OAuthClient) error {
+	return r.db.Save(client).Error
+}
+
+// delete client
+func (r *OAuthClientRepository) Delete(id uint64) error {
+	return r.db.Delete(&models.OAuthClient{}, id).Error
+}
+
+// find client by id
+func (r *OAuthClientRepository) FindById(id uint64) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.db.First(&client, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// find client by its public client id
+func (r *OAuthClientRepository) FindByClientId(clientId string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.db.Where("client_id = ?", clientId).First(&client).Error
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// find all clients
+func (r *OAuthClientRepository) List() ([]*models.OAuthClient, error) {
+	var clients []*models.OAuthClient
+	err := r.db.Order("id ASC").Find(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
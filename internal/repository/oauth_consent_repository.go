@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"errors"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// OAuth consent repository interface
+type IOAuthConsentRepository interface {
+	Find(userId uint64, clientId string) (*models.OAuthConsent, error)
+	Grant(userId uint64, clientId string, scopes []string) error
+}
+
+// OAuthConsentRepository implements IOAuthConsentRepository
+type OAuthConsentRepository struct {
+	db *gorm.DB
+}
+
+// create OAuthConsentRepository
+func NewOAuthConsentRepository() *OAuthConsentRepository {
+	return &OAuthConsentRepository{
+		db: database.GetDB(),
+	}
+}
+
+// find the consent of a user for a client
+func (r *OAuthConsentRepository) Find(userId uint64, clientId string) (*models.OAuthConsent, error) {
+	var consent models.OAuthConsent
+	err := r.db.Where("user_id = ? AND client_id = ?", userId, clientId).First(&consent).Error
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// add scopes to the consent of a user for a client
+func (r *OAuthConsentRepository) Grant(userId uint64, clientId string, scopes []string) error {
+	consent, err := r.Find(userId, clientId)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		consent = &models.OAuthConsent{UserId: userId, ClientId: clientId}
+	}
+	for _, scope := range scopes {
+		consent.Scopes.AddPermission(scope)
+	}
+	return r.db.Save(consent).Error
+}
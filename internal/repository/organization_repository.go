@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Organization repository interface
+type IOrganizationRepository interface {
+	CreateWithRoles(org *models.Organization, roles []*models.Role) error
+	Update(org *models.Organization) error
+	FindById(id uint64) (*models.Organization, error)
+	FindByCode(code string) (*models.Organization, error)
+	FindByName(name string) (*models.Organization, error)
+	List() ([]*models.Organization, error)
+}
+
+// OrganizationRepository implements IOrganizationRepository
+type OrganizationRepository struct {
+	db *gorm.DB
+}
+
+// create OrganizationRepository
+func NewOrganizationRepository() *OrganizationRepository {
+	return &OrganizationRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save organization together with its initial roles
+func (r *OrganizationRepository) CreateWithRoles(org *models.Organization, roles []*models.Role) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			role.TenantId = org.Id
+		}
+		if len(roles) == 0 {
+			return nil
+		}
+		return tx.Omit("Parent").Create(&roles).Error
+	})
+}
+
+// update organization
+func (r *OrganizationRepository) Update(org *models.Organization) error {
+	return r.db.Save(org).Error
+}
+
+// find organization by id
+func (r *OrganizationRepository) FindById(id uint64) (*models.Organization, error) {
+	var org models.Organization
+	err := r.db.First(&org, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// find organization by code
+func (r *OrganizationRepository) FindByCode(code string) (*models.Organization, error) {
+	var org models.Organization
+	err := r.db.Where("code = ?", code).First(&org).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// find organization by name
+func (r *OrganizationRepository) FindByName(name string) (*models.Organization, error) {
+	var org models.Organization
+	err := r.db.Where("name = ?", name).First(&org).Error
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// all organizations
+func (r *OrganizationRepository) List() ([]*models.Organization, error) {
+	var orgs []*models.Organization
+	err := r.db.Order("id ASC").Find(&orgs).Error
+	return orgs, err
+}
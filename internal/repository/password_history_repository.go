@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Password history repository interface
+type IPasswordHistoryRepository interface {
+	Create(history *models.PasswordHistory) error
+	ListRecent(userId uint64, limit int) ([]*models.PasswordHistory, error)
+	Prune(userId uint64, keep int) error
+}
+
+// PasswordHistoryRepository implements IPasswordHistoryRepository
+type PasswordHistoryRepository struct {
+	db *gorm.DB
+}
+
+// create PasswordHistoryRepository
+func NewPasswordHistoryRepository() *PasswordHistoryRepository {
+	return &PasswordHistoryRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save a previous password
+func (r *PasswordHistoryRepository) Create(history *models.PasswordHistory) error {
+	return r.db.Create(history).Error
+}
+
+// newest previous passwords of a user
+func (r *PasswordHistoryRepository) ListRecent(userId uint64, limit int) ([]*models.PasswordHistory, error) {
+	var histories []*models.PasswordHistory
+	err := r.db.Where("user_id = ?", userId).
+		Order("id DESC").
+		Limit(limit).
+		Find(&histories).Error
+	return histories, err
+}
+
+// delete all but the newest previous passwords of a user
+func (r *PasswordHistoryRepository) Prune(userId uint64, keep int) error {
+	query := r.db.Unscoped().Where("user_id = ?", userId)
+	if keep > 0 {
+		kept, err := r.ListRecent(userId, keep)
+		if err != nil {
+			return err
+		}
+		if len(kept) < keep {
+			return nil
+		}
+		query = query.Where("id < ?", kept[len(kept)-1].Id)
+	}
+	return query.Delete(&models.PasswordHistory{}).Error
+}
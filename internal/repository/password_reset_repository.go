@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Password reset repository interface
+type IPasswordResetRepository interface {
+	Create(reset *models.PasswordReset) error
+	FindByHash(tokenHash string) (*models.PasswordReset, error)
+	MarkUsed(id uint64) (bool, error)
+	InvalidateByUser(userId uint64) error
+}
+
+// PasswordResetRepository implements IPasswordResetRepository
+type PasswordResetRepository struct {
+	db *gorm.DB
+}
+
+// create PasswordResetRepository
+func NewPasswordResetRepository() *PasswordResetRepository {
+	return &PasswordResetRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save reset token
+func (r *PasswordResetRepository) Create(reset *models.PasswordReset) error {
+	return r.db.Create(reset).Error
+}
+
+// find reset token by hash
+func (r *PasswordResetRepository) FindByHash(tokenHash string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := r.db.Where("token_hash = ?", tokenHash).First(&reset).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// mark token used, false means it was already used
+func (r *PasswordResetRepository) MarkUsed(id uint64) (bool, error) {
+	result := r.db.Model(&models.PasswordReset{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// invalidate every unused token of a user
+func (r *PasswordResetRepository) InvalidateByUser(userId uint64) error {
+	return r.db.Model(&models.PasswordReset{}).
+		Where("user_id = ? AND used_at IS NULL", userId).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Personal access token repository interface
+type IPersonalAccessTokenRepository interface {
+	Create(token *models.PersonalAccessToken) error
+	FindByHash(tokenHash string) (*models.PersonalAccessToken, error)
+	ListByUser(userId uint64) ([]*models.PersonalAccessToken, error)
+	Revoke(id, userId uint64) (bool, error)
+	TouchLastUsed(id uint64, interval time.Duration) error
+}
+
+// PersonalAccessTokenRepository implements IPersonalAccessTokenRepository
+type PersonalAccessTokenRepository struct {
+	db *gorm.DB
+}
+
+// create PersonalAccessTokenRepository
+func NewPersonalAccessTokenRepository() *PersonalAccessTokenRepository {
+	return &PersonalAccessTokenRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save token
+func (r *PersonalAccessTokenRepository) Create(token *models.PersonalAccessToken) error {
+	return r.db.Create(token).Error
+}
+
+// find token by hash
+func (r *PersonalAccessTokenRepository) FindByHash(tokenHash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// find tokens of a user, newest first
+func (r *PersonalAccessTokenRepository) ListByUser(userId uint64) ([]*models.PersonalAccessToken, error) {
+	var tokens []*models.PersonalAccessToken
+	err := r.db.Where("user_id = ?", userId).Order("id DESC").Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// revoke a token of the user, false if there is no such live token
+func (r *PersonalAccessTokenRepository) Revoke(id, userId uint64) (bool, error) {
+	result := r.db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userId).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// update last used time at most once per interval
+func (r *PersonalAccessTokenRepository) TouchLastUsed(id uint64, interval time.Duration) error {
+	now := time.Now()
+	return r.db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-interval)).
+		Update("last_used_at", now).Error
+}
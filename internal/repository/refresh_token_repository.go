@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Refresh token repository interface
+type IRefreshTokenRepository interface {
+	Create(token *models.RefreshToken) error
+	FindByHash(tokenHash string) (*models.RefreshToken, error)
+	MarkUsed(id uint64) (bool, error)
+	RevokeFamily(familyId string) error
+	RevokeByUser(userId uint64) error
+	RevokeByClient(clientId string) error
+}
+
+// RefreshTokenRepository implements IRefreshTokenRepository
+type RefreshTokenRepository struct {
+	db *gorm.DB
+}
+
+// create RefreshTokenRepository
+func NewRefreshTokenRepository() *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save refresh token
+func (r *RefreshTokenRepository) Create(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+// find refresh token by hash
+func (r *RefreshTokenRepository) FindByHash(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// mark token used, false means it was already used by a concurrent request
+func (r *RefreshTokenRepository) MarkUsed(id uint64) (bool, error) {
+	result := r.db.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// revoke every token of a family
+func (r *RefreshTokenRepository) RevokeFamily(familyId string) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyId).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revoke every token of a user
+func (r *RefreshTokenRepository) RevokeByUser(userId uint64) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userId).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revoke every token granted to an oauth client
+func (r *RefreshTokenRepository) RevokeByClient(clientId string) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("client_id = ? AND revoked_at IS NULL", clientId).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Role repository interface
+type IRoleRepository interface {
+	WithContext(ctx context.Context) IRoleRepository
+	Create(role *models.Role) error
+	Update(role *models.Role) error
+	Delete(id uint64) error
+	FindById(id uint64) (*models.Role, error)
+	FindByCode(code string) (*models.Role, error)
+	FindByName(name string) (*models.Role, error)
+	FindByIds(ids []uint64) ([]*models.Role, error)
+	List() ([]*models.Role, error)
+	CountUsers(id uint64) (int64, error)
+	ListUserIds(id uint64) ([]uint64, error)
+	CountChildren(id uint64) (int64, error)
+}
+
+// RoleRepository implements IRoleRepository
+type RoleRepository struct {
+	db *gorm.DB
+}
+
+// create RoleRepository
+func NewRoleRepository() *RoleRepository {
+	return &RoleRepository{
+		db: database.GetDB(),
+	}
+}
+
+// repository running its queries with ctx, a tenant scoped ctx restricts them to the tenant
+func (r *RoleRepository) WithContext(ctx context.Context) IRoleRepository {
+	return &RoleRepository{
+		db: r.db.WithContext(ctx),
+	}
+}
+
+// save role, the parent is set by ParentId
+func (r *RoleRepository) Create(role *models.Role) error {
+	return r.db.Omit("Parent").Create(role).Error
+}
+
+// update role, the parent is set by ParentId
+func (r *RoleRepository) Update(role *models.Role) error {
+	return r.db.Omit("Parent").Save(role).Error
+}
+
+// delete role
+func (r *RoleRepository) Delete(id uint64) error {
+	return r.db.Delete(&models.Role{}, id).Error
+}
+
+// find role by id
+func (r *RoleRepository) FindById(id uint64) (*models.Role, error) {
+	var role models.Role
+	err := r.db.First(&role, id).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := attachParents(r.db, []*models.Role{&role}); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// find role by code
+func (r *RoleRepository) FindByCode(code string) (*models.Role, error) {
+	var role models.Role
+	err := r.db.Where("code = ?", code).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := attachParents(r.db, []*models.Role{&role}); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// find role by name
+func (r *RoleRepository) FindByName(name string) (*models.Role, error) {
+	var role models.Role
+	err := r.db.Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// find roles by ids, missing ids are simply not returned
+func (r *RoleRepository) FindByIds(ids []uint64) ([]*models.Role, error) {
+	var roles []*models.Role
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	if err := r.db.Where("id IN ?", ids).Order("id ASC").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	if err := attachParents(r.db, roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// all roles
+func (r *RoleRepository) List() ([]*models.Role, error) {
+	var roles []*models.Role
+	err := r.db.Order("id ASC").Find(&roles).Error
+	return roles, err
+}
+
+// count users holding the role
+func (r *RoleRepository) CountUsers(id uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).
+		Joins("JOIN t_sys_user_roles ur ON ur.user_id = t_sys_users.id").
+		Where("ur.role_id = ?", id).
+		Count(&count).Error
+	return count, err
+}
+
+// ids of the users holding the role
+func (r *RoleRepository) ListUserIds(id uint64) ([]uint64, error) {
+	var userIds []uint64
+	err := r.db.Model(&models.User{}).
+		Joins("JOIN t_sys_user_roles ur ON ur.user_id = t_sys_users.id").
+		Where("ur.role_id = ?", id).
+		Pluck("t_sys_users.id", &userIds).Error
+	return userIds, err
+}
+
+// count roles inheriting from the role
+func (r *RoleRepository) CountChildren(id uint64) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Role{}).Where("parent_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// link the parent chain of the roles, roles are few so all of them are loaded at once
+func attachParents(db *gorm.DB, roles []*models.Role) error {
+	inherits := false
+	for _, role := range roles {
+		if role.ParentId != nil {
+			inherits = true
+			break
+		}
+	}
+	if !inherits {
+		return nil
+	}
+	var all []*models.Role
+	if err := db.Find(&all).Error; err != nil {
+		return err
+	}
+	byId := make(map[uint64]*models.Role, len(all))
+	for _, role := range all {
+		byId[role.Id] = role
+	}
+	for _, role := range all {
+		if role.ParentId != nil {
+			role.Parent = byId[*role.ParentId]
+		}
+	}
+	for _, role := range roles {
+		if role.ParentId != nil {
+			role.Parent = byId[*role.ParentId]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// Session repository interface
+type ISessionRepository interface {
+	Create(session *models.Session) error
+	FindById(id uint64) (*models.Session, error)
+	FindByFamilyId(familyId string) (*models.Session, error)
+	ListActiveByUser(userId uint64) ([]*models.Session, error)
+	Touch(familyId, ip string, expiresAt *time.Time) error
+	Revoke(familyId string) error
+	RevokeByUser(userId uint64) error
+}
+
+// SessionRepository implements ISessionRepository
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+// create SessionRepository
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save session
+func (r *SessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+// find session by id
+func (r *SessionRepository) FindById(id uint64) (*models.Session, error) {
+	var session models.Session
+	err := r.db.First(&session, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// find session by refresh token family
+func (r *SessionRepository) FindByFamilyId(familyId string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("family_id = ?", familyId).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// find live sessions of a user, most recently seen first
+func (r *SessionRepository) ListActiveByUser(userId uint64) ([]*models.Session, error) {
+	var sessions []*models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userId, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// update last seen time and ip, and the expiry when the refresh token rotated
+func (r *SessionRepository) Touch(familyId, ip string, expiresAt *time.Time) error {
+	updates := map[string]interface{}{
+		"last_seen_at": time.Now(),
+		"ip":           ip,
+	}
+	if expiresAt != nil {
+		updates["expires_at"] = *expiresAt
+	}
+	return r.db.Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyId).
+		Updates(updates).Error
+}
+
+// revoke a session
+func (r *SessionRepository) Revoke(familyId string) error {
+	return r.db.Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyId).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revoke every session of a user
+func (r *SessionRepository) RevokeByUser(userId uint64) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userId).
+		Update("revoked_at", time.Now()).Error
+}
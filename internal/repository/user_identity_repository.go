@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/database"
+	"gorm.io/gorm"
+)
+
+// User identity repository interface
+type IUserIdentityRepository interface {
+	Create(identity *models.UserIdentity) error
+	FindBySubject(provider, subject string) (*models.UserIdentity, error)
+	ListByUser(userId uint64) ([]*models.UserIdentity, error)
+	TouchLogin(id uint64, email string) error
+}
+
+// UserIdentityRepository implements IUserIdentityRepository
+type UserIdentityRepository struct {
+	db *gorm.DB
+}
+
+// create UserIdentityRepository
+func NewUserIdentityRepository() *UserIdentityRepository {
+	return &UserIdentityRepository{
+		db: database.GetDB(),
+	}
+}
+
+// save identity
+func (r *UserIdentityRepository) Create(identity *models.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+// find identity by provider subject
+func (r *UserIdentityRepository) FindBySubject(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// find identities of a user
+func (r *UserIdentityRepository) ListByUser(userId uint64) ([]*models.UserIdentity, error) {
+	var identities []*models.UserIdentity
+	err := r.db.Where("user_id = ?", userId).Order("id ASC").Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// update last login time and the email seen at the provider
+func (r *UserIdentityRepository) TouchLogin(id uint64, email string) error {
+	return r.db.Model(&models.UserIdentity{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"last_login_at": time.Now(),
+			"email":         email,
+		}).Error
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"context"
+
 	"bpf.com/internal/models"
 	"bpf.com/pkg/database"
 	"gorm.io/gorm"
@@ -8,8 +10,11 @@ import (
 
 // User repository interface
 type IUserRepository interface {
+	WithContext(ctx context.Context) IUserRepository
 	Create(user *models.User) error
 	Update(user *models.User) error
+	UpdatePassword(user *models.User, previous *models.PasswordHistory, keep int) error
+	ReplaceRoles(user *models.User, roles []*models.Role) error
 	Delete(id uint64) error
 	FindById(id uint64) (*models.User, error)
 	FindByUsername(username string) (*models.User, error)
@@ -29,14 +34,48 @@ func NewUserRepository() *UserRepository {
 	}
 }
 
-// save user
+// repository running its queries with ctx, a tenant scoped ctx restricts them to the tenant
+func (r *UserRepository) WithContext(ctx context.Context) IUserRepository {
+	return &UserRepository{
+		db: r.db.WithContext(ctx),
+	}
+}
+
+// save user with the links to its existing roles
 func (r *UserRepository) Create(user *models.User) error {
-	return r.db.Create(user).Error
+	return r.db.Omit("Roles.*").Create(user).Error
 }
 
-// update user
+// update user, roles are changed by ReplaceRoles only
 func (r *UserRepository) Update(user *models.User) error {
-	return r.db.Save(user).Error
+	return r.db.Omit("Roles").Save(user).Error
+}
+
+// update user and move the previous password to the history keeping the newest keep
+// entries, in one transaction. A nil previous only updates the user
+func (r *UserRepository) UpdatePassword(user *models.User, previous *models.PasswordHistory, keep int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Roles").Save(user).Error; err != nil {
+			return err
+		}
+		if previous == nil {
+			return nil
+		}
+		historyRepo := &PasswordHistoryRepository{db: tx}
+		if err := historyRepo.Create(previous); err != nil {
+			return err
+		}
+		return historyRepo.Prune(user.Id, keep)
+	})
+}
+
+// replace the roles of a user
+func (r *UserRepository) ReplaceRoles(user *models.User, roles []*models.Role) error {
+	if err := r.db.Model(user).Association("Roles").Replace(roles); err != nil {
+		return err
+	}
+	user.Roles = roles
+	return attachParents(r.db, user.Roles)
 }
 
 // delete user
@@ -47,30 +86,39 @@ func (r *UserRepository) Delete(id uint64) error {
 // find user by id
 func (r *UserRepository) FindById(id uint64) (*models.User, error) {
 	var user models.User
-	err := r.db.Preload("Role").First(&user, id).Error
+	err := r.db.Preload("Roles").First(&user, id).Error
 	if err != nil {
 		return nil, err
 	}
+	if err := attachParents(r.db, user.Roles); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
 // find user by username
 func (r *UserRepository) FindByUsername(username string) (*models.User, error) {
 	var user models.User
-	err := r.db.Preload("Role").Where("username = ?", username).First(&user).Error
+	err := r.db.Preload("Roles").Where("username = ?", username).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
+	if err := attachParents(r.db, user.Roles); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
 // find user by email
 func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
 	var user models.User
-	err := r.db.Preload("Role").Where("email = ?", email).First(&user).Error
+	err := r.db.Preload("Roles").Where("email = ?", email).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
+	if err := attachParents(r.db, user.Roles); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
@@ -79,7 +127,7 @@ func (r *UserRepository) List(page, size int, query string) ([]*models.User, int
 	var users []*models.User
 	var total int64
 
-	db := r.db.Model(&models.User{}).Preload("Role")
+	db := r.db.Model(&models.User{}).Preload("Roles")
 
 	//add query params
 	if query != "" {
@@ -1,32 +1,95 @@
 package services
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"time"
 
 	"bpf.com/internal/models"
 	"bpf.com/internal/repository"
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/logger"
+	"bpf.com/pkg/mailer"
+	"bpf.com/pkg/tenant"
 	"bpf.com/pkg/utils"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 // user auth interface
 type IAuthService interface {
 	Register(username, password, email, nickname string) (*models.User, error)
-	Login(username, password string) (string, string, *models.User, error)
-	RefreshToken(refreshtoken string) (string, error)
+	Login(username, password string, client ClientInfo) (*LoginResult, error)
+	VerifyMfa(mfaToken, code string, client ClientInfo) (*LoginResult, error)
+	ExternalLogin(user *models.User, client ClientInfo) (*LoginResult, error)
+	BeginMfaEnrollment(mfaToken string) (*MfaEnrollment, error)
+	ChangeExpiredPassword(passwordToken, newPassword string, client ClientInfo) (*LoginResult, error)
+	RefreshToken(refreshtoken string, client ClientInfo) (string, string, error)
 	VerifyToken(token string) (*models.User, error)
 	ChangePassword(userId uint64, oldPassword, newPassword string) error
+	Logout(claims *utils.JWTClaims, refreshToken string) error
+	LogoutAll(userId uint64) error
+	ForgotPassword(email, requestIp string) error
+	ResetPassword(token, newPassword string) error
+	SendMagicLink(email, requestIp string) (string, error)
+	MagicLinkLogin(token, nonce string, client ClientInfo) (*LoginResult, error)
+	VerifyEmail(token string) error
+	ResendVerification(email string) error
+	ChangeEmail(userId uint64, password, newEmail string) error
+}
+
+// one error for unknown usernames and wrong passwords so usernames are not revealed
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// login result, tokens are empty while the second factor or a password change is pending
+type LoginResult struct {
+	AccessToken     string
+	RefreshToken    string
+	User            *models.User
+	MfaRequired     bool
+	MfaEnroll       bool
+	MfaToken        string
+	RecoveryCodes   []string
+	PasswordExpired bool
+	PasswordToken   string
 }
 
 // auth implements
 type AuthService struct {
-	userRepo repository.IUserRepository
+	userRepo         repository.IUserRepository
+	refreshTokenRepo repository.IRefreshTokenRepository
+	resetRepo        repository.IPasswordResetRepository
+	magicLinkRepo    repository.IMagicLinkRepository
+	roleRepo         repository.IRoleRepository
+	principalService IPrincipalService
+	tokenService     ITokenService
+	mfaService       IMfaService
+	verifyService    IEmailVerificationService
+	loginGuard       ILoginGuardService
+	sessionService   ISessionService
+	passwordPolicy   IPasswordPolicyService
+	authenticators   []Authenticator
 }
 
 // create new AuthService
 func NewAuthService() IAuthService {
 	return &AuthService{
-		userRepo: repository.NewUserRepository(),
+		userRepo:         repository.NewUserRepository(),
+		refreshTokenRepo: repository.NewRefreshTokenRepository(),
+		resetRepo:        repository.NewPasswordResetRepository(),
+		magicLinkRepo:    repository.NewMagicLinkRepository(),
+		roleRepo:         repository.NewRoleRepository(),
+		principalService: NewPrincipalService(),
+		tokenService:     NewTokenService(),
+		mfaService:       NewMfaService(),
+		verifyService:    NewEmailVerificationService(),
+		loginGuard:       NewLoginGuardService(),
+		sessionService:   NewSessionService(),
+		passwordPolicy:   NewPasswordPolicyService(),
+		authenticators:   newAuthenticatorChain(),
 	}
 }
 
@@ -43,80 +106,429 @@ func (s *AuthService) Register(username, password, email, nickname string) (*mod
 		return nil, errors.New("email already exists")
 	}
 
+	roles, err := defaultRoles(s.roleRepo, tenant.Default)
+	if err != nil {
+		return nil, err
+	}
 	user := &models.User{
 		Username: username,
 		Email:    email,
 		Nickname: nickname,
-		RoleId:   2,
+		Roles:    roles,
 		Status:   models.StatusActive,
 	}
 	//set password
-	if err := user.SetPassword(password); err != nil {
+	if err := s.passwordPolicy.SetPassword(user, password); err != nil {
 		return nil, err
 	}
 	//save user
 	if err := s.userRepo.Create(user); err != nil {
 		return nil, err
 	}
+	syncCasbinUser(user.Id, user.TenantId, roles)
+	//prove the email belongs to the user
+	if err := s.verifyService.SendVerification(user); err != nil {
+		return nil, err
+	}
 	return user, nil
 }
 
 // Login
-func (s *AuthService) Login(username, password string) (string, string, *models.User, error) {
-	user, err := s.userRepo.FindByUsername(username)
+func (s *AuthService) Login(username, password string, client ClientInfo) (*LoginResult, error) {
+	//locked or backing off after failures
+	if err := s.loginGuard.Check(username, client.Ip); err != nil {
+		return nil, err
+	}
+	//check password against the backends of the chain
+	user, err := authenticateChain(s.authenticators, username, password)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", "", nil, errors.New("user does not exist")
+		if errors.Is(err, ErrInvalidCredentials) {
+			s.recordLoginFailure(username, client.Ip)
 		}
-		return "", "", nil, err
+		return nil, err
 	}
 	//check user status
 	if !user.IsActive() {
-		return "", "", nil, errors.New("user disabled")
+		return nil, errors.New("user disabled")
 	}
-	//check password
-	if !user.CheckPassword(password) {
-		return "", "", nil, errors.New("password error")
+	//an expired password has to be replaced before any token is issued,
+	//after the second factor so the password alone can not replace it
+	if s.passwordPolicy.IsExpired(user) {
+		if user.MfaEnabled {
+			mfaToken, err := s.createMfaPending(user.Id)
+			if err != nil {
+				return nil, err
+			}
+			err = cache.GetGlobalCache().Set(context.Background(), mfaPasswordExpiredKey(mfaToken), true, mfaPendingExp())
+			if err != nil {
+				return nil, err
+			}
+			return &LoginResult{
+				User:        user,
+				MfaRequired: true,
+				MfaToken:    mfaToken,
+			}, nil
+		}
+		passwordToken, err := s.createPasswordChangePending(user.Id, false)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{
+			User:            user,
+			PasswordExpired: true,
+			PasswordToken:   passwordToken,
+		}, nil
 	}
+	return s.continueLogin(user, client)
+}
 
+// replace an expired password with the token of the login, then finish the login
+func (s *AuthService) ChangeExpiredPassword(passwordToken, newPassword string, client ClientInfo) (*LoginResult, error) {
+	ctx := context.Background()
+	key := passwordChangePendingKey(passwordToken)
+	var userId uint64
+	if err := cache.GetGlobalCache().Get(ctx, key, &userId); err != nil {
+		return nil, errors.New("invalid or expired password token")
+	}
+	user, err := s.userRepo.FindById(userId)
+	if err != nil {
+		return nil, errors.New("user does not exist")
+	}
+	if !user.IsActive() {
+		return nil, errors.New("user disabled")
+	}
+	mfaPassed, err := cache.GetGlobalCache().Exists(ctx, key+":mfa")
+	if err != nil {
+		return nil, err
+	}
+	previous := user.Password
+	if err := s.passwordPolicy.SetPassword(user, newPassword); err != nil {
+		return nil, err
+	}
+	if err := s.passwordPolicy.SavePassword(user, previous); err != nil {
+		return nil, err
+	}
+	cache.GetGlobalCache().Delete(ctx, key)
+	cache.GetGlobalCache().Delete(ctx, key+":mfa")
+	if err := s.tokenService.RevokeUserTokens(user.Id); err != nil {
+		return nil, err
+	}
+	waitRevocationCutoff()
+	//the second factor was checked before the password token was issued
+	if mfaPassed {
+		if !s.verifyService.CanLogin(user) {
+			return nil, errors.New("email not verified")
+		}
+		return s.completeLogin(user, client)
+	}
+	return s.continueLogin(user, client)
+}
+
+// password change pending key
+func passwordChangePendingKey(passwordToken string) string {
+	return "password-change:" + utils.HashToken(passwordToken)
+}
+
+// store a short lived token allowing only the change of an expired password,
+// mfaPassed marks a token issued after the second factor
+func (s *AuthService) createPasswordChangePending(userId uint64, mfaPassed bool) (string, error) {
+	passwordToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	exp := config.GetAppConfig().Password.ChangeTokenExp
+	if exp <= 0 {
+		exp = 10
+	}
+	key := passwordChangePendingKey(passwordToken)
+	if err := cache.GetGlobalCache().Set(context.Background(), key, userId, time.Duration(exp)*time.Minute); err != nil {
+		return "", err
+	}
+	if mfaPassed {
+		if err := cache.GetGlobalCache().Set(context.Background(), key+":mfa", true, time.Duration(exp)*time.Minute); err != nil {
+			return "", err
+		}
+	}
+	return passwordToken, nil
+}
+
+// login of a user authenticated by an external identity provider
+func (s *AuthService) ExternalLogin(user *models.User, client ClientInfo) (*LoginResult, error) {
+	if !user.IsActive() {
+		return nil, errors.New("user disabled")
+	}
+	return s.continueLogin(user, client)
+}
+
+// checks shared by every first factor, then the second factor or the token pair
+func (s *AuthService) continueLogin(user *models.User, client ClientInfo) (*LoginResult, error) {
+	if !s.verifyService.CanLogin(user) {
+		return nil, errors.New("email not verified")
+	}
+	//second factor, or enrollment when the role requires it
+	if user.MfaEnabled || s.mfaService.IsRequired(user) {
+		mfaToken, err := s.createMfaPending(user.Id)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{
+			User:        user,
+			MfaRequired: true,
+			MfaEnroll:   !user.MfaEnabled,
+			MfaToken:    mfaToken,
+		}, nil
+	}
+	return s.completeLogin(user, client)
+}
+
+// exchange the mfa pending token and a totp or recovery code for tokens
+func (s *AuthService) VerifyMfa(mfaToken, code string, client ClientInfo) (*LoginResult, error) {
+	user, err := s.loadMfaPending(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	//the second factor shares the lockout of the password
+	if err := s.loginGuard.Check(user.Username, client.Ip); err != nil {
+		return nil, err
+	}
+	var recoveryCodes []string
+	if user.MfaEnabled {
+		ok, err := s.mfaService.VerifyCode(user, code)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			s.recordLoginFailure(user.Username, client.Ip)
+			return nil, errors.New("invalid 2fa code")
+		}
+	} else {
+		//first code confirms the enrollment required by the role
+		recoveryCodes, err = s.mfaService.Enable(user, code)
+		if err != nil {
+			return nil, err
+		}
+	}
+	passwordExpired, err := cache.GetGlobalCache().Exists(context.Background(), mfaPasswordExpiredKey(mfaToken))
+	if err != nil {
+		return nil, err
+	}
+	s.deleteMfaPending(mfaToken)
+	cache.GetGlobalCache().Delete(context.Background(), mfaAttemptsKey(user.Id))
+	//the expired password is replaced before any token is issued
+	if passwordExpired {
+		passwordToken, err := s.createPasswordChangePending(user.Id, true)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{
+			User:            user,
+			PasswordExpired: true,
+			PasswordToken:   passwordToken,
+		}, nil
+	}
+	result, err := s.completeLogin(user, client)
+	if err != nil {
+		return nil, err
+	}
+	result.RecoveryCodes = recoveryCodes
+	return result, nil
+}
+
+// start the enrollment of a user whose role requires 2fa during login
+func (s *AuthService) BeginMfaEnrollment(mfaToken string) (*MfaEnrollment, error) {
+	user, err := s.loadMfaPending(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.mfaService.BeginEnrollment(user)
+}
+
+// update last login, start a session and issue its token pair
+func (s *AuthService) completeLogin(user *models.User, client ClientInfo) (*LoginResult, error) {
+	//failures are only forgotten once every factor passed
+	if err := s.loginGuard.RecordSuccess(user.Username); err != nil {
+		logger.GetLogger().Error("reset login failures fail", zap.Error(err))
+	}
 	//update lastedLogin time
 	user.UpdateLastLogin()
+	//a new login starts from the current roles
+	s.principalService.Invalidate(user.Id)
 	if err := s.userRepo.Update(user); err != nil {
-		return "", "", nil, err
+		return nil, err
+	}
+
+	//the refresh token family is the session
+	familyId, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, expiresAt, err := s.issueRefreshToken(user.Id, familyId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessionService.Create(user.Id, familyId, client, expiresAt); err != nil {
+		return nil, err
+	}
+	accessToken, err := utils.GenerateAccessToken(user.Id, user.TenantId, familyId, user.RoleCodes())
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+// count a failed login, errors only get logged
+func (s *AuthService) recordLoginFailure(username, clientIp string) {
+	if err := s.loginGuard.RecordFailure(username, clientIp); err != nil {
+		logger.GetLogger().Error("record login failure fail", zap.Error(err))
+	}
+}
+
+// lifetime of an mfa pending token
+func mfaPendingExp() time.Duration {
+	exp := config.GetAppConfig().Mfa.PendingTokenExp
+	if exp <= 0 {
+		exp = 5
+	}
+	return time.Duration(exp) * time.Minute
+}
+
+// mfa pending key
+func mfaPendingKey(mfaToken string) string {
+	return "mfa-pending:" + utils.HashToken(mfaToken)
+}
+
+// marks an mfa pending token whose password has to be replaced after the second factor
+func mfaPasswordExpiredKey(mfaToken string) string {
+	return "mfa-password-expired:" + utils.HashToken(mfaToken)
+}
+
+// 2fa attempts of a user, a new login does not start a new budget
+func mfaAttemptsKey(userId uint64) string {
+	return fmt.Sprintf("mfa-attempts:%d", userId)
+}
+
+// store a short lived mfa pending token
+func (s *AuthService) createMfaPending(userId uint64) (string, error) {
+	mfaToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
 	}
+	err = cache.GetGlobalCache().Set(context.Background(), mfaPendingKey(mfaToken), userId, mfaPendingExp())
+	if err != nil {
+		return "", err
+	}
+	return mfaToken, nil
+}
 
-	//create accessToken and refreshToken
-	accessToken, err := utils.GenerateAccessToken(user.Id)
+// load the user of an mfa pending token, counting every attempt of the user
+func (s *AuthService) loadMfaPending(mfaToken string) (*models.User, error) {
+	ctx := context.Background()
+	var userId uint64
+	if err := cache.GetGlobalCache().Get(ctx, mfaPendingKey(mfaToken), &userId); err != nil {
+		return nil, errors.New("invalid or expired mfa token")
+	}
+	attempts, err := cache.GetGlobalCache().Incr(ctx, mfaAttemptsKey(userId), mfaPendingExp())
 	if err != nil {
-		return "", "", nil, err
+		return nil, err
+	}
+	maxAttempts := config.GetAppConfig().Mfa.MaxAttempts
+	if maxAttempts > 0 && attempts > int64(maxAttempts) {
+		s.deleteMfaPending(mfaToken)
+		return nil, errors.New("too many 2fa attempts, please try again later")
 	}
-	refreshToken, err := utils.GenerateRefreshToken(user.Id)
+	user, err := s.userRepo.FindById(userId)
 	if err != nil {
-		return "", "", nil, err
+		return nil, errors.New("user does not exist")
+	}
+	if !user.IsActive() {
+		return nil, errors.New("user disabled")
 	}
-	return accessToken, refreshToken, user, nil
+	return user, nil
+}
+
+// remove an mfa pending token
+func (s *AuthService) deleteMfaPending(mfaToken string) {
+	cache.GetGlobalCache().Delete(context.Background(), mfaPendingKey(mfaToken))
+	cache.GetGlobalCache().Delete(context.Background(), mfaPasswordExpiredKey(mfaToken))
 }
 
-// refresh token
-func (s *AuthService) RefreshToken(refreshtoken string) (string, error) {
-	claims, err := utils.ParseRefreshToken(refreshtoken)
+// refresh token, rotates the presented token and detects reuse
+func (s *AuthService) RefreshToken(refreshtoken string, client ClientInfo) (string, string, error) {
+	stored, err := s.refreshTokenRepo.FindByHash(utils.HashToken(refreshtoken))
+	if err != nil {
+		return "", "", errors.New("invalid refresh token")
+	}
+	//tokens granted to oauth clients rotate at the oauth token endpoint
+	if stored.IsRevoked() || stored.IsExpired() || stored.ClientId != "" {
+		return "", "", errors.New("invalid refresh token")
+	}
+	//a used token presented again means it leaked, kill the whole family
+	if stored.IsUsed() {
+		s.revokeFamily(stored, "refresh token reuse detected")
+		return "", "", errors.New("invalid refresh token")
+	}
+	marked, err := s.refreshTokenRepo.MarkUsed(stored.Id)
 	if err != nil {
-		return "", errors.New("invalid refresh token")
+		return "", "", err
+	}
+	if !marked {
+		s.revokeFamily(stored, "concurrent refresh token reuse detected")
+		return "", "", errors.New("invalid refresh token")
 	}
 	//check user
-	user, err := s.userRepo.FindById(claims.UserId)
+	user, err := s.userRepo.FindById(stored.UserId)
 	if err != nil {
-		return "", errors.New("user does not exist")
+		return "", "", errors.New("user does not exist")
 	}
 	if !user.IsActive() {
-		return "", errors.New("user disabled")
+		return "", "", errors.New("user disabled")
 	}
-	//generate new token
-	accessToken, err := utils.GenerateAccessToken(user.Id)
+	//generate new token pair in the same family
+	refreshToken, expiresAt, err := s.issueRefreshToken(user.Id, stored.FamilyId)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	if err := s.sessionService.Rotated(stored.FamilyId, client, expiresAt); err != nil {
+		return "", "", err
+	}
+	accessToken, err := utils.GenerateAccessToken(user.Id, user.TenantId, stored.FamilyId, user.RoleCodes())
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// create and save a refresh token for the family
+func (s *AuthService) issueRefreshToken(userId uint64, familyId string) (string, time.Time, error) {
+	token, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	cfg := config.GetAppConfig().JWT
+	record := &models.RefreshToken{
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Duration(cfg.RefreshTokenExp) * time.Minute),
+	}
+	if err := s.refreshTokenRepo.Create(record); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, record.ExpiresAt, nil
+}
+
+// revoke a token family and log the reason
+func (s *AuthService) revokeFamily(token *models.RefreshToken, reason string) {
+	logger.GetLogger().Warn(reason,
+		zap.Uint64("userId", token.UserId),
+		zap.String("familyId", token.FamilyId))
+	if err := s.sessionService.RevokeFamily(token.FamilyId); err != nil {
+		logger.GetLogger().Error("revoke refresh token family fail", zap.Error(err))
 	}
-	return accessToken, nil
 }
 
 // verify token
@@ -141,11 +553,233 @@ func (s *AuthService) ChangePassword(userID uint64, oldPassword, newPassword str
 	if err != nil {
 		return errors.New("user does not exist")
 	}
-	if user.CheckPassword(oldPassword) {
+	if !user.IsLocal() {
+		return errors.New("password is managed by the directory")
+	}
+	if !user.CheckPassword(oldPassword) {
 		return errors.New("old password error")
 	}
-	if err := user.SetPassword(newPassword); err != nil {
+	previous := user.Password
+	if err := s.passwordPolicy.SetPassword(user, newPassword); err != nil {
 		return err
 	}
-	return s.userRepo.Update(user)
+	if err := s.passwordPolicy.SavePassword(user, previous); err != nil {
+		return err
+	}
+	return s.tokenService.RevokeUserTokens(user.Id)
+}
+
+// logout this device
+func (s *AuthService) Logout(claims *utils.JWTClaims, refreshToken string) error {
+	if claims.SessionId != "" {
+		if err := s.sessionService.RevokeFamily(claims.SessionId); err != nil {
+			return err
+		}
+	} else if refreshToken != "" {
+		if err := s.tokenService.RevokeRefreshFamily(claims.UserId, refreshToken); err != nil {
+			return err
+		}
+	}
+	return s.tokenService.RevokeAccessToken(claims)
+}
+
+// logout all devices
+func (s *AuthService) LogoutAll(userId uint64) error {
+	return s.tokenService.RevokeUserTokens(userId)
+}
+
+// send a password reset link, unknown emails succeed silently so they are not revealed
+func (s *AuthService) ForgotPassword(email, requestIp string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !user.IsActive() || !user.IsLocal() {
+		return nil
+	}
+	//only the newest link works
+	if err := s.resetRepo.InvalidateByUser(user.Id); err != nil {
+		return err
+	}
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	exp := config.GetAppConfig().Auth.PasswordResetExp
+	if exp <= 0 {
+		exp = 30
+	}
+	reset := &models.PasswordReset{
+		UserId:    user.Id,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Duration(exp) * time.Minute),
+		RequestIp: requestIp,
+	}
+	if err := s.resetRepo.Create(reset); err != nil {
+		return err
+	}
+	mailer.SendTemplateAsync(user.Email, "password_reset", "Reset your password", map[string]interface{}{
+		"Name":      user.Nickname,
+		"Link":      config.GetAppConfig().Server.PublicUrl + "/reset-password?token=" + token,
+		"ExpiresIn": int64(exp),
+	})
+	return nil
+}
+
+// set a new password with a reset token, every session of the user ends
+func (s *AuthService) ResetPassword(token, newPassword string) error {
+	reset, err := s.resetRepo.FindByHash(utils.HashToken(token))
+	if err != nil || !reset.IsValid() {
+		return errors.New("invalid or expired reset token")
+	}
+	user, err := s.userRepo.FindById(reset.UserId)
+	if err != nil {
+		return errors.New("user does not exist")
+	}
+	if !user.IsLocal() {
+		return errors.New("password is managed by the directory")
+	}
+	//a password refused by the policy keeps the link usable
+	previous := user.Password
+	if err := s.passwordPolicy.SetPassword(user, newPassword); err != nil {
+		return err
+	}
+	marked, err := s.resetRepo.MarkUsed(reset.Id)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		return errors.New("invalid or expired reset token")
+	}
+	if err := s.passwordPolicy.SavePassword(user, previous); err != nil {
+		return err
+	}
+	if err := s.resetRepo.InvalidateByUser(user.Id); err != nil {
+		return err
+	}
+	return s.tokenService.RevokeUserTokens(user.Id)
+}
+
+// lifetime of a magic login link and its nonce cookie
+func MagicLinkExp() time.Duration {
+	exp := config.GetAppConfig().Auth.MagicLinkExp
+	if exp <= 0 {
+		exp = 15
+	}
+	return time.Duration(exp) * time.Minute
+}
+
+// magic links are for local users holding a role that allows them
+func (s *AuthService) magicLinkAllowed(user *models.User) bool {
+	if !user.IsActive() || !user.IsLocal() {
+		return false
+	}
+	for _, role := range user.Roles {
+		if role.MagicLinkEnabled {
+			return true
+		}
+	}
+	return false
+}
+
+// email a single-use login link, the returned nonce goes to the browser
+// and must come back with the link. Unknown emails and users whose role
+// does not allow magic links succeed silently so they are not revealed
+func (s *AuthService) SendMagicLink(email, requestIp string) (string, error) {
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nonce, nil
+		}
+		return "", err
+	}
+	if !s.magicLinkAllowed(user) {
+		return nonce, nil
+	}
+	//only the newest link works
+	if err := s.magicLinkRepo.InvalidateByUser(user.Id); err != nil {
+		return "", err
+	}
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	exp := MagicLinkExp()
+	link := &models.MagicLink{
+		UserId:    user.Id,
+		TokenHash: utils.HashToken(token),
+		NonceHash: utils.HashToken(nonce),
+		ExpiresAt: time.Now().Add(exp),
+		RequestIp: requestIp,
+	}
+	if err := s.magicLinkRepo.Create(link); err != nil {
+		return "", err
+	}
+	mailer.SendTemplateAsync(user.Email, "magic_link", "Your login link", map[string]interface{}{
+		"Name":      user.Nickname,
+		"Link":      config.GetAppConfig().Server.PublicUrl + "/magic-link?token=" + token,
+		"ExpiresIn": int64(exp / time.Minute),
+	})
+	return nonce, nil
+}
+
+// exchange a magic link for the normal login result, only in the browser holding the nonce
+func (s *AuthService) MagicLinkLogin(token, nonce string, client ClientInfo) (*LoginResult, error) {
+	link, err := s.magicLinkRepo.FindByHash(utils.HashToken(token))
+	if err != nil || !link.IsValid() {
+		return nil, errors.New("invalid or expired login link")
+	}
+	//a link opened in another browser stays usable for the one that asked for it
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(nonce)), []byte(link.NonceHash)) != 1 {
+		return nil, errors.New("login link was requested from another browser")
+	}
+	marked, err := s.magicLinkRepo.MarkUsed(link.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, errors.New("invalid or expired login link")
+	}
+	user, err := s.userRepo.FindById(link.UserId)
+	if err != nil {
+		return nil, errors.New("user does not exist")
+	}
+	//the role may have lost the switch since the link was sent
+	if !s.magicLinkAllowed(user) {
+		return nil, errors.New("magic link login is not enabled")
+	}
+	return s.continueLogin(user, client)
+}
+
+// verify email by a signed link
+func (s *AuthService) VerifyEmail(token string) error {
+	_, err := s.verifyService.Verify(token)
+	return err
+}
+
+// resend the verification link
+func (s *AuthService) ResendVerification(email string) error {
+	return s.verifyService.Resend(email)
+}
+
+// change the email of the current user once the new address is verified
+func (s *AuthService) ChangeEmail(userId uint64, password, newEmail string) error {
+	user, err := s.userRepo.FindById(userId)
+	if err != nil {
+		return errors.New("user does not exist")
+	}
+	if !user.IsLocal() {
+		return errors.New("email is managed by the directory")
+	}
+	if !user.CheckPassword(password) {
+		return errors.New("password error")
+	}
+	return s.verifyService.RequestEmailChange(user, newEmail)
 }
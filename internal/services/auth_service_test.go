@@ -0,0 +1,265 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/hasher"
+	"bpf.com/pkg/tenant"
+	"bpf.com/pkg/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testClient = ClientInfo{Ip: "192.0.2.1", UserAgent: "test"}
+
+// password login of a user without a second factor
+func login(t *testing.T, username string) *LoginResult {
+	t.Helper()
+	result, err := NewAuthService().Login(username, testPassword, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" {
+		t.Fatalf("Login() = %+v, want a token pair", result)
+	}
+	return result
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	f := setup(t)
+	f.user(t, tenant.Default, "alice", models.RoleUser)
+	first := login(t, "alice")
+	auth := NewAuthService()
+
+	access, second, err := auth.RefreshToken(first.RefreshToken, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access == "" || second == "" || second == first.RefreshToken {
+		t.Fatalf("RefreshToken() = %q, %q, want a new pair", access, second)
+	}
+	claims, err := utils.ParseAccessToken(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := NewTokenService().IsAccessTokenRevoked(claims); err != nil || revoked {
+		t.Fatalf("IsAccessTokenRevoked() = %v, %v for a fresh token", revoked, err)
+	}
+
+	//the rotated token leaked, presenting it again ends the whole family
+	if _, _, err := auth.RefreshToken(first.RefreshToken, testClient); err == nil {
+		t.Error("a used refresh token was accepted")
+	}
+	if _, _, err := auth.RefreshToken(second, testClient); err == nil {
+		t.Error("the family survived the reuse of one of its tokens")
+	}
+	if revoked, err := NewTokenService().IsAccessTokenRevoked(claims); err != nil || !revoked {
+		t.Errorf("IsAccessTokenRevoked() = %v, %v, want the access token of the family revoked", revoked, err)
+	}
+	if _, _, err := auth.RefreshToken("unknown", testClient); err == nil {
+		t.Error("an unknown refresh token was accepted")
+	}
+}
+
+func TestLogoutChecksTheRefreshFamilyOwner(t *testing.T) {
+	f := setup(t)
+	f.user(t, tenant.Default, "alice", models.RoleUser)
+	f.user(t, tenant.Default, "mallory", models.RoleUser)
+	victim := login(t, "alice")
+	attacker := login(t, "mallory")
+	claims, err := utils.ParseAccessToken(attacker.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//a token without a session names the family by its refresh token
+	claims.SessionId = ""
+	if err := NewAuthService().Logout(claims, victim.RefreshToken); err == nil {
+		t.Error("Logout() revoked the refresh family of another user")
+	}
+	if _, _, err := NewAuthService().RefreshToken(victim.RefreshToken, testClient); err != nil {
+		t.Errorf("the refresh token of the victim stopped working: %v", err)
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	f := setup(t)
+	alice := f.user(t, tenant.Default, "alice", models.RoleUser)
+	before := login(t, "alice")
+	claims, err := utils.ParseAccessToken(before.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewTokenService().RevokeUserTokens(alice.Id); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := NewTokenService().IsAccessTokenRevoked(claims); err != nil || !revoked {
+		t.Errorf("IsAccessTokenRevoked() = %v, %v for a token issued before the revocation", revoked, err)
+	}
+	waitRevocationCutoff()
+	after := login(t, "alice")
+	claims, err = utils.ParseAccessToken(after.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := NewTokenService().IsAccessTokenRevoked(claims); err != nil || revoked {
+		t.Errorf("IsAccessTokenRevoked() = %v, %v for a token issued after the revocation", revoked, err)
+	}
+}
+
+// turn 2fa on for the user, the recovery codes serve as valid second factors
+func enableMfa(t *testing.T, f *fixture, user *models.User) []string {
+	t.Helper()
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.MfaEnabled = true
+	user.MfaSecret = secret
+	if err := f.db.Save(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	codes, err := NewMfaService().(*MfaService).newRecoveryCodes(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codes
+}
+
+// password login stopping at the second factor
+func mfaLogin(t *testing.T, username string) string {
+	t.Helper()
+	result, err := NewAuthService().Login(username, testPassword, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.MfaRequired || result.MfaToken == "" || result.AccessToken != "" {
+		t.Fatalf("Login() = %+v, want the second factor pending", result)
+	}
+	return result.MfaToken
+}
+
+func TestVerifyMfa(t *testing.T) {
+	f := setup(t)
+	alice := f.user(t, tenant.Default, "alice", models.RoleUser)
+	codes := enableMfa(t, f, alice)
+	auth := NewAuthService()
+
+	mfaToken := mfaLogin(t, "alice")
+	if _, err := auth.VerifyMfa(mfaToken, "000000", testClient); err == nil {
+		t.Error("VerifyMfa() accepted a wrong code")
+	}
+	result, err := auth.VerifyMfa(mfaToken, codes[0], testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" {
+		t.Errorf("VerifyMfa() = %+v, want a token pair", result)
+	}
+	if _, err := auth.VerifyMfa(mfaToken, codes[1], testClient); err == nil {
+		t.Error("the mfa token was accepted twice")
+	}
+	if _, err := auth.VerifyMfa(mfaLogin(t, "alice"), codes[0], testClient); err == nil {
+		t.Error("a recovery code was accepted twice")
+	}
+}
+
+func TestMfaAttemptsArePerUser(t *testing.T) {
+	f := setup(t)
+	config.GetAppConfig().Auth.MaxLoginFailures = 0
+	config.GetAppConfig().Mfa.MaxAttempts = 3
+	alice := f.user(t, tenant.Default, "alice", models.RoleUser)
+	codes := enableMfa(t, f, alice)
+	auth := NewAuthService()
+
+	//a new login does not start a new budget
+	for i := 0; i < 3; i++ {
+		if _, err := auth.VerifyMfa(mfaLogin(t, "alice"), "000000", testClient); err == nil {
+			t.Fatal("VerifyMfa() accepted a wrong code")
+		}
+	}
+	if _, err := auth.VerifyMfa(mfaLogin(t, "alice"), codes[0], testClient); err == nil {
+		t.Error("VerifyMfa() accepted a code after the attempts of the user ran out")
+	}
+}
+
+func TestVerifyMfaWithExpiredPassword(t *testing.T) {
+	f := setup(t)
+	config.GetAppConfig().Password.MaxAge = 30
+	alice := f.user(t, tenant.Default, "alice", models.RoleUser)
+	changedAt := time.Now().AddDate(0, 0, -31)
+	alice.PasswordChangedAt = &changedAt
+	codes := enableMfa(t, f, alice)
+
+	result, err := NewAuthService().VerifyMfa(mfaLogin(t, "alice"), codes[0], testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.PasswordExpired || result.PasswordToken == "" || result.AccessToken != "" {
+		t.Errorf("VerifyMfa() = %+v, want a password change before any token", result)
+	}
+}
+
+func TestLoginGuard(t *testing.T) {
+	f := setup(t)
+	f.user(t, tenant.Default, "alice", models.RoleUser)
+	bob := f.user(t, tenant.Default, "bob", models.RoleUser)
+	codes := enableMfa(t, f, bob)
+	auth := NewAuthService()
+	var locked *LoginLockedError
+
+	for i := 0; i < 3; i++ {
+		if _, err := auth.Login("alice", "wrong", testClient); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Login() error = %v, want ErrInvalidCredentials", err)
+		}
+	}
+	if _, err := auth.Login("alice", testPassword, testClient); !errors.As(err, &locked) {
+		t.Errorf("Login() error = %v, want the account locked", err)
+	}
+
+	//the password alone does not reset the failures, nor do failed second factors
+	if _, err := auth.Login("bob", "wrong", testClient); err == nil {
+		t.Fatal("Login() accepted a wrong password")
+	}
+	mfaToken := mfaLogin(t, "bob")
+	if _, err := auth.VerifyMfa(mfaToken, "000000", testClient); err == nil {
+		t.Fatal("VerifyMfa() accepted a wrong code")
+	}
+	if _, err := auth.VerifyMfa(mfaToken, "aaaaa-aaaaa", testClient); err == nil {
+		t.Fatal("VerifyMfa() accepted a wrong recovery code")
+	}
+	if _, err := auth.VerifyMfa(mfaToken, codes[0], testClient); !errors.As(err, &locked) {
+		t.Errorf("VerifyMfa() error = %v, want the account locked", err)
+	}
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	f := setup(t)
+	cfg := config.GetAppConfig()
+	argon := cfg.Password
+	cfg.Password = config.PasswordConfig{Algorithm: hasher.Bcrypt, BcryptCost: bcrypt.MinCost}
+	alice := f.user(t, tenant.Default, "alice", models.RoleUser)
+	if !strings.HasPrefix(alice.Password, "$2a$") {
+		t.Fatalf("password = %q, want a bcrypt hash", alice.Password)
+	}
+	cfg.Password = argon
+
+	if _, err := NewAuthService().Login("alice", "wrong", testClient); err == nil {
+		t.Fatal("Login() accepted a wrong password")
+	}
+	if f.reload(t, alice.Id).Password != alice.Password {
+		t.Error("a failed login changed the hash")
+	}
+	login(t, "alice")
+	upgraded := f.reload(t, alice.Id).Password
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("password = %q, want it upgraded to argon2id", upgraded)
+	}
+	login(t, "alice")
+	if f.reload(t, alice.Id).Password != upgraded {
+		t.Error("a current hash was rehashed again")
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"sync"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// password backend of the login chain.
+// ErrInvalidCredentials passes the login on to the next backend.
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// hash compared against when the username does not exist, keeps the timing uniform
+var (
+	dummyUser     *models.User
+	dummyUserOnce sync.Once
+)
+
+func dummyPasswordCheck(password string) {
+	dummyUserOnce.Do(func() {
+		dummyUser = &models.User{}
+		dummyUser.SetPassword("go-bpf-dummy-password")
+	})
+	dummyUser.CheckPassword(password)
+}
+
+// build the chain from auth.authenticators, local only by default
+func newAuthenticatorChain() []Authenticator {
+	names := config.GetAppConfig().Auth.Authenticators
+	if len(names) == 0 {
+		names = []string{models.AuthSourceLocal}
+	}
+	chain := make([]Authenticator, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case models.AuthSourceLocal:
+			chain = append(chain, NewLocalAuthenticator())
+		case models.AuthSourceLdap:
+			chain = append(chain, NewLdapAuthenticator())
+		default:
+			logger.GetLogger().Warn("unknown authenticator ignored", zap.String("name", name))
+		}
+	}
+	return chain
+}
+
+// try every backend in order, the first success wins.
+// A failing backend does not stop the chain, its error is returned
+// only when no other backend accepted the credentials.
+func authenticateChain(chain []Authenticator, username, password string) (*models.User, error) {
+	var lastErr error
+	for _, authenticator := range chain {
+		user, err := authenticator.Authenticate(username, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			logger.GetLogger().Error("authenticator fail",
+				zap.String("authenticator", authenticator.Name()), zap.Error(err))
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return nil, errors.New("authentication backend unavailable")
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// checks the hashed password of local users
+type LocalAuthenticator struct {
+	userRepo repository.IUserRepository
+}
+
+// create LocalAuthenticator
+func NewLocalAuthenticator() *LocalAuthenticator {
+	return &LocalAuthenticator{
+		userRepo: repository.NewUserRepository(),
+	}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return models.AuthSourceLocal
+}
+
+// check the local password, directory users are left to their backend
+func (a *LocalAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	user, err := a.userRepo.FindByUsername(username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			dummyPasswordCheck(password)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if !user.IsLocal() {
+		dummyPasswordCheck(password)
+		return nil, ErrInvalidCredentials
+	}
+	if !user.CheckPassword(password) {
+		return nil, ErrInvalidCredentials
+	}
+	//upgrade the hash while the plain password is at hand
+	if user.PasswordNeedsRehash() {
+		if err := user.SetPassword(password); err == nil {
+			if err := a.userRepo.Update(user); err != nil {
+				logger.GetLogger().Error("rehash password fail", zap.Error(err))
+			}
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,618 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/logger"
+	perm "bpf.com/pkg/permission"
+	"bpf.com/pkg/tenant"
+	"bpf.com/pkg/utils"
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCasbinDomain  = "default"
+	defaultCasbinChannel = "casbin-policy-update"
+)
+
+// shared by every CasbinService, nil while casbin is disabled
+var enforcer *casbin.SyncedEnforcer
+
+var errCasbinDisabled = errors.New("casbin is not enabled")
+
+// casbin service interface
+type ICasbinService interface {
+	Enforce(userId, tenantId uint64, permission string) (bool, error)
+	HasRole(userId, tenantId uint64, roleCode string) (bool, error)
+	ListPolicies() ([][]string, error)
+	ListGroupings() ([][]string, error)
+	AddPolicy(subject, domain, object, action string) error
+	RemovePolicy(subject, domain, object, action string) error
+	AddGrouping(subject, roleCode, domain string) error
+	RemoveGrouping(subject, roleCode, domain string) error
+}
+
+// implements ICasbinService
+type CasbinService struct {
+	ruleRepo repository.ICasbinRuleRepository
+	roleRepo repository.IRoleRepository
+}
+
+// create CasbinService
+func NewCasbinService() ICasbinService {
+	return &CasbinService{
+		ruleRepo: repository.NewCasbinRuleRepository(),
+		roleRepo: repository.NewRoleRepository(),
+	}
+}
+
+// load the model and the stored policies and follow the changes made by other instances.
+// An empty policy table is seeded from the roles so switching to casbin keeps the current access,
+// from then on the user and role services keep the lines of their changes in step
+func InitCasbin() error {
+	cfg := config.GetAppConfig().Casbin
+	if !cfg.Enabled {
+		return nil
+	}
+	service := &CasbinService{
+		ruleRepo: repository.NewCasbinRuleRepository(),
+		roleRepo: repository.NewRoleRepository(),
+	}
+	if err := service.seed(); err != nil {
+		return err
+	}
+	if err := service.migrateSubjects(); err != nil {
+		return err
+	}
+	e, err := casbin.NewSyncedEnforcer(cfg.ModelFile, &casbinAdapter{ruleRepo: service.ruleRepo})
+	if err != nil {
+		return err
+	}
+	//reload through the synced enforcer, the default callback skips its lock
+	reload := func(string) {
+		if err := e.LoadPolicy(); err != nil {
+			logger.GetLogger().Error("reload casbin policy fail", zap.Error(err))
+			return
+		}
+		logger.GetLogger().Info("casbin policy reloaded")
+	}
+	//the callback is in place before subscribing so no update is missed
+	watcher, err := newCasbinWatcher(casbinChannel(), reload)
+	if err != nil {
+		return err
+	}
+	//SetWatcher installs the default callback, put ours back
+	if err := e.SetWatcher(watcher); err != nil {
+		return err
+	}
+	if err := watcher.SetUpdateCallback(reload); err != nil {
+		return err
+	}
+	enforcer = e
+	return nil
+}
+
+// casbin decides permissions and roles
+func CasbinEnabled() bool {
+	return enforcer != nil
+}
+
+func casbinDomain() string {
+	if domain := config.GetAppConfig().Casbin.Domain; domain != "" {
+		return domain
+	}
+	return defaultCasbinDomain
+}
+
+// the default organization uses the configured domain, every other one its own
+// so equal role codes of different organizations stay apart
+func casbinTenantDomain(tenantId uint64) string {
+	if tenantId == 0 || tenantId == tenant.Default {
+		return casbinDomain()
+	}
+	return "org-" + strconv.FormatUint(tenantId, 10)
+}
+
+func casbinChannel() string {
+	if channel := config.GetAppConfig().Casbin.Channel; channel != "" {
+		return channel
+	}
+	return defaultCasbinChannel
+}
+
+// subjects are typed so user ids and role codes never meet: user:<id> and role:<code>
+const (
+	casbinUserPrefix = "user:"
+	casbinRolePrefix = "role:"
+)
+
+func casbinSubject(userId uint64) string {
+	return casbinUserPrefix + strconv.FormatUint(userId, 10)
+}
+
+func casbinRoleSubject(roleCode string) string {
+	return casbinRolePrefix + roleCode
+}
+
+// subjects given to the admin api have to name their kind
+func checkCasbinSubject(subject string) error {
+	for _, prefix := range []string{casbinUserPrefix, casbinRolePrefix} {
+		if strings.HasPrefix(subject, prefix) && len(subject) > len(prefix) {
+			return nil
+		}
+	}
+	return errors.New("subject has to be user:<id> or role:<code>")
+}
+
+// user:update:own is checked as obj user, act update:own
+func splitPermission(permission string) (string, string) {
+	if permission == models.PermAll {
+		return "*", "*"
+	}
+	obj, act, _ := strings.Cut(permission, ":")
+	return obj, act
+}
+
+// permission of a user in the domain of its organization
+func casbinHasPermission(userId, tenantId uint64, permission string) (bool, error) {
+	obj, act := splitPermission(permission)
+	return enforcer.Enforce(casbinSubject(userId), casbinTenantDomain(tenantId), obj, act)
+}
+
+// role of a user in the domain of its organization, inherited roles count
+func casbinHasRole(userId, tenantId uint64, roleCode string) (bool, error) {
+	roles, err := enforcer.GetImplicitRolesForUser(casbinSubject(userId), casbinTenantDomain(tenantId))
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		if role == casbinRoleSubject(roleCode) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// check a permission of a user in the domain of its organization
+func (s *CasbinService) Enforce(userId, tenantId uint64, permission string) (bool, error) {
+	if !CasbinEnabled() {
+		return false, errCasbinDisabled
+	}
+	return casbinHasPermission(userId, tenantId, permission)
+}
+
+// check a role of a user in the domain of its organization, inherited roles count
+func (s *CasbinService) HasRole(userId, tenantId uint64, roleCode string) (bool, error) {
+	if !CasbinEnabled() {
+		return false, errCasbinDisabled
+	}
+	return casbinHasRole(userId, tenantId, roleCode)
+}
+
+// every p line
+func (s *CasbinService) ListPolicies() ([][]string, error) {
+	if !CasbinEnabled() {
+		return nil, errCasbinDisabled
+	}
+	return enforcer.GetPolicy()
+}
+
+// every g line
+func (s *CasbinService) ListGroupings() ([][]string, error) {
+	if !CasbinEnabled() {
+		return nil, errCasbinDisabled
+	}
+	return enforcer.GetGroupingPolicy()
+}
+
+// add a p line, saved to the database and announced to the other instances
+func (s *CasbinService) AddPolicy(subject, domain, object, action string) error {
+	if !CasbinEnabled() {
+		return errCasbinDisabled
+	}
+	if err := checkCasbinSubject(subject); err != nil {
+		return err
+	}
+	added, err := enforcer.AddPolicy(subject, s.domain(domain), object, action)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return errors.New("policy already exist")
+	}
+	return nil
+}
+
+// remove a p line
+func (s *CasbinService) RemovePolicy(subject, domain, object, action string) error {
+	if !CasbinEnabled() {
+		return errCasbinDisabled
+	}
+	removed, err := enforcer.RemovePolicy(subject, s.domain(domain), object, action)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return errors.New("policy does not exist")
+	}
+	return nil
+}
+
+// add a g line giving the subject a role in the domain
+func (s *CasbinService) AddGrouping(subject, roleCode, domain string) error {
+	if !CasbinEnabled() {
+		return errCasbinDisabled
+	}
+	if err := checkCasbinSubject(subject); err != nil {
+		return err
+	}
+	added, err := enforcer.AddGroupingPolicy(subject, casbinRoleSubject(roleCode), s.domain(domain))
+	if err != nil {
+		return err
+	}
+	if !added {
+		return errors.New("grouping already exist")
+	}
+	return nil
+}
+
+// remove a g line
+func (s *CasbinService) RemoveGrouping(subject, roleCode, domain string) error {
+	if !CasbinEnabled() {
+		return errCasbinDisabled
+	}
+	removed, err := enforcer.RemoveGroupingPolicy(subject, casbinRoleSubject(roleCode), s.domain(domain))
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return errors.New("grouping does not exist")
+	}
+	return nil
+}
+
+func (s *CasbinService) domain(domain string) string {
+	if domain == "" {
+		return casbinDomain()
+	}
+	return domain
+}
+
+// p lines of a role, its permissions with the implied ones
+func casbinRolePolicies(role *models.Role) [][]string {
+	domain := casbinTenantDomain(role.TenantId)
+	var lines [][]string
+	seen := map[string]bool{}
+	for _, permission := range role.Permissions {
+		for _, code := range append([]string{permission}, perm.Implied(permission)...) {
+			obj, act := splitPermission(code)
+			line := []string{casbinRoleSubject(role.Code), domain, obj, act}
+			if key := strings.Join(line, ","); !seen[key] {
+				seen[key] = true
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// write only the differences between the current and the wanted lines of a section
+func syncCasbinLines(sec string, current, wanted [][]string) error {
+	index := func(lines [][]string) map[string][]string {
+		keyed := make(map[string][]string, len(lines))
+		for _, line := range lines {
+			keyed[strings.Join(line, ",")] = line
+		}
+		return keyed
+	}
+	currentLines, wantedLines := index(current), index(wanted)
+	var stale, missing [][]string
+	for key, line := range currentLines {
+		if _, ok := wantedLines[key]; !ok {
+			stale = append(stale, line)
+		}
+	}
+	for key, line := range wantedLines {
+		if _, ok := currentLines[key]; !ok {
+			missing = append(missing, line)
+		}
+	}
+	remove, add := enforcer.RemovePolicies, enforcer.AddPolicies
+	if sec == "g" {
+		remove, add = enforcer.RemoveGroupingPolicies, enforcer.AddGroupingPolicies
+	}
+	if len(stale) > 0 {
+		if _, err := remove(stale); err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		if _, err := add(missing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the groupings of a user follow the roles saved for it, nil roles drops them.
+// The database change already happened, so failures are only logged
+func syncCasbinUser(userId, tenantId uint64, roles []*models.Role) {
+	if !CasbinEnabled() {
+		return
+	}
+	subject := casbinSubject(userId)
+	wanted := make([][]string, 0, len(roles))
+	for _, role := range roles {
+		wanted = append(wanted, []string{subject, casbinRoleSubject(role.Code), casbinTenantDomain(tenantId)})
+	}
+	current, err := enforcer.GetFilteredGroupingPolicy(0, subject)
+	if err == nil {
+		err = syncCasbinLines("g", current, wanted)
+	}
+	if err != nil {
+		logger.GetLogger().Error("sync casbin user fail", zap.Uint64("userId", userId), zap.Error(err))
+	}
+}
+
+// the policies of a role and its parent grouping follow the saved role, role.Parent
+// has to be loaded. A changed code moves the users and child roles along
+func syncCasbinRole(role *models.Role, oldCode string) {
+	if !CasbinEnabled() {
+		return
+	}
+	domain := casbinTenantDomain(role.TenantId)
+	subject := casbinRoleSubject(role.Code)
+	err := func() error {
+		if oldCode != "" && oldCode != role.Code {
+			members, err := enforcer.GetFilteredGroupingPolicy(1, casbinRoleSubject(oldCode), domain)
+			if err != nil {
+				return err
+			}
+			moved := make([][]string, 0, len(members))
+			for _, line := range members {
+				moved = append(moved, []string{line[0], subject, domain})
+			}
+			if err := syncCasbinLines("g", members, moved); err != nil {
+				return err
+			}
+			if err := removeCasbinLines(oldCode, domain); err != nil {
+				return err
+			}
+		}
+		current, err := enforcer.GetFilteredPolicy(0, subject, domain)
+		if err != nil {
+			return err
+		}
+		if err := syncCasbinLines("p", current, casbinRolePolicies(role)); err != nil {
+			return err
+		}
+		var parent [][]string
+		if role.Parent != nil {
+			parent = append(parent, []string{subject, casbinRoleSubject(role.Parent.Code), domain})
+		}
+		if current, err = enforcer.GetFilteredGroupingPolicy(0, subject, "", domain); err != nil {
+			return err
+		}
+		return syncCasbinLines("g", current, parent)
+	}()
+	if err != nil {
+		logger.GetLogger().Error("sync casbin role fail", zap.String("role", role.Code), zap.Error(err))
+	}
+}
+
+// drop the policies and the parent grouping of a deleted role, it has no users or children left
+func removeCasbinRole(role *models.Role) {
+	if !CasbinEnabled() {
+		return
+	}
+	if err := removeCasbinLines(role.Code, casbinTenantDomain(role.TenantId)); err != nil {
+		logger.GetLogger().Error("remove casbin role fail", zap.String("role", role.Code), zap.Error(err))
+	}
+}
+
+func removeCasbinLines(roleCode, domain string) error {
+	subject := casbinRoleSubject(roleCode)
+	if _, err := enforcer.RemoveFilteredPolicy(0, subject, domain); err != nil {
+		return err
+	}
+	_, err := enforcer.RemoveFilteredGroupingPolicy(0, subject, "", domain)
+	return err
+}
+
+// translate the roles into policies when there are none yet: their permissions
+// with the implied ones, their parents and the users holding them, each in the
+// domain of the organization of the role
+func (s *CasbinService) seed() error {
+	count, err := s.ruleRepo.Count()
+	if err != nil || count > 0 {
+		return err
+	}
+	roles, err := s.roleRepo.List()
+	if err != nil {
+		return err
+	}
+	codes := make(map[uint64]string, len(roles))
+	for _, role := range roles {
+		codes[role.Id] = role.Code
+	}
+	var rules []*models.CasbinRule
+	seen := map[string]bool{}
+	add := func(rule *models.CasbinRule) {
+		key := strings.Join(rule.Line(), ",")
+		if !seen[key] {
+			seen[key] = true
+			rules = append(rules, rule)
+		}
+	}
+	for _, role := range roles {
+		domain := casbinTenantDomain(role.TenantId)
+		for _, line := range casbinRolePolicies(role) {
+			add(models.NewCasbinRule("p", line))
+		}
+		if role.ParentId != nil && codes[*role.ParentId] != "" {
+			add(models.NewCasbinRule("g", []string{casbinRoleSubject(role.Code), casbinRoleSubject(codes[*role.ParentId]), domain}))
+		}
+		userIds, err := s.roleRepo.ListUserIds(role.Id)
+		if err != nil {
+			return err
+		}
+		for _, userId := range userIds {
+			add(models.NewCasbinRule("g", []string{casbinSubject(userId), casbinRoleSubject(role.Code), domain}))
+		}
+	}
+	logger.GetLogger().Info("casbin policies seeded from roles", zap.Int("rules", len(rules)))
+	return s.ruleRepo.ReplaceAll(rules)
+}
+
+// lines stored before subjects were typed name users by bare id and roles by bare code.
+// Numeric subjects were users, everything else and every granted role a role
+func (s *CasbinService) migrateSubjects() error {
+	rules, err := s.ruleRepo.List()
+	if err != nil {
+		return err
+	}
+	migrated := false
+	typed := func(subject string) bool {
+		return strings.HasPrefix(subject, casbinUserPrefix) || strings.HasPrefix(subject, casbinRolePrefix)
+	}
+	for _, rule := range rules {
+		if !typed(rule.V0) {
+			if _, err := strconv.ParseUint(rule.V0, 10, 64); err == nil {
+				rule.V0 = casbinUserPrefix + rule.V0
+			} else {
+				rule.V0 = casbinRoleSubject(rule.V0)
+			}
+			migrated = true
+		}
+		if rule.Ptype == "g" && !typed(rule.V1) {
+			rule.V1 = casbinRoleSubject(rule.V1)
+			migrated = true
+		}
+	}
+	if !migrated {
+		return nil
+	}
+	logger.GetLogger().Info("casbin subjects migrated to user:<id> and role:<code>", zap.Int("rules", len(rules)))
+	return s.ruleRepo.ReplaceAll(rules)
+}
+
+// stores the policy lines in t_sys_casbin_rules
+type casbinAdapter struct {
+	ruleRepo repository.ICasbinRuleRepository
+}
+
+func (a *casbinAdapter) LoadPolicy(m model.Model) error {
+	rules, err := a.ruleRepo.List()
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err := persist.LoadPolicyArray(rule.Line(), m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *casbinAdapter) SavePolicy(m model.Model) error {
+	var rules []*models.CasbinRule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, assertion := range m[sec] {
+			for _, line := range assertion.Policy {
+				rules = append(rules, models.NewCasbinRule(ptype, line))
+			}
+		}
+	}
+	return a.ruleRepo.ReplaceAll(rules)
+}
+
+func (a *casbinAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.ruleRepo.Create(models.NewCasbinRule(ptype, rule))
+}
+
+func (a *casbinAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.ruleRepo.Delete(models.NewCasbinRule(ptype, rule))
+}
+
+func (a *casbinAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	lines := make([]*models.CasbinRule, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, models.NewCasbinRule(ptype, rule))
+	}
+	return a.ruleRepo.CreateAll(lines)
+}
+
+func (a *casbinAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	lines := make([]*models.CasbinRule, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, models.NewCasbinRule(ptype, rule))
+	}
+	return a.ruleRepo.DeleteAll(lines)
+}
+
+func (a *casbinAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return a.ruleRepo.DeleteFiltered(ptype, fieldIndex, fieldValues...)
+}
+
+// tells the other instances to reload over redis pub/sub, messages carry
+// the id of the sending instance so it skips its own
+type casbinWatcher struct {
+	channel    string
+	instanceId string
+	mu         sync.RWMutex
+	callback   func(string)
+	cancel     context.CancelFunc
+}
+
+func newCasbinWatcher(channel string, callback func(string)) (*casbinWatcher, error) {
+	instanceId, err := utils.GenerateRandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &casbinWatcher{
+		channel:    channel,
+		instanceId: instanceId,
+		callback:   callback,
+		cancel:     cancel,
+	}
+	err = cache.GetGlobalCache().Subscribe(ctx, channel, func(message string) {
+		w.mu.RLock()
+		callback := w.callback
+		w.mu.RUnlock()
+		if message != w.instanceId && callback != nil {
+			callback(message)
+		}
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *casbinWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+func (w *casbinWatcher) Update() error {
+	return cache.GetGlobalCache().Publish(context.Background(), w.channel, w.instanceId)
+}
+
+func (w *casbinWatcher) Close() {
+	w.cancel()
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/tenant"
+)
+
+// casbin on the seeded roles, turned off again after the test
+func useCasbin(t *testing.T) {
+	t.Helper()
+	config.GetAppConfig().Casbin = config.CasbinConfig{Enabled: true, ModelFile: "../../casbin_model.conf"}
+	if err := InitCasbin(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { enforcer = nil })
+}
+
+func TestCasbinSubjectsDoNotCollide(t *testing.T) {
+	f := setup(t)
+	guest := f.user(t, tenant.Default, "guest", models.RoleGuest)
+	//a role whose code is the id of the guest, created before codes were checked
+	numeric := &models.Role{TenantId: tenant.Default, Name: "numeric", Code: strconv.FormatUint(guest.Id, 10),
+		Permissions: models.Permissions{models.PermAll}}
+	if err := f.db.Create(numeric).Error; err != nil {
+		t.Fatal(err)
+	}
+	useCasbin(t)
+
+	service := NewCasbinService()
+	if ok, err := service.Enforce(guest.Id, tenant.Default, models.PermUserDelete); err != nil || ok {
+		t.Errorf("Enforce() = %v, %v, the guest got the permissions of the role named by its id", ok, err)
+	}
+	if ok, err := service.HasRole(guest.Id, tenant.Default, models.RoleGuest); err != nil || !ok {
+		t.Errorf("HasRole(guest) = %v, %v, want true", ok, err)
+	}
+	if err := service.AddGrouping(numeric.Code, models.RoleAdmin, ""); err == nil {
+		t.Error("AddGrouping() accepted an untyped subject")
+	}
+}
+
+func TestCasbinMigratesUntypedSubjects(t *testing.T) {
+	f := setup(t)
+	admin := f.user(t, tenant.Default, "admin", models.RoleAdmin)
+	for _, rule := range []*models.CasbinRule{
+		models.NewCasbinRule("p", []string{models.RoleAdmin, casbinDomain(), "*", "*"}),
+		models.NewCasbinRule("g", []string{strconv.FormatUint(admin.Id, 10), models.RoleAdmin, casbinDomain()}),
+	} {
+		if err := f.db.Create(rule).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	useCasbin(t)
+
+	if ok, err := NewCasbinService().Enforce(admin.Id, tenant.Default, models.PermUserDelete); err != nil || !ok {
+		t.Errorf("Enforce() = %v, %v, the migrated lines have to keep the access", ok, err)
+	}
+}
+
+func TestRoleCodes(t *testing.T) {
+	f := setup(t)
+	admin := f.user(t, tenant.Default, "admin", models.RoleAdmin)
+	tests := []struct {
+		name    string
+		code    string
+		wantErr bool
+	}{
+		{"plain", "editor", false},
+		{"number", "42", true},
+		{"separator", "user:1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := &models.Role{Name: tt.name, Code: tt.code}
+			err := NewRoleService().WithContext(f.as(t, admin)).CreateRole(role)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateRole(%q) error = %v, wantErr %v", tt.code, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+)
+
+// department service interface
+type IDepartmentService interface {
+	WithContext(ctx context.Context) IDepartmentService
+	ListDepartments() ([]*models.Department, error)
+	GetDepartmentById(deptId uint64) (*models.Department, error)
+	CreateDepartment(dept *models.Department) error
+	UpdateDepartment(dept *models.Department) error
+	DeleteDepartment(deptId uint64) error
+}
+
+// implements IDepartmentService
+type DepartmentService struct {
+	deptRepo repository.IDepartmentRepository
+}
+
+// Create DepartmentService
+func NewDepartmentService() IDepartmentService {
+	return &DepartmentService{
+		deptRepo: repository.NewDepartmentRepository(),
+	}
+}
+
+// service working on the department tree of the tenant of ctx
+func (s *DepartmentService) WithContext(ctx context.Context) IDepartmentService {
+	return &DepartmentService{
+		deptRepo: s.deptRepo.WithContext(ctx),
+	}
+}
+
+// Find department list, parents come before their children
+func (s *DepartmentService) ListDepartments() ([]*models.Department, error) {
+	return s.deptRepo.List()
+}
+
+// Find department by Id
+func (s *DepartmentService) GetDepartmentById(deptId uint64) (*models.Department, error) {
+	dept, err := s.deptRepo.FindById(deptId)
+	if err != nil {
+		return nil, errors.New("department does not exist")
+	}
+	return dept, nil
+}
+
+// Create department below its parent, names are unique among siblings
+func (s *DepartmentService) CreateDepartment(dept *models.Department) error {
+	parent, err := s.findParent(dept.ParentId)
+	if err != nil {
+		return err
+	}
+	if existsDept, _ := s.deptRepo.FindByName(dept.ParentId, dept.Name); existsDept != nil {
+		return errors.New("department name already exist")
+	}
+	parentPath := ""
+	if parent != nil {
+		dept.TenantId = parent.TenantId
+		parentPath = parent.Path
+	}
+	return s.deptRepo.Create(dept, parentPath)
+}
+
+// Update department name, order and parent, moving it takes its subtree along
+func (s *DepartmentService) UpdateDepartment(dept *models.Department) error {
+	existingDept, err := s.GetDepartmentById(dept.Id)
+	if err != nil {
+		return err
+	}
+	parent, err := s.findParent(dept.ParentId)
+	if err != nil {
+		return err
+	}
+	if parent != nil && parent.TenantId != existingDept.TenantId {
+		return errors.New("parent department does not exist")
+	}
+	if parent != nil && strings.HasPrefix(parent.Path, existingDept.Path) {
+		return errors.New("department can not be moved below itself")
+	}
+	if dept.Name != existingDept.Name || !sameParent(dept.ParentId, existingDept.ParentId) {
+		if conflictDept, _ := s.deptRepo.FindByName(dept.ParentId, dept.Name); conflictDept != nil && conflictDept.Id != dept.Id {
+			return errors.New("department name already exist")
+		}
+	}
+	moved := !sameParent(dept.ParentId, existingDept.ParentId)
+	oldPath := existingDept.Path
+	existingDept.Name = dept.Name
+	existingDept.Sort = dept.Sort
+	existingDept.ParentId = dept.ParentId
+	if !moved {
+		if err := s.deptRepo.Update(existingDept); err != nil {
+			return err
+		}
+	} else {
+		parentPath := ""
+		if parent != nil {
+			parentPath = parent.Path
+		}
+		existingDept.Path = models.DepartmentPath(parentPath, existingDept.Id)
+		if err := s.deptRepo.Move(existingDept, oldPath); err != nil {
+			return err
+		}
+	}
+	*dept = *existingDept
+	return nil
+}
+
+// Delete department, only when it has no children and no users
+func (s *DepartmentService) DeleteDepartment(deptId uint64) error {
+	dept, err := s.GetDepartmentById(deptId)
+	if err != nil {
+		return err
+	}
+	count, err := s.deptRepo.CountChildren(dept.Id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("department still has sub departments")
+	}
+	count, err = s.deptRepo.CountUsers(dept.Id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("department still has users")
+	}
+	return s.deptRepo.Delete(dept.Id)
+}
+
+// parent of a department, nil for a root department
+func (s *DepartmentService) findParent(parentId *uint64) (*models.Department, error) {
+	if parentId == nil {
+		return nil, nil
+	}
+	parent, err := s.deptRepo.FindById(*parentId)
+	if err != nil {
+		return nil, errors.New("parent department does not exist")
+	}
+	return parent, nil
+}
+
+func sameParent(a, b *uint64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
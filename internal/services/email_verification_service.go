@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/mailer"
+	"bpf.com/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// unverified user policies
+const (
+	UnverifiedAllow      = "allow"
+	UnverifiedRestricted = "restricted"
+	UnverifiedDeny       = "deny"
+)
+
+// value signed into a verification link
+type emailVerificationClaims struct {
+	UserId uint64 `json:"uid"`
+	Email  string `json:"email"`
+}
+
+// email verification service interface
+type IEmailVerificationService interface {
+	SendVerification(user *models.User) error
+	Resend(email string) error
+	Verify(token string) (*models.User, error)
+	RequestEmailChange(user *models.User, newEmail string) error
+	CanLogin(user *models.User) bool
+	PermissionAllowed(user *models.User, permission string) bool
+}
+
+// implements IEmailVerificationService
+type EmailVerificationService struct {
+	userRepo         repository.IUserRepository
+	principalService IPrincipalService
+}
+
+// create EmailVerificationService
+func NewEmailVerificationService() IEmailVerificationService {
+	return &EmailVerificationService{
+		userRepo:         repository.NewUserRepository(),
+		principalService: NewPrincipalService(),
+	}
+}
+
+// address waiting for verification, the pending email when changing
+func verificationAddress(user *models.User) string {
+	if user.PendingEmail != "" {
+		return user.PendingEmail
+	}
+	return user.Email
+}
+
+// mail a signed verification link
+func (s *EmailVerificationService) SendVerification(user *models.User) error {
+	cfg := config.GetAppConfig()
+	exp := cfg.Auth.EmailVerificationExp
+	if exp <= 0 {
+		exp = 1440
+	}
+	email := verificationAddress(user)
+	token, err := utils.SignValue(emailVerificationClaims{UserId: user.Id, Email: email},
+		cfg.Auth.LinkSecret, time.Duration(exp)*time.Minute)
+	if err != nil {
+		return err
+	}
+	mailer.SendTemplateAsync(email, "email_verification", "Verify your email", map[string]interface{}{
+		"Name":      user.Nickname,
+		"Email":     email,
+		"Link":      cfg.Server.PublicUrl + "/api/v1/auth/verify-email?token=" + url.QueryEscape(token),
+		"ExpiresIn": int64(exp),
+	})
+	return nil
+}
+
+// resend the link, unknown or verified emails succeed silently
+func (s *EmailVerificationService) Resend(email string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.IsEmailVerified() && user.PendingEmail == "" {
+		return nil
+	}
+	return s.SendVerification(user)
+}
+
+// verify a link, confirming the email or applying a pending email change
+func (s *EmailVerificationService) Verify(token string) (*models.User, error) {
+	var claims emailVerificationClaims
+	if err := utils.VerifySignedValue(token, config.GetAppConfig().Auth.LinkSecret, &claims); err != nil {
+		return nil, errors.New("invalid or expired verification link")
+	}
+	user, err := s.userRepo.FindById(claims.UserId)
+	if err != nil {
+		return nil, errors.New("user does not exist")
+	}
+	switch {
+	case user.PendingEmail != "" && claims.Email == user.PendingEmail:
+		conflictUser, _ := s.userRepo.FindByEmail(claims.Email)
+		if conflictUser != nil && conflictUser.Id != user.Id {
+			return nil, errors.New("email already exist")
+		}
+		user.Email = user.PendingEmail
+		user.PendingEmail = ""
+	case claims.Email == user.Email:
+		if user.IsEmailVerified() {
+			return user, nil
+		}
+	default:
+		//link of an address the user no longer uses
+		return nil, errors.New("invalid or expired verification link")
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	s.principalService.Invalidate(user.Id)
+	return user, nil
+}
+
+// keep the current email until the new one is verified
+func (s *EmailVerificationService) RequestEmailChange(user *models.User, newEmail string) error {
+	if newEmail == user.Email {
+		user.PendingEmail = ""
+		return s.userRepo.Update(user)
+	}
+	conflictUser, _ := s.userRepo.FindByEmail(newEmail)
+	if conflictUser != nil && conflictUser.Id != user.Id {
+		return errors.New("email already exist")
+	}
+	user.PendingEmail = newEmail
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	return s.SendVerification(user)
+}
+
+// login is refused only by the deny policy
+func (s *EmailVerificationService) CanLogin(user *models.User) bool {
+	return user.IsEmailVerified() || config.GetAppConfig().Auth.UnverifiedPolicy != UnverifiedDeny
+}
+
+// restricted unverified users only keep permissions of auth.unverifiedPermissions
+func (s *EmailVerificationService) PermissionAllowed(user *models.User, permission string) bool {
+	return unverifiedAllowed(user.IsEmailVerified(), permission)
+}
+
+// restricted unverified users only keep auth.unverifiedPermissions
+func unverifiedAllowed(emailVerified bool, permission string) bool {
+	cfg := config.GetAppConfig().Auth
+	if emailVerified || cfg.UnverifiedPolicy != UnverifiedRestricted {
+		return true
+	}
+	return models.Permissions(cfg.UnverifiedPermissions).HasPermission(permission)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/logger"
+	"bpf.com/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// impersonation service interface
+type IImpersonationService interface {
+	Impersonate(actorId, userId uint64, client ClientInfo) (string, time.Time, error)
+	Record(entry *models.ImpersonationLog)
+	ListLogs(userId uint64, page, pageSize int) ([]*models.ImpersonationLog, int64, error)
+}
+
+// implements IImpersonationService
+type ImpersonationService struct {
+	userRepo repository.IUserRepository
+	logRepo  repository.IImpersonationLogRepository
+}
+
+// create ImpersonationService
+func NewImpersonationService() IImpersonationService {
+	return &ImpersonationService{
+		userRepo: repository.NewUserRepository(),
+		logRepo:  repository.NewImpersonationLogRepository(),
+	}
+}
+
+// issue a short lived access token for the user carrying the admin as actor.
+// The lifetime is capped at the access token lifetime so revoking all
+// tokens of the user also covers impersonation tokens.
+func (s *ImpersonationService) Impersonate(actorId, userId uint64, client ClientInfo) (string, time.Time, error) {
+	if actorId == userId {
+		return "", time.Time{}, errors.New("can not impersonate yourself")
+	}
+	actor, err := s.userRepo.FindById(actorId)
+	if err != nil {
+		return "", time.Time{}, errors.New("user does not exist")
+	}
+	user, err := s.userRepo.FindById(userId)
+	if err != nil {
+		return "", time.Time{}, errors.New("user does not exist")
+	}
+	if !user.IsActive() {
+		return "", time.Time{}, errors.New("user disabled")
+	}
+	//only the platform tier reaches into other organizations
+	if user.TenantId != actor.TenantId && !actor.HasRole(models.RoleSuperuser) {
+		return "", time.Time{}, errors.New("user does not exist")
+	}
+	//acting as another admin would be a way around their own permissions
+	if user.HasRole(models.RoleAdmin) || user.HasRole(models.RoleSuperuser) {
+		return "", time.Time{}, errors.New("administrators can not be impersonated")
+	}
+	cfg := config.GetAppConfig().JWT
+	exp := cfg.ImpersonationExp
+	if exp <= 0 {
+		exp = 15
+	}
+	if cfg.AccessTokenExp > 0 && exp > cfg.AccessTokenExp {
+		exp = cfg.AccessTokenExp
+	}
+	expiresAt := time.Now().Add(time.Duration(exp) * time.Minute)
+	token, claims, err := utils.GenerateImpersonationToken(user.Id, user.TenantId, user.RoleCodes(), actor.Id, actor.Username, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	//no token without its audit entry
+	err = s.logRepo.Create(&models.ImpersonationLog{
+		ActorId:   actor.Id,
+		UserId:    user.Id,
+		TokenId:   claims.ID,
+		Action:    models.ImpersonationStart,
+		Ip:        client.Ip,
+		UserAgent: client.UserAgent,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	logger.GetLogger().Warn("impersonation started",
+		zap.Uint64("actorId", actor.Id),
+		zap.Uint64("userId", user.Id),
+		zap.String("tokenId", claims.ID))
+	return token, expiresAt, nil
+}
+
+// save an audit entry, errors only get logged
+func (s *ImpersonationService) Record(entry *models.ImpersonationLog) {
+	if err := s.logRepo.Create(entry); err != nil {
+		logger.GetLogger().Error("record impersonation fail",
+			zap.Uint64("actorId", entry.ActorId),
+			zap.Uint64("userId", entry.UserId),
+			zap.Error(err))
+	}
+}
+
+// audit trail of an impersonated user
+func (s *ImpersonationService) ListLogs(userId uint64, page, pageSize int) ([]*models.ImpersonationLog, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	return s.logRepo.ListByUser(userId, page, pageSize)
+}
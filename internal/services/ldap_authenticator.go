@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/ldap"
+	"bpf.com/pkg/logger"
+	"bpf.com/pkg/tenant"
+	"bpf.com/pkg/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// binds against the ldap directory, users are created on first login
+// and their email, name and roles follow the directory on every login
+type LdapAuthenticator struct {
+	userRepo         repository.IUserRepository
+	roleRepo         repository.IRoleRepository
+	principalService IPrincipalService
+	//directory lookup, replaced in tests
+	bind func(username, password string) (*ldap.Entry, error)
+}
+
+// create LdapAuthenticator
+func NewLdapAuthenticator() *LdapAuthenticator {
+	return &LdapAuthenticator{
+		userRepo:         repository.NewUserRepository(),
+		roleRepo:         repository.NewRoleRepository(),
+		principalService: NewPrincipalService(),
+		bind:             ldap.Authenticate,
+	}
+}
+
+func (a *LdapAuthenticator) Name() string {
+	return models.AuthSourceLdap
+}
+
+// bind as the user and sync the local row
+func (a *LdapAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	entry, err := a.bind(username, password)
+	if err != nil {
+		if errors.Is(err, ldap.ErrInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if entry.Email == "" {
+		return nil, errors.New("directory entry has no email")
+	}
+	user, err := a.userRepo.FindByUsername(entry.Username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	//roles come from the organization of the user, new users join the default one
+	tenantId := tenant.Default
+	if user != nil {
+		tenantId = user.TenantId
+	}
+	roles, err := a.mapRoles(entry.Groups, tenantId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if user == nil {
+		//just in time provisioning, the local password is never used
+		user = &models.User{
+			Username:        entry.Username,
+			Email:           entry.Email,
+			Nickname:        entry.Name,
+			Roles:           roles,
+			Status:          models.StatusActive,
+			EmailVerifiedAt: &now,
+			AuthSource:      models.AuthSourceLdap,
+		}
+		password, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		if err := user.SetPassword(password); err != nil {
+			return nil, err
+		}
+		if err := a.userRepo.Create(user); err != nil {
+			return nil, err
+		}
+		syncCasbinUser(user.Id, user.TenantId, roles)
+		return a.userRepo.FindById(user.Id)
+	}
+	//never take over a local account that happens to share the username
+	if user.AuthSource != models.AuthSourceLdap {
+		logger.GetLogger().Warn("ldap login refused for local account", zap.String("username", entry.Username))
+		return nil, ErrInvalidCredentials
+	}
+	user.Email = entry.Email
+	user.Nickname = entry.Name
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	if err := a.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	if err := a.userRepo.ReplaceRoles(user, roles); err != nil {
+		return nil, err
+	}
+	syncCasbinUser(user.Id, user.TenantId, roles)
+	a.principalService.Invalidate(user.Id)
+	return user, nil
+}
+
+// every configured group the user belongs to adds its role, the default role
+// is used when none matches
+func (a *LdapAuthenticator) mapRoles(groups []string, tenantId uint64) ([]*models.Role, error) {
+	cfg := config.GetAppConfig().Ldap
+	var codes []string
+	for _, mapping := range cfg.GroupRoles {
+		if a.memberOf(groups, mapping.Group) && !contains(codes, mapping.Role) {
+			codes = append(codes, mapping.Role)
+		}
+	}
+	if len(codes) == 0 && cfg.DefaultRole != "" {
+		codes = append(codes, cfg.DefaultRole)
+	}
+	if len(codes) == 0 {
+		return nil, errors.New("no role mapped for the directory groups")
+	}
+	roleRepo := a.roleRepo.WithContext(tenant.WithTenant(context.Background(), tenantId))
+	roles := make([]*models.Role, 0, len(codes))
+	for _, code := range codes {
+		role, err := roleRepo.FindByCode(code)
+		if err != nil {
+			return nil, errors.New("mapped role does not exist: " + code)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *LdapAuthenticator) memberOf(groups []string, group string) bool {
+	for _, groupDn := range groups {
+		if ldap.GroupMatches(groupDn, group) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/ldap"
+	"bpf.com/pkg/tenant"
+)
+
+const (
+	adminsGroup = "cn=admins,ou=groups,dc=example,dc=org"
+	staffGroup  = "cn=staff,ou=groups,dc=example,dc=org"
+)
+
+// ldap authenticator answering from the given entries instead of a directory
+func stubLdap(t *testing.T, entries map[string]*ldap.Entry) *LdapAuthenticator {
+	t.Helper()
+	config.GetAppConfig().Ldap = config.LdapConfig{
+		GroupRoles: []config.LdapGroupConfig{
+			{Group: "admins", Role: models.RoleAdmin},
+			{Group: staffGroup, Role: models.RoleUser},
+		},
+	}
+	a := NewLdapAuthenticator()
+	a.bind = func(username, password string) (*ldap.Entry, error) {
+		entry, ok := entries[username]
+		if !ok || password != "directory-secret" {
+			return nil, ldap.ErrInvalidCredentials
+		}
+		return entry, nil
+	}
+	return a
+}
+
+func TestLdapAuthenticator(t *testing.T) {
+	f := setup(t)
+	alice := &ldap.Entry{Username: "alice", Email: "alice@example.org", Name: "Alice", Groups: []string{staffGroup}}
+	a := stubLdap(t, map[string]*ldap.Entry{
+		"alice":   alice,
+		"local":   {Username: "local", Email: "other@example.org", Groups: []string{adminsGroup}},
+		"nomail":  {Username: "nomail", Groups: []string{staffGroup}},
+		"nogroup": {Username: "nogroup", Email: "nogroup@example.org"},
+	})
+	local := f.user(t, tenant.Default, "local", models.RoleUser)
+
+	//first login provisions the user
+	user, err := a.Authenticate("alice", "directory-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.AuthSource != models.AuthSourceLdap || user.TenantId != tenant.Default || user.EmailVerifiedAt == nil {
+		t.Errorf("provisioned user = source %q tenant %d, want a verified ldap user of the default organization", user.AuthSource, user.TenantId)
+	}
+	if codes := roleCodes(user); len(codes) != 1 || !codes[models.RoleUser] {
+		t.Errorf("roles = %v, want the role of the staff group", user.RoleCodes())
+	}
+
+	//later logins follow the directory
+	alice.Email = "alice@example.com"
+	alice.Groups = []string{adminsGroup}
+	again, err := a.Authenticate("alice", "directory-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := f.reload(t, again.Id)
+	if again.Id != user.Id || reloaded.Email != "alice@example.com" {
+		t.Errorf("second login = user %d email %q, want the same user with the new email", again.Id, reloaded.Email)
+	}
+	if codes := roleCodes(reloaded); len(codes) != 1 || !codes[models.RoleAdmin] {
+		t.Errorf("roles = %v, want the role of the admins group only", reloaded.RoleCodes())
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		invalid  bool
+	}{
+		{"wrong password", "alice", "wrong", true},
+		{"unknown user", "bob", "directory-secret", true},
+		{"local account of the same name", "local", "directory-secret", true},
+		{"entry without email", "nomail", "directory-secret", false},
+		{"no mapped group", "nogroup", "directory-secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Authenticate(tt.username, tt.password)
+			if err == nil {
+				t.Fatal("Authenticate() succeeded")
+			}
+			if errors.Is(err, ErrInvalidCredentials) != tt.invalid {
+				t.Errorf("Authenticate() error = %v, invalid credentials %v", err, tt.invalid)
+			}
+		})
+	}
+	if local := f.reload(t, local.Id); local.Email != "local@example.org" || !roleCodes(local)[models.RoleUser] {
+		t.Error("a refused ldap login changed the local account")
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+)
+
+// login is refused until RetryAfter has passed
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// brute-force protection interface
+type ILoginGuardService interface {
+	Check(username, ip string) error
+	RecordFailure(username, ip string) error
+	RecordSuccess(username string) error
+	Unlock(username string) error
+}
+
+// implements ILoginGuardService with failure counters in redis
+type LoginGuardService struct{}
+
+// create LoginGuardService
+func NewLoginGuardService() ILoginGuardService {
+	return &LoginGuardService{}
+}
+
+// counter and backoff keys of a username or ip
+func loginFailKey(kind, value string) string {
+	return "login-fail:" + kind + ":" + value
+}
+
+func loginDelayKey(kind, value string) string {
+	return "login-delay:" + kind + ":" + value
+}
+
+// usernames are matched case-insensitively
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// refuse login while the username or ip is locked or backing off
+func (s *LoginGuardService) Check(username, ip string) error {
+	cfg := config.GetAppConfig().Auth
+	targets := []struct {
+		kind, value string
+		max         int
+	}{
+		{"user", normalizeUsername(username), cfg.MaxLoginFailures},
+		{"ip", ip, cfg.MaxIpLoginFailures},
+	}
+	ctx := context.Background()
+	for _, target := range targets {
+		if target.max <= 0 || target.value == "" {
+			continue
+		}
+		var failures int64
+		failKey := loginFailKey(target.kind, target.value)
+		if exists, _ := cache.GetGlobalCache().Exists(ctx, failKey); exists {
+			if err := cache.GetGlobalCache().Get(ctx, failKey, &failures); err != nil {
+				return err
+			}
+		}
+		if failures >= int64(target.max) {
+			ttl, err := cache.GetGlobalCache().TTL(ctx, failKey)
+			if err != nil {
+				return err
+			}
+			return &LoginLockedError{RetryAfter: ttl}
+		}
+		ttl, err := cache.GetGlobalCache().TTL(ctx, loginDelayKey(target.kind, target.value))
+		if err != nil {
+			return err
+		}
+		if ttl > 0 {
+			return &LoginLockedError{RetryAfter: ttl}
+		}
+	}
+	return nil
+}
+
+// count a failure, lock at the threshold and back off exponentially below it
+func (s *LoginGuardService) RecordFailure(username, ip string) error {
+	cfg := config.GetAppConfig().Auth
+	if err := s.recordFailure("user", normalizeUsername(username), cfg.MaxLoginFailures); err != nil {
+		return err
+	}
+	return s.recordFailure("ip", ip, cfg.MaxIpLoginFailures)
+}
+
+func (s *LoginGuardService) recordFailure(kind, value string, max int) error {
+	if max <= 0 || value == "" {
+		return nil
+	}
+	cfg := config.GetAppConfig().Auth
+	ctx := context.Background()
+	failKey := loginFailKey(kind, value)
+	failures, err := cache.GetGlobalCache().Incr(ctx, failKey, time.Duration(cfg.LoginFailureWindow)*time.Minute)
+	if err != nil {
+		return err
+	}
+	if failures >= int64(max) {
+		//the counter itself is the lock
+		return cache.GetGlobalCache().Expire(ctx, failKey, time.Duration(cfg.LockoutDuration)*time.Minute)
+	}
+	delay := loginDelay(failures)
+	if delay <= 0 {
+		return nil
+	}
+	return cache.GetGlobalCache().Set(ctx, loginDelayKey(kind, value), failures, delay)
+}
+
+// base * 2^(failures-1), capped by loginDelayMax
+func loginDelay(failures int64) time.Duration {
+	cfg := config.GetAppConfig().Auth
+	base := time.Duration(cfg.LoginDelayBase) * time.Second
+	max := time.Duration(cfg.LoginDelayMax) * time.Second
+	if base <= 0 || failures <= 0 {
+		return 0
+	}
+	delay := base
+	for i := int64(1); i < failures; i++ {
+		delay *= 2
+		if max > 0 && delay >= max {
+			return max
+		}
+	}
+	return delay
+}
+
+// forget failures of the username after a successful login
+func (s *LoginGuardService) RecordSuccess(username string) error {
+	return s.Unlock(username)
+}
+
+// unlock an account
+func (s *LoginGuardService) Unlock(username string) error {
+	ctx := context.Background()
+	value := normalizeUsername(username)
+	if err := cache.GetGlobalCache().Delete(ctx, loginFailKey("user", value)); err != nil {
+		return err
+	}
+	return cache.GetGlobalCache().Delete(ctx, loginDelayKey("user", value))
+}
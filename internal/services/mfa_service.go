@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/utils"
+)
+
+// default number of recovery codes
+const defaultRecoveryCodeCount = 10
+
+// totp enrollment info shown to the user
+type MfaEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// mfa service interface
+type IMfaService interface {
+	IsRequired(user *models.User) bool
+	BeginEnrollment(user *models.User) (*MfaEnrollment, error)
+	Enable(user *models.User, code string) ([]string, error)
+	Disable(user *models.User, code string) error
+	Reset(userId uint64) error
+	RegenerateRecoveryCodes(user *models.User, code string) ([]string, error)
+	VerifyCode(user *models.User, code string) (bool, error)
+}
+
+// implements IMfaService
+type MfaService struct {
+	userRepo         repository.IUserRepository
+	recoveryCodeRepo repository.IMfaRecoveryCodeRepository
+	principalService IPrincipalService
+}
+
+// create MfaService
+func NewMfaService() IMfaService {
+	return &MfaService{
+		userRepo:         repository.NewUserRepository(),
+		recoveryCodeRepo: repository.NewMfaRecoveryCodeRepository(),
+		principalService: NewPrincipalService(),
+	}
+}
+
+// 2FA is required when one of the user's roles is listed in mfa.requiredRoles
+func (s *MfaService) IsRequired(user *models.User) bool {
+	for _, code := range config.GetAppConfig().Mfa.RequiredRoles {
+		if user.HasRole(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// generate a new secret, mfa stays off until a code is confirmed
+func (s *MfaService) BeginEnrollment(user *models.User) (*MfaEnrollment, error) {
+	if user.MfaEnabled {
+		return nil, errors.New("2fa already enabled")
+	}
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.MfaSecret = secret
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	issuer := config.GetAppConfig().Mfa.Issuer
+	return &MfaEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TotpProvisioningURI(issuer, user.Username, secret),
+	}, nil
+}
+
+// confirm the enrollment with a code and issue recovery codes
+func (s *MfaService) Enable(user *models.User, code string) ([]string, error) {
+	if user.MfaEnabled {
+		return nil, errors.New("2fa already enabled")
+	}
+	if user.MfaSecret == "" {
+		return nil, errors.New("2fa enrollment not started")
+	}
+	ok, err := s.verifyTotp(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("invalid 2fa code")
+	}
+	user.MfaEnabled = true
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	s.principalService.Invalidate(user.Id)
+	return s.newRecoveryCodes(user.Id)
+}
+
+// turn 2fa off, not allowed while the user's role requires it
+func (s *MfaService) Disable(user *models.User, code string) error {
+	if !user.MfaEnabled {
+		return errors.New("2fa not enabled")
+	}
+	if s.IsRequired(user) {
+		return errors.New("2fa is required for your role")
+	}
+	ok, err := s.VerifyCode(user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("invalid 2fa code")
+	}
+	return s.Reset(user.Id)
+}
+
+// clear 2fa of a user, used by admins when a device is lost
+func (s *MfaService) Reset(userId uint64) error {
+	user, err := s.userRepo.FindById(userId)
+	if err != nil {
+		return errors.New("user does not exist")
+	}
+	user.MfaEnabled = false
+	user.MfaSecret = ""
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	s.principalService.Invalidate(userId)
+	return s.recoveryCodeRepo.DeleteByUser(userId)
+}
+
+// replace the recovery codes after checking a code
+func (s *MfaService) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if !user.MfaEnabled {
+		return nil, errors.New("2fa not enabled")
+	}
+	ok, err := s.verifyTotp(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("invalid 2fa code")
+	}
+	return s.newRecoveryCodes(user.Id)
+}
+
+// check a totp code or consume a recovery code
+func (s *MfaService) VerifyCode(user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if strings.Contains(code, "-") {
+		return s.recoveryCodeRepo.UseCode(user.Id, utils.HashToken(strings.ToLower(code)))
+	}
+	return s.verifyTotp(user, code)
+}
+
+// check a totp code, a step is accepted only once per user
+func (s *MfaService) verifyTotp(user *models.User, code string) (bool, error) {
+	step, ok := utils.ValidateTotpCode(user.MfaSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	//reject replays within the skew window
+	key := fmt.Sprintf("mfa-used-step:%d:%d", user.Id, step)
+	count, err := cache.GetGlobalCache().Incr(context.Background(), key, 3*utils.TotpPeriod())
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+// generate and store a fresh set of recovery codes
+func (s *MfaService) newRecoveryCodes(userId uint64) ([]string, error) {
+	count := config.GetAppConfig().Mfa.RecoveryCodeCount
+	if count <= 0 {
+		count = defaultRecoveryCodeCount
+	}
+	codes, err := utils.GenerateRecoveryCodes(count)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, utils.HashToken(code))
+	}
+	if err := s.recoveryCodeRepo.ReplaceForUser(userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/url"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/utils"
+)
+
+// oauth client settings, Public clients get no secret
+type OAuthClientInput struct {
+	Name         string
+	RedirectUris []string
+	Grants       []string
+	Scopes       []string
+	Public       bool
+	FirstParty   bool
+}
+
+// oauth client service interface
+type IOAuthClientService interface {
+	Create(input OAuthClientInput) (*models.OAuthClient, string, error)
+	List() ([]*models.OAuthClient, error)
+	Delete(id uint64) error
+	RotateSecret(id uint64) (*models.OAuthClient, string, error)
+	Authenticate(clientId, clientSecret string) (*models.OAuthClient, error)
+	FindActive(clientId string) (*models.OAuthClient, error)
+}
+
+// implements IOAuthClientService
+type OAuthClientService struct {
+	clientRepo       repository.IOAuthClientRepository
+	refreshTokenRepo repository.IRefreshTokenRepository
+}
+
+// create OAuthClientService
+func NewOAuthClientService() IOAuthClientService {
+	return &OAuthClientService{
+		clientRepo:       repository.NewOAuthClientRepository(),
+		refreshTokenRepo: repository.NewRefreshTokenRepository(),
+	}
+}
+
+// register a client, the plain secret is only returned here
+func (s *OAuthClientService) Create(input OAuthClientInput) (*models.OAuthClient, string, error) {
+	if err := validateOAuthClient(input); err != nil {
+		return nil, "", err
+	}
+	clientId, err := utils.GenerateRandomToken(18)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &models.OAuthClient{
+		ClientId:     clientId,
+		Name:         input.Name,
+		RedirectUris: input.RedirectUris,
+		Grants:       input.Grants,
+		Scopes:       input.Scopes,
+		Public:       input.Public,
+		FirstParty:   input.FirstParty,
+		Status:       models.StatusActive,
+	}
+	var secret string
+	if !input.Public {
+		secret, err = utils.GenerateRandomToken(32)
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+	if err := s.clientRepo.Create(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// check the grants and redirect uris of a client
+func validateOAuthClient(input OAuthClientInput) error {
+	if len(input.Grants) == 0 {
+		return errors.New("at least one grant is required")
+	}
+	for _, grant := range input.Grants {
+		switch grant {
+		case models.GrantAuthorizationCode, models.GrantRefreshToken:
+		case models.GrantClientCredentials:
+			if input.Public {
+				return errors.New("public clients can not use client_credentials")
+			}
+		default:
+			return errors.New("unsupported grant: " + grant)
+		}
+	}
+	for _, grant := range input.Grants {
+		if grant == models.GrantAuthorizationCode && len(input.RedirectUris) == 0 {
+			return errors.New("authorization_code requires a redirect uri")
+		}
+	}
+	for _, redirectUri := range input.RedirectUris {
+		parsed, err := url.Parse(redirectUri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return errors.New("invalid redirect uri: " + redirectUri)
+		}
+	}
+	return nil
+}
+
+// list clients
+func (s *OAuthClientService) List() ([]*models.OAuthClient, error) {
+	return s.clientRepo.List()
+}
+
+// delete a client and revoke the grants it holds
+func (s *OAuthClientService) Delete(id uint64) error {
+	client, err := s.clientRepo.FindById(id)
+	if err != nil {
+		return errors.New("client does not exist")
+	}
+	if err := s.refreshTokenRepo.RevokeByClient(client.ClientId); err != nil {
+		return err
+	}
+	return s.clientRepo.Delete(id)
+}
+
+// replace the secret of a confidential client
+func (s *OAuthClientService) RotateSecret(id uint64) (*models.OAuthClient, string, error) {
+	client, err := s.clientRepo.FindById(id)
+	if err != nil {
+		return nil, "", errors.New("client does not exist")
+	}
+	if client.Public {
+		return nil, "", errors.New("public clients have no secret")
+	}
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	client.SecretHash = utils.HashToken(secret)
+	if err := s.clientRepo.Update(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// authenticate a client at the token endpoints, public clients send no secret
+func (s *OAuthClientService) Authenticate(clientId, clientSecret string) (*models.OAuthClient, error) {
+	client, err := s.FindActive(clientId)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		if clientSecret != "" {
+			return nil, errors.New("invalid client")
+		}
+		return client, nil
+	}
+	if clientSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(utils.HashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, errors.New("invalid client")
+	}
+	return client, nil
+}
+
+// find an active client by client id
+func (s *OAuthClientService) FindActive(clientId string) (*models.OAuthClient, error) {
+	if clientId == "" {
+		return nil, errors.New("invalid client")
+	}
+	client, err := s.clientRepo.FindByClientId(clientId)
+	if err != nil || !client.IsActive() {
+		return nil, errors.New("invalid client")
+	}
+	return client, nil
+}
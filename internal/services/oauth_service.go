@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/logger"
+	"bpf.com/pkg/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// oauth error codes (RFC 6749)
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthAccessDenied            = "access_denied"
+)
+
+// oauth protocol error, sent to clients as error and error_description
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// authorization request params
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectUri         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// what the consent screen shows, RedirectUri is set once it was validated
+type AuthorizeInfo struct {
+	Client          *models.OAuthClient
+	RedirectUri     string
+	Scopes          []string
+	ConsentRequired bool
+}
+
+// token request params
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectUri  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+// token response (RFC 6749 section 5.1)
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// authorization code waiting to be exchanged
+type oauthCode struct {
+	ClientId      string   `json:"client_id"`
+	UserId        uint64   `json:"user_id"`
+	RedirectUri   string   `json:"redirect_uri"`
+	Scopes        []string `json:"scopes"`
+	CodeChallenge string   `json:"code_challenge"`
+}
+
+// oauth authorization server interface
+type IOAuthService interface {
+	Authorize(userId uint64, req AuthorizeRequest) (*AuthorizeInfo, error)
+	Approve(userId uint64, req AuthorizeRequest, approved bool) (string, error)
+	Token(client *models.OAuthClient, req TokenRequest) (*OAuthToken, error)
+	Introspect(token string) map[string]interface{}
+	Revoke(client *models.OAuthClient, token string) error
+}
+
+// implements IOAuthService
+type OAuthService struct {
+	userRepo         repository.IUserRepository
+	refreshTokenRepo repository.IRefreshTokenRepository
+	consentRepo      repository.IOAuthConsentRepository
+	clientService    IOAuthClientService
+	userService      IUserService
+	tokenService     ITokenService
+	sessionService   ISessionService
+}
+
+// create OAuthService
+func NewOAuthService() IOAuthService {
+	return &OAuthService{
+		userRepo:         repository.NewUserRepository(),
+		refreshTokenRepo: repository.NewRefreshTokenRepository(),
+		consentRepo:      repository.NewOAuthConsentRepository(),
+		clientService:    NewOAuthClientService(),
+		userService:      NewUserService(),
+		tokenService:     NewTokenService(),
+		sessionService:   NewSessionService(),
+	}
+}
+
+// authorization code key
+func oauthCodeKey(code string) string {
+	return "oauth-code:" + utils.HashToken(code)
+}
+
+// lifetime of an authorization code
+func oauthCodeExp() time.Duration {
+	exp := config.GetAppConfig().OAuth.CodeExp
+	if exp <= 0 {
+		exp = 60
+	}
+	return time.Duration(exp) * time.Second
+}
+
+// validate an authorization request for the consent screen
+func (s *OAuthService) Authorize(userId uint64, req AuthorizeRequest) (*AuthorizeInfo, error) {
+	info, err := s.validateAuthorize(userId, req)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// answer the consent screen, returns where to send the user agent
+func (s *OAuthService) Approve(userId uint64, req AuthorizeRequest, approved bool) (string, error) {
+	info, err := s.validateAuthorize(userId, req)
+	if info == nil {
+		//without a trusted redirect uri the error goes to the user
+		return "", err
+	}
+	if err != nil {
+		return authorizeRedirect(info.RedirectUri, req.State, "", err), nil
+	}
+	if !approved {
+		return authorizeRedirect(info.RedirectUri, req.State, "",
+			newOAuthError(OAuthAccessDenied, "the user denied the request")), nil
+	}
+	if !info.Client.FirstParty {
+		if err := s.consentRepo.Grant(userId, info.Client.ClientId, info.Scopes); err != nil {
+			return "", err
+		}
+	}
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = cache.GetGlobalCache().Set(context.Background(), oauthCodeKey(code), oauthCode{
+		ClientId:      info.Client.ClientId,
+		UserId:        userId,
+		RedirectUri:   req.RedirectUri,
+		Scopes:        info.Scopes,
+		CodeChallenge: req.CodeChallenge,
+	}, oauthCodeExp())
+	if err != nil {
+		return "", err
+	}
+	return authorizeRedirect(info.RedirectUri, req.State, code, nil), nil
+}
+
+// check client, redirect uri, pkce and scopes of an authorization request
+func (s *OAuthService) validateAuthorize(userId uint64, req AuthorizeRequest) (*AuthorizeInfo, error) {
+	client, err := s.clientService.FindActive(req.ClientId)
+	if err != nil {
+		return nil, newOAuthError(OAuthInvalidClient, "unknown client")
+	}
+	redirectUri := req.RedirectUri
+	if redirectUri == "" && len(client.RedirectUris) == 1 {
+		redirectUri = client.RedirectUris[0]
+	}
+	if !client.RedirectUris.Contains(redirectUri) {
+		return nil, newOAuthError(OAuthInvalidRequest, "redirect_uri is not registered for the client")
+	}
+	info := &AuthorizeInfo{Client: client, RedirectUri: redirectUri}
+
+	if req.ResponseType != "code" {
+		return info, newOAuthError(OAuthUnsupportedResponseType, "only the code response type is supported")
+	}
+	if !client.AllowsGrant(models.GrantAuthorizationCode) {
+		return info, newOAuthError(OAuthUnauthorizedClient, "client may not use authorization_code")
+	}
+	if req.CodeChallenge == "" {
+		if client.Public {
+			return info, newOAuthError(OAuthInvalidRequest, "public clients require code_challenge")
+		}
+	} else if req.CodeChallengeMethod != "S256" {
+		return info, newOAuthError(OAuthInvalidRequest, "code_challenge_method must be S256")
+	}
+	scopes, err := s.userScopes(userId, client, strings.Fields(req.Scope))
+	if err != nil {
+		return info, err
+	}
+	info.Scopes = scopes
+	if !client.FirstParty {
+		consent, err := s.consentRepo.Find(userId, client.ClientId)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		info.ConsentRequired = consent == nil || !consent.Covers(scopes)
+	}
+	return info, nil
+}
+
+// scopes of a user token, allowed by the client and the user's role.
+// Without requested scopes every client scope the user holds is granted.
+func (s *OAuthService) userScopes(userId uint64, client *models.OAuthClient, requested []string) ([]string, error) {
+	explicit := len(requested) > 0
+	if !explicit {
+		requested = client.Scopes
+	}
+	var granted models.Permissions
+	for _, scope := range requested {
+		if !client.Scopes.HasPermission(scope) {
+			return nil, newOAuthError(OAuthInvalidScope, "scope not allowed for the client: "+scope)
+		}
+		allowed, err := s.userService.HasPermission(userId, scope)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			if explicit {
+				return nil, newOAuthError(OAuthInvalidScope, "scope not allowed by your role: "+scope)
+			}
+			continue
+		}
+		granted.AddPermission(scope)
+	}
+	if len(granted) == 0 {
+		return nil, newOAuthError(OAuthInvalidScope, "no scope can be granted")
+	}
+	return granted, nil
+}
+
+// build the redirect back to the client with a code or an error
+func authorizeRedirect(redirectUri, state, code string, err error) string {
+	target, _ := url.Parse(redirectUri)
+	query := target.Query()
+	if err != nil {
+		var oauthErr *OAuthError
+		if !errors.As(err, &oauthErr) {
+			oauthErr = newOAuthError("server_error", "authorization failed")
+		}
+		query.Set("error", oauthErr.Code)
+		query.Set("error_description", oauthErr.Description)
+	} else {
+		query.Set("code", code)
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	target.RawQuery = query.Encode()
+	return target.String()
+}
+
+// token endpoint, the client is already authenticated
+func (s *OAuthService) Token(client *models.OAuthClient, req TokenRequest) (*OAuthToken, error) {
+	switch req.GrantType {
+	case models.GrantAuthorizationCode, models.GrantClientCredentials, models.GrantRefreshToken:
+	default:
+		return nil, newOAuthError(OAuthUnsupportedGrantType, "unsupported grant_type")
+	}
+	if !client.AllowsGrant(req.GrantType) {
+		return nil, newOAuthError(OAuthUnauthorizedClient, "client may not use "+req.GrantType)
+	}
+	switch req.GrantType {
+	case models.GrantAuthorizationCode:
+		return s.exchangeCode(client, req)
+	case models.GrantClientCredentials:
+		return s.clientCredentials(client, req)
+	default:
+		return s.refresh(client, req)
+	}
+}
+
+// authorization_code grant, a code is accepted once
+func (s *OAuthService) exchangeCode(client *models.OAuthClient, req TokenRequest) (*OAuthToken, error) {
+	ctx := context.Background()
+	key := oauthCodeKey(req.Code)
+	var stored oauthCode
+	if err := cache.GetGlobalCache().Get(ctx, key, &stored); err != nil {
+		return nil, newOAuthError(OAuthInvalidGrant, "invalid or expired code")
+	}
+	used, err := cache.GetGlobalCache().Incr(ctx, key+":used", oauthCodeExp())
+	if err != nil {
+		return nil, err
+	}
+	cache.GetGlobalCache().Delete(ctx, key)
+	if used > 1 || stored.ClientId != client.ClientId || stored.RedirectUri != req.RedirectUri {
+		return nil, newOAuthError(OAuthInvalidGrant, "invalid or expired code")
+	}
+	if stored.CodeChallenge != "" {
+		sum := sha256.Sum256([]byte(req.CodeVerifier))
+		challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(challenge), []byte(stored.CodeChallenge)) != 1 {
+			return nil, newOAuthError(OAuthInvalidGrant, "invalid code_verifier")
+		}
+	} else if req.CodeVerifier != "" {
+		return nil, newOAuthError(OAuthInvalidGrant, "code_verifier without code_challenge")
+	}
+	user, err := s.userRepo.FindById(stored.UserId)
+	if err != nil || !user.IsActive() {
+		return nil, newOAuthError(OAuthInvalidGrant, "user disabled")
+	}
+	familyId, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueUserToken(client, user.Id, familyId, stored.Scopes)
+}
+
+// client_credentials grant, the client acts for itself with its own scopes
+func (s *OAuthService) clientCredentials(client *models.OAuthClient, req TokenRequest) (*OAuthToken, error) {
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !client.Scopes.HasPermission(scope) {
+			return nil, newOAuthError(OAuthInvalidScope, "scope not allowed for the client: "+scope)
+		}
+	}
+	accessToken, err := utils.GenerateOAuthAccessToken(0, client.ClientId, "", scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthToken{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   accessTokenExpiresIn(),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// refresh_token grant, rotates the token and may narrow the scopes
+func (s *OAuthService) refresh(client *models.OAuthClient, req TokenRequest) (*OAuthToken, error) {
+	stored, err := s.refreshTokenRepo.FindByHash(utils.HashToken(req.RefreshToken))
+	if err != nil || stored.ClientId != client.ClientId || stored.IsRevoked() || stored.IsExpired() {
+		return nil, newOAuthError(OAuthInvalidGrant, "invalid refresh token")
+	}
+	//a used token presented again means it leaked, kill the whole grant
+	if stored.IsUsed() {
+		s.revokeGrant(stored.FamilyId, "oauth refresh token reuse detected")
+		return nil, newOAuthError(OAuthInvalidGrant, "invalid refresh token")
+	}
+	marked, err := s.refreshTokenRepo.MarkUsed(stored.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		s.revokeGrant(stored.FamilyId, "oauth refresh token reuse detected")
+		return nil, newOAuthError(OAuthInvalidGrant, "invalid refresh token")
+	}
+	user, err := s.userRepo.FindById(stored.UserId)
+	if err != nil || !user.IsActive() {
+		return nil, newOAuthError(OAuthInvalidGrant, "user disabled")
+	}
+	scopes := []string(stored.Scopes)
+	if requested := strings.Fields(req.Scope); len(requested) > 0 {
+		for _, scope := range requested {
+			if !stored.Scopes.HasPermission(scope) {
+				return nil, newOAuthError(OAuthInvalidScope, "scope exceeds the original grant: "+scope)
+			}
+		}
+		scopes = requested
+	}
+	//the role may have lost permissions since the grant
+	var granted []string
+	for _, scope := range scopes {
+		allowed, err := s.userService.HasPermission(user.Id, scope)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			granted = append(granted, scope)
+		}
+	}
+	if len(granted) == 0 {
+		return nil, newOAuthError(OAuthInvalidScope, "no scope can be granted")
+	}
+	return s.issueUserToken(client, user.Id, stored.FamilyId, granted)
+}
+
+// issue an access token and, when the client may refresh, a refresh token of the grant
+func (s *OAuthService) issueUserToken(client *models.OAuthClient, userId uint64, familyId string, scopes []string) (*OAuthToken, error) {
+	accessToken, err := utils.GenerateOAuthAccessToken(userId, client.ClientId, familyId, scopes)
+	if err != nil {
+		return nil, err
+	}
+	token := &OAuthToken{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   accessTokenExpiresIn(),
+		Scope:       strings.Join(scopes, " "),
+	}
+	if !client.AllowsGrant(models.GrantRefreshToken) {
+		return token, nil
+	}
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.refreshTokenRepo.Create(&models.RefreshToken{
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(time.Duration(config.GetAppConfig().JWT.RefreshTokenExp) * time.Minute),
+		ClientId:  client.ClientId,
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	token.RefreshToken = refreshToken
+	return token, nil
+}
+
+// access token lifetime in seconds
+func accessTokenExpiresIn() int64 {
+	return int64(config.GetAppConfig().JWT.AccessTokenExp) * 60
+}
+
+// revoke a grant and its access tokens, errors only get logged
+func (s *OAuthService) revokeGrant(familyId, reason string) {
+	logger.GetLogger().Warn(reason, zap.String("familyId", familyId))
+	if err := s.sessionService.RevokeFamily(familyId); err != nil {
+		logger.GetLogger().Error("revoke oauth grant fail", zap.Error(err))
+	}
+}
+
+// token introspection (RFC 7662), unknown or dead tokens are only inactive
+func (s *OAuthService) Introspect(token string) map[string]interface{} {
+	inactive := map[string]interface{}{"active": false}
+	if claims, err := utils.ParseAccessToken(token); err == nil {
+		revoked, err := s.tokenService.IsAccessTokenRevoked(claims)
+		if err != nil || revoked {
+			return inactive
+		}
+		result := map[string]interface{}{
+			"active":     true,
+			"token_type": "Bearer",
+			"scope":      claims.Scope,
+			"client_id":  claims.ClientId,
+			"sub":        claims.Subject,
+			"aud":        claims.Audience,
+			"iss":        claims.Issuer,
+			"jti":        claims.ID,
+		}
+		if claims.ExpiresAt != nil {
+			result["exp"] = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			result["iat"] = claims.IssuedAt.Unix()
+		}
+		if claims.UserId != 0 {
+			user, err := s.userRepo.FindById(claims.UserId)
+			if err != nil || !user.IsActive() {
+				return inactive
+			}
+			result["sub"] = strconv.FormatUint(user.Id, 10)
+			result["username"] = user.Username
+		}
+		return result
+	}
+	stored, err := s.refreshTokenRepo.FindByHash(utils.HashToken(token))
+	if err != nil || stored.IsRevoked() || stored.IsExpired() || stored.IsUsed() {
+		return inactive
+	}
+	return map[string]interface{}{
+		"active":     true,
+		"token_type": "refresh_token",
+		"scope":      strings.Join(stored.Scopes, " "),
+		"client_id":  stored.ClientId,
+		"sub":        strconv.FormatUint(stored.UserId, 10),
+		"exp":        stored.ExpiresAt.Unix(),
+	}
+}
+
+// token revocation (RFC 7009), tokens of other clients are ignored
+func (s *OAuthService) Revoke(client *models.OAuthClient, token string) error {
+	stored, err := s.refreshTokenRepo.FindByHash(utils.HashToken(token))
+	if err == nil {
+		if stored.ClientId != client.ClientId {
+			return nil
+		}
+		return s.sessionService.RevokeFamily(stored.FamilyId)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	claims, err := utils.ParseAccessToken(token)
+	if err != nil || claims.ClientId != client.ClientId {
+		return nil
+	}
+	return s.tokenService.RevokeAccessToken(claims)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/tenant"
+)
+
+const testRedirectUri = "https://app.example.org/callback"
+
+func oauthClient(t *testing.T, name string) *models.OAuthClient {
+	t.Helper()
+	client, _, err := NewOAuthClientService().Create(OAuthClientInput{
+		Name:         name,
+		RedirectUris: []string{testRedirectUri},
+		Grants:       []string{models.GrantAuthorizationCode, models.GrantRefreshToken},
+		Scopes:       models.Permissions{models.PermUserView},
+		Public:       true,
+		FirstParty:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// approve an authorization request and read the code from the redirect
+func authorizationCode(t *testing.T, userId uint64, client *models.OAuthClient, verifier string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(verifier))
+	redirect, err := NewOAuthService().Approve(userId, AuthorizeRequest{
+		ResponseType:        "code",
+		ClientId:            client.ClientId,
+		RedirectUri:         testRedirectUri,
+		State:               "xyz",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := target.Query()
+	if query.Get("code") == "" || query.Get("state") != "xyz" {
+		t.Fatalf("Approve() = %q, want a code and the state", redirect)
+	}
+	return query.Get("code")
+}
+
+func TestExchangeCode(t *testing.T) {
+	f := setup(t)
+	alice := f.user(t, tenant.Default, "alice", models.RoleAdmin)
+	client := oauthClient(t, "app")
+	other := oauthClient(t, "other")
+	oauth := NewOAuthService()
+	const verifier = "a-code-verifier-long-enough-for-pkce-0123456789"
+
+	code := authorizationCode(t, alice.Id, client, verifier)
+	token, err := oauth.Token(client, TokenRequest{
+		GrantType:    models.GrantAuthorizationCode,
+		Code:         code,
+		RedirectUri:  testRedirectUri,
+		CodeVerifier: verifier,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken == "" || token.RefreshToken == "" || token.Scope != models.PermUserView {
+		t.Errorf("Token() = %+v, want a token pair for %s", token, models.PermUserView)
+	}
+	introspection := oauth.Introspect(token.AccessToken)
+	if introspection["active"] != true || introspection["client_id"] != client.ClientId {
+		t.Errorf("Introspect() = %v, want the active token of the client", introspection)
+	}
+
+	tests := []struct {
+		name   string
+		client *models.OAuthClient
+		code   func() string
+		req    TokenRequest
+	}{
+		{"code used twice", client, func() string { return code },
+			TokenRequest{RedirectUri: testRedirectUri, CodeVerifier: verifier}},
+		{"wrong verifier", client, func() string { return authorizationCode(t, alice.Id, client, verifier) },
+			TokenRequest{RedirectUri: testRedirectUri, CodeVerifier: "another-verifier-long-enough-for-pkce-0123456789"}},
+		{"no verifier", client, func() string { return authorizationCode(t, alice.Id, client, verifier) },
+			TokenRequest{RedirectUri: testRedirectUri}},
+		{"other client", other, func() string { return authorizationCode(t, alice.Id, client, verifier) },
+			TokenRequest{RedirectUri: testRedirectUri, CodeVerifier: verifier}},
+		{"other redirect uri", client, func() string { return authorizationCode(t, alice.Id, client, verifier) },
+			TokenRequest{RedirectUri: "https://evil.example.org/callback", CodeVerifier: verifier}},
+		{"unknown code", client, func() string { return "unknown" },
+			TokenRequest{RedirectUri: testRedirectUri, CodeVerifier: verifier}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.GrantType = models.GrantAuthorizationCode
+			req.Code = tt.code()
+			_, err := oauth.Token(tt.client, req)
+			var oauthErr *OAuthError
+			if !errors.As(err, &oauthErr) || oauthErr.Code != OAuthInvalidGrant {
+				t.Errorf("Token() error = %v, want %s", err, OAuthInvalidGrant)
+			}
+		})
+	}
+}
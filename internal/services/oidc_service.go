@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/oidc"
+	"bpf.com/pkg/tenant"
+	"bpf.com/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// characters not allowed in generated usernames
+var usernameCleaner = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// login attempt waiting for the provider callback
+type oidcState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// external login service interface
+type IOidcService interface {
+	Providers() []string
+	AuthorizationURL(providerName string) (string, error)
+	Authenticate(providerName, code, state string) (*models.User, error)
+	ListIdentities(userId uint64) ([]*models.UserIdentity, error)
+}
+
+// implements IOidcService
+type OidcService struct {
+	userRepo      repository.IUserRepository
+	identityRepo  repository.IUserIdentityRepository
+	roleRepo      repository.IRoleRepository
+	verifyService IEmailVerificationService
+}
+
+// create OidcService
+func NewOidcService() IOidcService {
+	return &OidcService{
+		userRepo:      repository.NewUserRepository(),
+		identityRepo:  repository.NewUserIdentityRepository(),
+		roleRepo:      repository.NewRoleRepository(),
+		verifyService: NewEmailVerificationService(),
+	}
+}
+
+// oidc state key
+func oidcStateKey(state string) string {
+	return "oidc-state:" + utils.HashToken(state)
+}
+
+// lifetime of a login attempt
+func oidcStateExp() time.Duration {
+	exp := config.GetAppConfig().Oidc.StateExp
+	if exp <= 0 {
+		exp = 10
+	}
+	return time.Duration(exp) * time.Minute
+}
+
+// configured provider names
+func (s *OidcService) Providers() []string {
+	return oidc.ProviderNames()
+}
+
+// start a login, state, nonce and pkce verifier wait in redis for the callback
+func (s *OidcService) AuthorizationURL(providerName string) (string, error) {
+	provider, ok := oidc.GetProvider(providerName)
+	if !ok {
+		return "", errors.New("unknown identity provider")
+	}
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	authUrl, err := provider.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+	err = cache.GetGlobalCache().Set(context.Background(), oidcStateKey(state), oidcState{
+		Provider: providerName,
+		Nonce:    nonce,
+		Verifier: verifier,
+	}, oidcStateExp())
+	if err != nil {
+		return "", err
+	}
+	return authUrl, nil
+}
+
+// finish a login and resolve the local user of the external identity
+func (s *OidcService) Authenticate(providerName, code, state string) (*models.User, error) {
+	ctx := context.Background()
+	//a state is accepted once
+	var pending oidcState
+	key := oidcStateKey(state)
+	if err := cache.GetGlobalCache().Get(ctx, key, &pending); err != nil {
+		return nil, errors.New("invalid or expired login state")
+	}
+	cache.GetGlobalCache().Delete(ctx, key)
+	if pending.Provider != providerName {
+		return nil, errors.New("invalid or expired login state")
+	}
+	provider, ok := oidc.GetProvider(providerName)
+	if !ok {
+		return nil, errors.New("unknown identity provider")
+	}
+	identity, err := provider.Exchange(ctx, code, pending.Verifier, pending.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolveUser(identity)
+}
+
+// identities linked to a user
+func (s *OidcService) ListIdentities(userId uint64) ([]*models.UserIdentity, error) {
+	return s.identityRepo.ListByUser(userId)
+}
+
+// find the linked user, link by verified email or register a new user
+func (s *OidcService) resolveUser(identity *oidc.Identity) (*models.User, error) {
+	linked, err := s.identityRepo.FindBySubject(identity.Provider, identity.Subject)
+	if err == nil {
+		if err := s.identityRepo.TouchLogin(linked.Id, identity.Email); err != nil {
+			return nil, err
+		}
+		user, err := s.userRepo.FindById(linked.UserId)
+		if err != nil {
+			return nil, errors.New("user does not exist")
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	//an unverified email could claim someone else's account
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errors.New("identity provider returned no verified email")
+	}
+	user, err := s.userRepo.FindByEmail(identity.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if user != nil {
+		if !user.IsEmailVerified() {
+			return nil, errors.New("verify your email before signing in with " + identity.Provider)
+		}
+	} else {
+		user, err = s.register(identity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	err = s.identityRepo.Create(&models.UserIdentity{
+		UserId:      user.Id,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// create the user of a new identity when the provider allows it
+func (s *OidcService) register(identity *oidc.Identity) (*models.User, error) {
+	if !s.autoRegister(identity.Provider) {
+		return nil, errors.New("no account is linked to this identity")
+	}
+	username, err := s.availableUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+	//the account can only sign in through the provider until a password is reset
+	password, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := defaultRoles(s.roleRepo, tenant.Default)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user := &models.User{
+		Username:        username,
+		Email:           identity.Email,
+		Nickname:        identity.Name,
+		Roles:           roles,
+		Status:          models.StatusActive,
+		EmailVerifiedAt: &now,
+	}
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	syncCasbinUser(user.Id, user.TenantId, roles)
+	return s.userRepo.FindById(user.Id)
+}
+
+// autoRegister of the provider
+func (s *OidcService) autoRegister(providerName string) bool {
+	for _, provider := range config.GetAppConfig().Oidc.Providers {
+		if provider.Name == providerName {
+			return provider.AutoRegister
+		}
+	}
+	return false
+}
+
+// username from the identity, suffixed when already taken
+func (s *OidcService) availableUsername(identity *oidc.Identity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = usernameCleaner.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = identity.Provider + "_" + base
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	username := base
+	for i := 0; i < 5; i++ {
+		exists, _ := s.userRepo.FindByUsername(username)
+		if exists == nil {
+			return username, nil
+		}
+		suffix, err := utils.GenerateRandomToken(3)
+		if err != nil {
+			return "", err
+		}
+		username = base + "_" + strings.ToLower(suffix)
+	}
+	return "", errors.New("could not find a free username")
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+)
+
+// organization service interface
+type IOrganizationService interface {
+	ListOrganizations() ([]*models.Organization, error)
+	GetOrganizationById(orgId uint64) (*models.Organization, error)
+	CreateOrganization(org *models.Organization) error
+	UpdateOrganization(org *models.Organization) error
+}
+
+// implements IOrganizationService
+type OrganizationService struct {
+	orgRepo repository.IOrganizationRepository
+}
+
+// Create OrganizationService
+func NewOrganizationService() IOrganizationService {
+	return &OrganizationService{
+		orgRepo: repository.NewOrganizationRepository(),
+	}
+}
+
+// Find organization list
+func (s *OrganizationService) ListOrganizations() ([]*models.Organization, error) {
+	return s.orgRepo.List()
+}
+
+// Find organization by Id
+func (s *OrganizationService) GetOrganizationById(orgId uint64) (*models.Organization, error) {
+	org, err := s.orgRepo.FindById(orgId)
+	if err != nil {
+		return nil, errors.New("organization does not exist")
+	}
+	return org, nil
+}
+
+// Create organization with its own admin, user and guest roles, the superuser
+// role stays with the platform
+func (s *OrganizationService) CreateOrganization(org *models.Organization) error {
+	if existsOrg, _ := s.orgRepo.FindByCode(org.Code); existsOrg != nil {
+		return errors.New("organization code already exist")
+	}
+	if existsOrg, _ := s.orgRepo.FindByName(org.Name); existsOrg != nil {
+		return errors.New("organization name already exist")
+	}
+	var roles []*models.Role
+	for _, code := range []string{models.RoleAdmin, models.RoleUser, models.RoleGuest} {
+		predefined := models.GetPredefinedRole(code)
+		roles = append(roles, &models.Role{
+			Name:        predefined.Name,
+			Code:        predefined.Code,
+			Description: predefined.Description,
+			Permissions: append(models.Permissions{}, predefined.Permissions...),
+		})
+	}
+	if err := s.orgRepo.CreateWithRoles(org, roles); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		syncCasbinRole(role, "")
+	}
+	return nil
+}
+
+// Update organization name and description, the code is fixed
+func (s *OrganizationService) UpdateOrganization(org *models.Organization) error {
+	existingOrg, err := s.GetOrganizationById(org.Id)
+	if err != nil {
+		return err
+	}
+	if org.Name != existingOrg.Name {
+		if conflictOrg, _ := s.orgRepo.FindByName(org.Name); conflictOrg != nil {
+			return errors.New("organization name already exist")
+		}
+	}
+	existingOrg.Name = org.Name
+	existingOrg.Description = org.Description
+	if err := s.orgRepo.Update(existingOrg); err != nil {
+		return err
+	}
+	*org = *existingOrg
+	return nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/pwned"
+)
+
+// password policy interface
+type IPasswordPolicyService interface {
+	Validate(user *models.User, password string) error
+	SetPassword(user *models.User, password string) error
+	SavePassword(user *models.User, previous string) error
+	IsExpired(user *models.User) bool
+}
+
+// implements IPasswordPolicyService
+type PasswordPolicyService struct {
+	userRepo    repository.IUserRepository
+	historyRepo repository.IPasswordHistoryRepository
+}
+
+// create PasswordPolicyService
+func NewPasswordPolicyService() IPasswordPolicyService {
+	return &PasswordPolicyService{
+		userRepo:    repository.NewUserRepository(),
+		historyRepo: repository.NewPasswordHistoryRepository(),
+	}
+}
+
+// check a new password against the policy, the history only for saved users
+func (s *PasswordPolicyService) Validate(user *models.User, password string) error {
+	cfg := config.GetAppConfig().Password
+	minLength := cfg.MinLength
+	if minLength <= 0 {
+		minLength = 8
+	}
+	maxLength := cfg.MaxLength
+	if maxLength <= 0 {
+		maxLength = 128
+	}
+	length := utf8.RuneCountInString(password)
+	if length < minLength {
+		return fmt.Errorf("password must be at least %d characters", minLength)
+	}
+	if length > maxLength {
+		return fmt.Errorf("password must be at most %d characters", maxLength)
+	}
+	if err := s.checkClasses(cfg, password); err != nil {
+		return err
+	}
+	//short usernames would match too many passwords
+	if cfg.DisallowUsername && len(user.Username) >= 3 &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(user.Username)) {
+		return errors.New("password must not contain the username")
+	}
+	breached, err := pwned.IsBreached(password)
+	if err != nil {
+		return err
+	}
+	if breached {
+		return errors.New("password appears in a data breach, choose another one")
+	}
+	if user.Id != 0 {
+		return s.checkHistory(user, password, cfg.HistorySize)
+	}
+	return nil
+}
+
+// character classes required by the policy
+func (s *PasswordPolicyService) checkClasses(cfg config.PasswordConfig, password string) error {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if cfg.RequireUpper && !upper {
+		return errors.New("password must contain an uppercase letter")
+	}
+	if cfg.RequireLower && !lower {
+		return errors.New("password must contain a lowercase letter")
+	}
+	if cfg.RequireDigit && !digit {
+		return errors.New("password must contain a digit")
+	}
+	if cfg.RequireSymbol && !symbol {
+		return errors.New("password must contain a symbol")
+	}
+	return nil
+}
+
+// the current password and the previous ones up to the history size
+func (s *PasswordPolicyService) checkHistory(user *models.User, password string, size int) error {
+	if size <= 0 {
+		return nil
+	}
+	if user.Password != "" && user.CheckPassword(password) {
+		return fmt.Errorf("password must differ from the last %d passwords", size)
+	}
+	histories, err := s.historyRepo.ListRecent(user.Id, size-1)
+	if err != nil {
+		return err
+	}
+	for _, history := range histories {
+		if (&models.User{Password: history.Password}).CheckPassword(password) {
+			return fmt.Errorf("password must differ from the last %d passwords", size)
+		}
+	}
+	return nil
+}
+
+// validate and set a new password. The caller saves a new user itself and an
+// existing one with SavePassword, so the old hash moves to the history
+func (s *PasswordPolicyService) SetPassword(user *models.User, password string) error {
+	if err := s.Validate(user, password); err != nil {
+		return err
+	}
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+	now := time.Now()
+	user.PasswordChangedAt = &now
+	return nil
+}
+
+// save the user after SetPassword, previous is the hash it replaced and goes to the
+// history in the same transaction
+func (s *PasswordPolicyService) SavePassword(user *models.User, previous string) error {
+	size := config.GetAppConfig().Password.HistorySize
+	if previous == "" || size <= 1 {
+		return s.userRepo.UpdatePassword(user, nil, 0)
+	}
+	return s.userRepo.UpdatePassword(user, &models.PasswordHistory{
+		UserId:   user.Id,
+		Password: previous,
+	}, size-1)
+}
+
+// the local password is older than password.maxAge and must be changed
+func (s *PasswordPolicyService) IsExpired(user *models.User) bool {
+	maxAge := config.GetAppConfig().Password.MaxAge
+	if maxAge <= 0 || !user.IsLocal() {
+		return false
+	}
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	return time.Since(changedAt) > time.Duration(maxAge)*24*time.Hour
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/logger"
+	"bpf.com/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// last used time is written at most once per interval
+const tokenLastUsedInterval = time.Minute
+
+// personal access token service interface
+type IPersonalAccessTokenService interface {
+	Create(userId uint64, name string, scopes []string, expiresInDays int) (string, *models.PersonalAccessToken, error)
+	List(userId uint64) ([]*models.PersonalAccessToken, error)
+	Revoke(userId, tokenId uint64) error
+	Authenticate(token string) (*models.PersonalAccessToken, *models.User, error)
+}
+
+// implements IPersonalAccessTokenService
+type PersonalAccessTokenService struct {
+	tokenRepo   repository.IPersonalAccessTokenRepository
+	userRepo    repository.IUserRepository
+	userService IUserService
+}
+
+// create PersonalAccessTokenService
+func NewPersonalAccessTokenService() IPersonalAccessTokenService {
+	return &PersonalAccessTokenService{
+		tokenRepo:   repository.NewPersonalAccessTokenRepository(),
+		userRepo:    repository.NewUserRepository(),
+		userService: NewUserService(),
+	}
+}
+
+// create a token, scopes are capped at what the user's role allows
+func (s *PersonalAccessTokenService) Create(userId uint64, name string, scopes []string, expiresInDays int) (string, *models.PersonalAccessToken, error) {
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	var granted models.Permissions
+	for _, scope := range scopes {
+		allowed, err := s.userService.HasPermission(userId, scope)
+		if err != nil {
+			return "", nil, err
+		}
+		if !allowed {
+			return "", nil, errors.New("scope not allowed by your role: " + scope)
+		}
+		granted.AddPermission(scope)
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	token := models.PersonalAccessTokenPrefix + secret
+	record := &models.PersonalAccessToken{
+		UserId:    userId,
+		Name:      name,
+		Prefix:    token[:len(models.PersonalAccessTokenPrefix)+6],
+		TokenHash: utils.HashToken(token),
+		Scopes:    granted,
+	}
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		record.ExpiresAt = &expiresAt
+	}
+	if err := s.tokenRepo.Create(record); err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// list tokens of a user
+func (s *PersonalAccessTokenService) List(userId uint64) ([]*models.PersonalAccessToken, error) {
+	return s.tokenRepo.ListByUser(userId)
+}
+
+// revoke a token of a user
+func (s *PersonalAccessTokenService) Revoke(userId, tokenId uint64) error {
+	revoked, err := s.tokenRepo.Revoke(tokenId, userId)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.New("token does not exist")
+	}
+	return nil
+}
+
+// resolve a presented token to its record and active owner
+func (s *PersonalAccessTokenService) Authenticate(token string) (*models.PersonalAccessToken, *models.User, error) {
+	record, err := s.tokenRepo.FindByHash(utils.HashToken(token))
+	if err != nil || !record.IsValid() {
+		return nil, nil, errors.New("invalid access token")
+	}
+	user, err := s.userRepo.FindById(record.UserId)
+	if err != nil {
+		return nil, nil, errors.New("user does not exist")
+	}
+	if !user.IsActive() {
+		return nil, nil, errors.New("user disabled")
+	}
+	if err := s.tokenRepo.TouchLastUsed(record.Id, tokenLastUsedInterval); err != nil {
+		logger.GetLogger().Error("update token last used fail", zap.Error(err))
+	}
+	return record, user, nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"bpf.com/internal/models"
+	"bpf.com/pkg/logger"
+	"bpf.com/pkg/policy"
+	"go.uber.org/zap"
+)
+
+// suffix of permissions granted on owned resources only
+const ownSuffix = ":own"
+
+// outcome of a policy check, Owner is set when only the :own permission allowed it
+type Access struct {
+	Allowed bool
+	Owner   bool
+	Rule    string
+}
+
+// policy service interface
+type IPolicyService interface {
+	Authorize(principal *models.Principal, permission string, resource, env map[string]interface{}) Access
+}
+
+// implements IPolicyService
+type PolicyService struct {
+	principalService IPrincipalService
+}
+
+// create PolicyService
+func NewPolicyService() IPolicyService {
+	return &PolicyService{
+		principalService: NewPrincipalService(),
+	}
+}
+
+// check a permission on a resource, resource may be nil for routes without one.
+// Policy rules are checked first, then the role permissions, and at last the
+// :own variant of the permission when the user owns the resource
+func (s *PolicyService) Authorize(principal *models.Principal, permission string, resource, env map[string]interface{}) Access {
+	input := policy.Input{
+		Subject:  subjectAttributes(principal),
+		Resource: resource,
+		Env:      env,
+	}
+	switch decision, rule := policy.Evaluate(permission, input); decision {
+	case policy.Denied:
+		logger.GetLogger().Info("policy denied", zap.String("rule", rule),
+			zap.Uint64("userId", principal.UserId), zap.String("permission", permission))
+		return Access{Rule: rule}
+	case policy.Allowed:
+		return Access{Allowed: true, Rule: rule}
+	}
+	if s.holds(principal, permission) {
+		return Access{Allowed: true}
+	}
+	own := permission + ownSuffix
+	if resource == nil || !policy.IsOwner(input) || !s.holds(principal, own) {
+		return Access{}
+	}
+	if decision, rule := policy.Evaluate(own, input); decision == policy.Denied {
+		logger.GetLogger().Info("policy denied", zap.String("rule", rule),
+			zap.Uint64("userId", principal.UserId), zap.String("permission", own))
+		return Access{Rule: rule}
+	}
+	return Access{Allowed: true, Owner: true}
+}
+
+// a failed lookup grants nothing
+func (s *PolicyService) holds(principal *models.Principal, permission string) bool {
+	allowed, err := s.principalService.HasPermission(principal, permission)
+	if err != nil {
+		logger.GetLogger().Error("permission check fail", zap.Error(err))
+		return false
+	}
+	return allowed
+}
+
+// attributes of the user rules can refer to as subject.<key>, roles include the inherited ones
+func subjectAttributes(principal *models.Principal) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             principal.UserId,
+		"username":       principal.Username,
+		"email":          principal.Email,
+		"status":         principal.Status,
+		"roles":          principal.Roles,
+		"auth_source":    principal.AuthSource,
+		"email_verified": principal.EmailVerified,
+		"mfa_enabled":    principal.MfaEnabled,
+	}
+}
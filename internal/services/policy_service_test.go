@@ -0,0 +1,80 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/policy"
+	"bpf.com/pkg/tenant"
+)
+
+const testPolicies = `
+rules:
+  - name: directory-profiles
+    effect: deny
+    permissions: ["user:update:own"]
+    when: ["subject.auth_source == 'ldap'"]
+  - name: verified-readers
+    effect: allow
+    permissions: ["user:read"]
+    when: ["subject.email_verified == true", "subject.roles contains 'reader'"]
+`
+
+func usePolicies(t *testing.T, rules string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { policy.Load("") })
+	if err := policy.Load(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	f := setup(t)
+	usePolicies(t, testPolicies)
+	f.role(t, "member", nil, models.PermUserUpdateOwn)
+	f.role(t, "reader", nil)
+	alice := f.user(t, tenant.Default, "alice", "member")
+	ldapUser := f.user(t, tenant.Default, "directory", "member")
+	if err := f.db.Model(ldapUser).Update("auth_source", models.AuthSourceLdap).Error; err != nil {
+		t.Fatal(err)
+	}
+	reader := f.user(t, tenant.Default, "reader", "reader")
+	admin := f.user(t, tenant.Default, "admin", models.RoleAdmin)
+
+	owned := func(user *models.User) map[string]interface{} {
+		return map[string]interface{}{"owner_id": user.Id}
+	}
+	tests := []struct {
+		name       string
+		user       *models.User
+		permission string
+		resource   map[string]interface{}
+		want       Access
+	}{
+		{"role permission", admin, models.PermUserUpdate, owned(alice), Access{Allowed: true}},
+		{"own resource", alice, models.PermUserUpdate, owned(alice), Access{Allowed: true, Owner: true}},
+		{"resource of another user", alice, models.PermUserUpdate, owned(admin), Access{}},
+		{"own permission needs a resource", alice, models.PermUserUpdate, nil, Access{}},
+		{"own permission only covers its own action", alice, models.PermUserDelete, owned(alice), Access{}},
+		{"deny rule on the own permission", ldapUser, models.PermUserUpdate, owned(ldapUser), Access{Rule: "directory-profiles"}},
+		{"allow rule without the permission", reader, models.PermUserRead, owned(alice), Access{Allowed: true, Rule: "verified-readers"}},
+	}
+	principals := NewPrincipalService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := principals.Load(tt.user.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := NewPolicyService().Authorize(principal, tt.permission, tt.resource, nil); got != tt.want {
+				t.Errorf("Authorize(%s, %q) = %+v, want %+v", tt.user.Username, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const defaultPrincipalCacheExp = 10
+
+// principal service interface
+type IPrincipalService interface {
+	Load(userId uint64) (*models.Principal, error)
+	HasPermission(principal *models.Principal, permission string) (bool, error)
+	HasRole(principal *models.Principal, roleCode string) (bool, error)
+	Invalidate(userId uint64)
+	InvalidateRole(roleId uint64)
+}
+
+// implements IPrincipalService, principals are cached in redis
+type PrincipalService struct {
+	userRepo repository.IUserRepository
+	roleRepo repository.IRoleRepository
+}
+
+// create PrincipalService
+func NewPrincipalService() IPrincipalService {
+	return &PrincipalService{
+		userRepo: repository.NewUserRepository(),
+		roleRepo: repository.NewRoleRepository(),
+	}
+}
+
+// versioned, a change of the principal layout moves to a new key instead of reading stale entries
+func principalKey(userId uint64) string {
+	return "principal:v2:" + strconv.FormatUint(userId, 10)
+}
+
+func principalCacheExp() time.Duration {
+	exp := config.GetAppConfig().Auth.PrincipalCacheExp
+	if exp <= 0 {
+		exp = defaultPrincipalCacheExp
+	}
+	return exp * time.Minute
+}
+
+// principal from the cache, built from the user and its roles on a miss.
+// The cache is only a shortcut, redis failures fall back to the database
+func (s *PrincipalService) Load(userId uint64) (*models.Principal, error) {
+	ctx := context.Background()
+	var principal models.Principal
+	if err := cache.GetGlobalCache().Get(ctx, principalKey(userId), &principal); err == nil {
+		return &principal, nil
+	}
+	user, err := s.userRepo.FindById(userId)
+	if err != nil {
+		return nil, err
+	}
+	built := models.NewPrincipal(user)
+	if err := cache.GetGlobalCache().Set(ctx, principalKey(userId), built, principalCacheExp()); err != nil {
+		logger.GetLogger().Error("cache principal fail", zap.Uint64("userId", userId), zap.Error(err))
+	}
+	return built, nil
+}
+
+// unverified users are restricted first, then casbin or the role permissions decide
+func (s *PrincipalService) HasPermission(principal *models.Principal, permission string) (bool, error) {
+	if !unverifiedAllowed(principal.EmailVerified, permission) {
+		return false, nil
+	}
+	if CasbinEnabled() {
+		return casbinHasPermission(principal.UserId, principal.TenantId, permission)
+	}
+	return principal.HasPermission(permission), nil
+}
+
+// casbin groupings decide when casbin is enabled
+func (s *PrincipalService) HasRole(principal *models.Principal, roleCode string) (bool, error) {
+	if CasbinEnabled() {
+		return casbinHasRole(principal.UserId, principal.TenantId, roleCode)
+	}
+	return principal.HasRole(roleCode), nil
+}
+
+// drop the cached principal after the user, its roles or its status changed
+func (s *PrincipalService) Invalidate(userId uint64) {
+	if err := cache.GetGlobalCache().Delete(context.Background(), principalKey(userId)); err != nil {
+		logger.GetLogger().Error("invalidate principal fail", zap.Uint64("userId", userId), zap.Error(err))
+	}
+}
+
+// drop the principals of every user holding the role or a role inheriting from it
+func (s *PrincipalService) InvalidateRole(roleId uint64) {
+	roles, err := s.roleRepo.List()
+	if err != nil {
+		logger.GetLogger().Error("invalidate role principals fail", zap.Uint64("roleId", roleId), zap.Error(err))
+		return
+	}
+	children := make(map[uint64][]uint64, len(roles))
+	for _, role := range roles {
+		if role.ParentId != nil {
+			children[*role.ParentId] = append(children[*role.ParentId], role.Id)
+		}
+	}
+	seen := map[uint64]bool{}
+	queue := []uint64{roleId}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		queue = append(queue, children[id]...)
+		userIds, err := s.roleRepo.ListUserIds(id)
+		if err != nil {
+			logger.GetLogger().Error("invalidate role principals fail", zap.Uint64("roleId", id), zap.Error(err))
+			continue
+		}
+		for _, userId := range userIds {
+			s.Invalidate(userId)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"testing"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/tenant"
+)
+
+// a role of the default organization inheriting from the parent
+func (f *fixture) role(t *testing.T, code string, parent *models.Role, permissions ...string) *models.Role {
+	t.Helper()
+	role := &models.Role{TenantId: tenant.Default, Name: code, Code: code, Permissions: models.Permissions(permissions)}
+	if parent != nil {
+		role.ParentId = &parent.Id
+	}
+	if err := f.db.Create(role).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.roles[tenant.Default][code] = role
+	return role
+}
+
+func TestPrincipalPermissions(t *testing.T) {
+	f := setup(t)
+	member := f.role(t, "member", nil, models.PermUserView)
+	f.role(t, "editor", member, "content:*", models.PermUserManage)
+	f.role(t, "author", nil, "content:*:own")
+	editor := f.user(t, tenant.Default, "editor", "editor")
+	author := f.user(t, tenant.Default, "author", "author")
+	principals := NewPrincipalService()
+
+	tests := []struct {
+		name       string
+		user       *models.User
+		permission string
+		want       bool
+	}{
+		{"own permission", editor, models.PermUserManage, true},
+		{"inherited from the parent role", editor, models.PermUserView, true},
+		{"module wildcard", editor, models.PermContentDelete, true},
+		{"module wildcard covers own permissions", editor, models.PermContentEditOwn, true},
+		{"implied permission", editor, models.PermUserUpdate, true},
+		{"implied by an implied permission", editor, models.PermUserUpdateOwn, true},
+		{"not granted", editor, models.PermUserDelete, false},
+		{"other module", editor, models.PermSystemConfig, false},
+		{"segment wildcard", author, models.PermContentEditOwn, true},
+		{"segment wildcard needs the segment", author, models.PermContentEdit, false},
+		{"no parent role", author, models.PermUserView, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := principals.Load(tt.user.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := principals.HasPermission(principal, tt.permission)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("HasPermission(%s, %q) = %v, want %v", tt.user.Username, tt.permission, got, tt.want)
+			}
+		})
+	}
+
+	principal, err := principals.Load(editor.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := principals.HasRole(principal, "member"); !ok {
+		t.Error("HasRole() = false for the inherited role")
+	}
+}
+
+// a changed parent reaches the cached principals of users holding a child role
+func TestInvalidateRole(t *testing.T) {
+	f := setup(t)
+	member := f.role(t, "member", nil, models.PermUserView)
+	f.role(t, "editor", member, models.PermContentEdit)
+	editor := f.user(t, tenant.Default, "editor", "editor")
+	principals := NewPrincipalService()
+	if _, err := principals.Load(editor.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	member.Permissions = models.Permissions{models.PermUserView, models.PermUserList}
+	if err := f.db.Save(member).Error; err != nil {
+		t.Fatal(err)
+	}
+	principal, err := principals.Load(editor.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.HasPermission(models.PermUserList) {
+		t.Fatal("the principal was not cached")
+	}
+	principals.InvalidateRole(member.Id)
+	principal, err = principals.Load(editor.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !principal.HasPermission(models.PermUserList) {
+		t.Error("InvalidateRole() left the principal of a child role cached")
+	}
+}
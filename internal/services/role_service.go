@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	perm "bpf.com/pkg/permission"
+	"bpf.com/pkg/tenant"
+)
+
+// role service interface
+type IRoleService interface {
+	WithContext(ctx context.Context) IRoleService
+	ListRoles() ([]*models.Role, error)
+	GetRoleById(roleId uint64) (*models.Role, error)
+	CreateRole(role *models.Role) error
+	UpdateRole(role *models.Role) error
+	DeleteRole(roleId uint64) error
+	AddPermission(roleId uint64, permission string) (*models.Role, error)
+	RemovePermission(roleId uint64, permission string) (*models.Role, error)
+	SetMagicLinkEnabled(roleId uint64, enabled bool) (*models.Role, error)
+	CheckPermissions() error
+}
+
+// implements IRoleService
+type RoleService struct {
+	ctx              context.Context
+	roleRepo         repository.IRoleRepository
+	deptRepo         repository.IDepartmentRepository
+	principalService IPrincipalService
+}
+
+// Create RoleService
+func NewRoleService() IRoleService {
+	return &RoleService{
+		ctx:              context.Background(),
+		roleRepo:         repository.NewRoleRepository(),
+		deptRepo:         repository.NewDepartmentRepository(),
+		principalService: NewPrincipalService(),
+	}
+}
+
+// service working on the roles of the tenant of ctx, unscoped contexts see every
+// organization and create roles in the default one
+func (s *RoleService) WithContext(ctx context.Context) IRoleService {
+	return &RoleService{
+		ctx:              ctx,
+		roleRepo:         s.roleRepo.WithContext(ctx),
+		deptRepo:         s.deptRepo.WithContext(ctx),
+		principalService: s.principalService,
+	}
+}
+
+// repository of the organization owning the role, names, codes and parents are checked within it
+func (s *RoleService) tenantRepo(tenantId uint64) repository.IRoleRepository {
+	return s.roleRepo.WithContext(tenant.WithTenant(s.ctx, tenantId))
+}
+
+// organization new records of the service go to
+func tenantOf(ctx context.Context) uint64 {
+	if tenantId, ok := tenant.FromContext(ctx); ok {
+		return tenantId
+	}
+	return tenant.Default
+}
+
+// built-in role codes are referenced by routes and seeding, they can not be renamed
+func isBuiltinRole(code string) bool {
+	switch code {
+	case models.RoleSuperuser, models.RoleAdmin, models.RoleUser, models.RoleGuest:
+		return true
+	default:
+		return false
+	}
+}
+
+// role codes are casbin subjects as role:<code>, codes that read as a user id
+// or carry a separator are refused so they can not be mistaken for another subject
+func checkRoleCode(code string) error {
+	if strings.Contains(code, ":") {
+		return errors.New("role code can not contain ':'")
+	}
+	if _, err := strconv.ParseUint(code, 10, 64); err == nil {
+		return errors.New("role code can not be a number")
+	}
+	return nil
+}
+
+// roles given to self registered users of the organization
+func defaultRoles(roleRepo repository.IRoleRepository, tenantId uint64) ([]*models.Role, error) {
+	role, err := roleRepo.WithContext(tenant.WithTenant(context.Background(), tenantId)).FindByCode(models.RoleUser)
+	if err != nil {
+		return nil, errors.New("default role does not exist")
+	}
+	return []*models.Role{role}, nil
+}
+
+// Find role list
+func (s *RoleService) ListRoles() ([]*models.Role, error) {
+	return s.roleRepo.List()
+}
+
+// Find role by Id
+func (s *RoleService) GetRoleById(roleId uint64) (*models.Role, error) {
+	return s.roleRepo.FindById(roleId)
+}
+
+// find a role that may be changed, the superuser role is read-only
+func (s *RoleService) findEditable(roleId uint64) (*models.Role, error) {
+	role, err := s.roleRepo.FindById(roleId)
+	if err != nil {
+		return nil, errors.New("role does not exist")
+	}
+	if role.Code == models.RoleSuperuser {
+		return nil, errors.New("superuser role can not be changed")
+	}
+	return role, nil
+}
+
+// Create role
+func (s *RoleService) CreateRole(role *models.Role) error {
+	if role.Code == models.RoleSuperuser {
+		return errors.New("role code already exist")
+	}
+	if err := checkRoleCode(role.Code); err != nil {
+		return err
+	}
+	role.TenantId = tenantOf(s.ctx)
+	roleRepo := s.tenantRepo(role.TenantId)
+	if existsRole, _ := roleRepo.FindByCode(role.Code); existsRole != nil {
+		return errors.New("role code already exist")
+	}
+	if existsRole, _ := roleRepo.FindByName(role.Name); existsRole != nil {
+		return errors.New("role name already exist")
+	}
+	permissions, err := cleanPermissions(role.Permissions)
+	if err != nil {
+		return err
+	}
+	role.Permissions = permissions
+	if err := s.checkParent(roleRepo, role); err != nil {
+		return err
+	}
+	if err := s.checkDataScope(role); err != nil {
+		return err
+	}
+	if err := roleRepo.Create(role); err != nil {
+		return err
+	}
+	syncCasbinRole(role, "")
+	return nil
+}
+
+// Update role name, code, description and permissions
+func (s *RoleService) UpdateRole(role *models.Role) error {
+	existingRole, err := s.findEditable(role.Id)
+	if err != nil {
+		return err
+	}
+	roleRepo := s.tenantRepo(existingRole.TenantId)
+	if role.Code != existingRole.Code {
+		if isBuiltinRole(existingRole.Code) || role.Code == models.RoleSuperuser {
+			return errors.New("built-in role code can not be changed")
+		}
+		if err := checkRoleCode(role.Code); err != nil {
+			return err
+		}
+		if conflictRole, _ := roleRepo.FindByCode(role.Code); conflictRole != nil {
+			return errors.New("role code already exist")
+		}
+	}
+	if role.Name != existingRole.Name {
+		if conflictRole, _ := roleRepo.FindByName(role.Name); conflictRole != nil {
+			return errors.New("role name already exist")
+		}
+	}
+	permissions, err := cleanPermissions(role.Permissions)
+	if err != nil {
+		return err
+	}
+	oldCode := existingRole.Code
+	existingRole.Name = role.Name
+	existingRole.Code = role.Code
+	existingRole.Description = role.Description
+	existingRole.Permissions = permissions
+	existingRole.ParentId = role.ParentId
+	existingRole.DataScope = role.DataScope
+	existingRole.DataScopeDepts = role.DataScopeDepts
+	if err := s.checkParent(roleRepo, existingRole); err != nil {
+		return err
+	}
+	if err := s.checkDataScope(existingRole); err != nil {
+		return err
+	}
+	if err := s.roleRepo.Update(existingRole); err != nil {
+		return err
+	}
+	syncCasbinRole(existingRole, oldCode)
+	s.principalService.InvalidateRole(existingRole.Id)
+	*role = *existingRole
+	return nil
+}
+
+// Delete role, only when no user holds it and no role inherits from it.
+// Built-in roles are kept, registration and signup hand out the user role
+func (s *RoleService) DeleteRole(roleId uint64) error {
+	role, err := s.findEditable(roleId)
+	if err != nil {
+		return err
+	}
+	if isBuiltinRole(role.Code) {
+		return errors.New("built-in role can not be deleted")
+	}
+	count, err := s.roleRepo.CountUsers(role.Id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("role is still assigned to users")
+	}
+	count, err = s.roleRepo.CountChildren(role.Id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("role is still inherited by other roles")
+	}
+	if err := s.roleRepo.Delete(role.Id); err != nil {
+		return err
+	}
+	removeCasbinRole(role)
+	return nil
+}
+
+// the parent has to exist in the organization of the role, can not be the superuser role
+// and must not lead back to the role
+func (s *RoleService) checkParent(roleRepo repository.IRoleRepository, role *models.Role) error {
+	role.Parent = nil
+	if role.ParentId == nil {
+		return nil
+	}
+	parent, err := roleRepo.FindById(*role.ParentId)
+	if err != nil {
+		return errors.New("parent role does not exist")
+	}
+	if parent.Code == models.RoleSuperuser {
+		return errors.New("superuser role can not be inherited")
+	}
+	depth := 1
+	for ancestor := parent; ancestor != nil && depth <= models.MaxRoleDepth; ancestor = ancestor.Parent {
+		if role.Id != 0 && ancestor.Id == role.Id {
+			return errors.New("role inheritance can not form a cycle")
+		}
+		depth++
+	}
+	if depth > models.MaxRoleDepth {
+		return errors.New("role inheritance is too deep")
+	}
+	role.Parent = parent
+	return nil
+}
+
+// empty means all, custom scopes need departments of the organization of the role
+// and only custom scopes keep them
+func (s *RoleService) checkDataScope(role *models.Role) error {
+	switch role.DataScope {
+	case "":
+		role.DataScope = models.DataScopeAll
+	case models.DataScopeAll, models.DataScopeDept, models.DataScopeDeptAndBelow, models.DataScopeSelf, models.DataScopeCustom:
+	default:
+		return errors.New("invalid data scope")
+	}
+	if role.DataScope != models.DataScopeCustom {
+		role.DataScopeDepts = nil
+		return nil
+	}
+	unique := uniqueIds(role.DataScopeDepts)
+	if len(unique) == 0 {
+		return errors.New("custom data scope needs departments")
+	}
+	depts, err := s.deptRepo.WithContext(tenant.WithTenant(s.ctx, role.TenantId)).FindByIds(role.DataScopeDepts)
+	if err != nil {
+		return err
+	}
+	if len(depts) != len(unique) {
+		return errors.New("department does not exist")
+	}
+	role.DataScopeDepts = models.DepartmentIds{}
+	for _, dept := range depts {
+		role.DataScopeDepts = append(role.DataScopeDepts, dept.Id)
+	}
+	return nil
+}
+
+// Add a permission to a role
+func (s *RoleService) AddPermission(roleId uint64, permission string) (*models.Role, error) {
+	role, err := s.findEditable(roleId)
+	if err != nil {
+		return nil, err
+	}
+	permission = strings.TrimSpace(permission)
+	if err := perm.Validate(permission); err != nil {
+		return nil, err
+	}
+	role.AddPermission(permission)
+	if err := s.roleRepo.Update(role); err != nil {
+		return nil, err
+	}
+	syncCasbinRole(role, "")
+	s.principalService.InvalidateRole(role.Id)
+	return role, nil
+}
+
+// Remove a permission from a role
+func (s *RoleService) RemovePermission(roleId uint64, permission string) (*models.Role, error) {
+	role, err := s.findEditable(roleId)
+	if err != nil {
+		return nil, err
+	}
+	if !role.Permissions.Contains(permission) {
+		return nil, errors.New("role does not have the permission")
+	}
+	role.RemovePermission(permission)
+	if err := s.roleRepo.Update(role); err != nil {
+		return nil, err
+	}
+	syncCasbinRole(role, "")
+	s.principalService.InvalidateRole(role.Id)
+	return role, nil
+}
+
+// switch magic link login for the members of a role
+func (s *RoleService) SetMagicLinkEnabled(roleId uint64, enabled bool) (*models.Role, error) {
+	role, err := s.findEditable(roleId)
+	if err != nil {
+		return nil, err
+	}
+	role.MagicLinkEnabled = enabled
+	if err := s.roleRepo.Update(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// check every stored role only holds declared permissions
+func (s *RoleService) CheckPermissions() error {
+	roles, err := s.roleRepo.List()
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if err := perm.Validate(role.Permissions...); err != nil {
+			return fmt.Errorf("role %s holds an %w", role.Code, err)
+		}
+	}
+	return nil
+}
+
+// trim, check and deduplicate a permission list, never nil so the json column is not null
+func cleanPermissions(permissions models.Permissions) (models.Permissions, error) {
+	cleaned := models.Permissions{}
+	for _, permission := range permissions {
+		permission = strings.TrimSpace(permission)
+		if err := perm.Validate(permission); err != nil {
+			return nil, err
+		}
+		cleaned.AddPermission(permission)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/database"
+	"bpf.com/pkg/datascope"
+	"bpf.com/pkg/logger"
+	"bpf.com/pkg/mailer"
+	"bpf.com/pkg/tenant"
+	"bpf.com/pkg/utils"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// organization next to the default one, for the tenant isolation cases
+const otherTenant uint64 = 2
+
+const testPassword = "Correct-Horse-42"
+
+// the seeded organizations, roles and users of a test
+type fixture struct {
+	redis *miniredis.Miniredis
+	db    *gorm.DB
+	roles map[uint64]map[string]*models.Role
+}
+
+// services of one test run against an in-memory sqlite database and a miniredis
+// server, the config is reset to test values and restored afterwards
+func setup(t *testing.T) *fixture {
+	t.Helper()
+	if logger.Log == nil {
+		logger.Log = zap.NewNop()
+	}
+	cfg := config.GetAppConfig()
+	saved := *cfg
+	t.Cleanup(func() { *cfg = saved })
+
+	redis := miniredis.RunT(t)
+	cfg.Cache = config.CacheConfig{Host: redis.Host(), Port: redis.Server().Addr().Port, DialTimeout: 1, ReadTimeout: 1, WriteTimeout: 1}
+	cfg.JWT = config.JWTConfig{Secret: "test-secret", AccessTokenExp: 15, RefreshTokenExp: 60, TokenIssuer: "test", RefreshTokenSize: 32}
+	cfg.Mfa = config.MfaConfig{Issuer: "test", PendingTokenExp: 5, MaxAttempts: 5, RecoveryCodeCount: 4}
+	cfg.Mail = config.MailConfig{Driver: "log", LogDir: t.TempDir()}
+	cfg.Auth = config.AuthConfig{
+		LinkSecret:         "test-link-secret-of-at-least-32-characters",
+		UnverifiedPolicy:   "allow",
+		MaxLoginFailures:   3,
+		LoginFailureWindow: 15,
+		LockoutDuration:    15,
+		Authenticators:     []string{"local"},
+		PrincipalCacheExp:  10,
+	}
+	cfg.OAuth = config.OAuthConfig{CodeExp: 1}
+	cfg.Password = config.PasswordConfig{Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1}
+	cfg.Casbin = config.CasbinConfig{}
+	if err := cache.InitRedisCache(); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.InitKeyRing(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mailer.InitMailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//every connection of an in-memory database is a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := tenant.Register(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := datascope.Register(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(
+		&models.Organization{},
+		&models.Department{},
+		&models.User{},
+		&models.Role{},
+		&models.RefreshToken{},
+		&models.MfaRecoveryCode{},
+		&models.PasswordReset{},
+		&models.PersonalAccessToken{},
+		&models.Session{},
+		&models.UserIdentity{},
+		&models.OAuthClient{},
+		&models.OAuthConsent{},
+		&models.PasswordHistory{},
+		&models.ImpersonationLog{},
+		&models.MagicLink{},
+		&models.CasbinRule{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	savedDB := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = savedDB })
+
+	f := &fixture{redis: redis, db: db, roles: map[uint64]map[string]*models.Role{}}
+	for _, org := range []*models.Organization{
+		{Name: "default", Code: "default"},
+		{Name: "other", Code: "other"},
+	} {
+		if err := db.Create(org).Error; err != nil {
+			t.Fatal(err)
+		}
+		f.roles[org.Id] = map[string]*models.Role{}
+		codes := []string{models.RoleAdmin, models.RoleUser, models.RoleGuest}
+		if org.Id == tenant.Default {
+			codes = append(codes, models.RoleSuperuser)
+		}
+		for _, code := range codes {
+			role := &models.Role{TenantId: org.Id, Name: code, Code: code, Permissions: models.Permissions{}}
+			if code == models.RoleAdmin || code == models.RoleSuperuser {
+				role.Permissions = models.Permissions{models.PermAll}
+			}
+			if err := db.Create(role).Error; err != nil {
+				t.Fatal(err)
+			}
+			f.roles[org.Id][code] = role
+		}
+	}
+	return f
+}
+
+// an active, verified user of the organization holding the roles
+func (f *fixture) user(t *testing.T, tenantId uint64, username string, roleCodes ...string) *models.User {
+	t.Helper()
+	verifiedAt := time.Now()
+	user := &models.User{
+		TenantId:        tenantId,
+		Username:        username,
+		Email:           username + "@example.org",
+		Status:          models.StatusActive,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	for _, code := range roleCodes {
+		user.Roles = append(user.Roles, f.roles[tenantId][code])
+	}
+	if err := user.SetPassword(testPassword); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// request context of the user as the middleware builds it: the user as caller, its data
+// scope and its organization, platform admins work across organizations
+func (f *fixture) as(t *testing.T, user *models.User) context.Context {
+	t.Helper()
+	principal, err := NewPrincipalService().Load(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := datascope.WithScope(models.WithCaller(context.Background(), principal), principal.DataScope)
+	if principal.IsPlatformAdmin() {
+		return ctx
+	}
+	return tenant.WithTenant(ctx, principal.TenantId)
+}
+
+func (f *fixture) reload(t *testing.T, userId uint64) *models.User {
+	t.Helper()
+	user, err := NewUserService().GetUserById(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func roleCodes(user *models.User) map[string]bool {
+	codes := map[string]bool{}
+	for _, code := range user.RoleCodes() {
+		codes[code] = true
+	}
+	return codes
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+)
+
+// last seen time is written at most once per interval
+const sessionSeenInterval = time.Minute
+
+// device the request comes from
+type ClientInfo struct {
+	Ip        string
+	UserAgent string
+}
+
+// session service interface
+type ISessionService interface {
+	Create(userId uint64, familyId string, client ClientInfo, expiresAt time.Time) error
+	Rotated(familyId string, client ClientInfo, expiresAt time.Time) error
+	Touch(familyId, ip string) error
+	List(userId uint64) ([]*models.Session, error)
+	Revoke(userId, sessionId uint64) error
+	RevokeFamily(familyId string) error
+	IsRevoked(familyId string) (bool, error)
+}
+
+// implements ISessionService
+type SessionService struct {
+	sessionRepo      repository.ISessionRepository
+	refreshTokenRepo repository.IRefreshTokenRepository
+}
+
+// create SessionService
+func NewSessionService() ISessionService {
+	return &SessionService{
+		sessionRepo:      repository.NewSessionRepository(),
+		refreshTokenRepo: repository.NewRefreshTokenRepository(),
+	}
+}
+
+// key marking the access tokens of a session as revoked
+func sessionRevokedKey(familyId string) string {
+	return "session-revoked:" + familyId
+}
+
+// record the session of a new login
+func (s *SessionService) Create(userId uint64, familyId string, client ClientInfo, expiresAt time.Time) error {
+	userAgent := client.UserAgent
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	return s.sessionRepo.Create(&models.Session{
+		UserId:     userId,
+		FamilyId:   familyId,
+		UserAgent:  userAgent,
+		Ip:         client.Ip,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  expiresAt,
+	})
+}
+
+// the refresh token of the session rotated
+func (s *SessionService) Rotated(familyId string, client ClientInfo, expiresAt time.Time) error {
+	return s.sessionRepo.Touch(familyId, client.Ip, &expiresAt)
+}
+
+// update last seen time of a session, throttled through redis
+func (s *SessionService) Touch(familyId, ip string) error {
+	if familyId == "" {
+		return nil
+	}
+	count, err := cache.GetGlobalCache().Incr(context.Background(), "session-seen:"+familyId, sessionSeenInterval)
+	if err != nil || count > 1 {
+		return err
+	}
+	return s.sessionRepo.Touch(familyId, ip, nil)
+}
+
+// live sessions of a user
+func (s *SessionService) List(userId uint64) ([]*models.Session, error) {
+	return s.sessionRepo.ListActiveByUser(userId)
+}
+
+// revoke a session of the user
+func (s *SessionService) Revoke(userId, sessionId uint64) error {
+	session, err := s.sessionRepo.FindById(sessionId)
+	if err != nil || session.UserId != userId {
+		return errors.New("session does not exist")
+	}
+	return s.RevokeFamily(session.FamilyId)
+}
+
+// revoke the session, its refresh tokens and its live access tokens
+func (s *SessionService) RevokeFamily(familyId string) error {
+	if err := s.sessionRepo.Revoke(familyId); err != nil {
+		return err
+	}
+	if err := s.refreshTokenRepo.RevokeFamily(familyId); err != nil {
+		return err
+	}
+	ttl := time.Duration(config.GetAppConfig().JWT.AccessTokenExp) * time.Minute
+	return cache.GetGlobalCache().Set(context.Background(), sessionRevokedKey(familyId), true, ttl)
+}
+
+// check whether the access tokens of a session were revoked
+func (s *SessionService) IsRevoked(familyId string) (bool, error) {
+	if familyId == "" {
+		return false, nil
+	}
+	return cache.GetGlobalCache().Exists(context.Background(), sessionRevokedKey(familyId))
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"bpf.com/internal/repository"
+	"bpf.com/pkg/cache"
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/utils"
+)
+
+// token revocation interface
+type ITokenService interface {
+	RevokeAccessToken(claims *utils.JWTClaims) error
+	RevokeRefreshFamily(userId uint64, refreshToken string) error
+	RevokeUserTokens(userId uint64) error
+	IsAccessTokenRevoked(claims *utils.JWTClaims) (bool, error)
+}
+
+// implements ITokenService
+type TokenService struct {
+	refreshTokenRepo repository.IRefreshTokenRepository
+	sessionRepo      repository.ISessionRepository
+}
+
+// create TokenService
+func NewTokenService() ITokenService {
+	return &TokenService{
+		refreshTokenRepo: repository.NewRefreshTokenRepository(),
+		sessionRepo:      repository.NewSessionRepository(),
+	}
+}
+
+// denylist key of a single access token
+func denylistKey(jti string) string {
+	return "token-denylist:" + jti
+}
+
+// key holding the unix second from which on tokens of a user are valid again
+func revokedBeforeKey(userId uint64) string {
+	return fmt.Sprintf("token-revoked-before:%d", userId)
+}
+
+// put the access token on the denylist until it would have expired
+func (s *TokenService) RevokeAccessToken(claims *utils.JWTClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+	return cache.GetGlobalCache().Set(context.Background(), denylistKey(claims.ID), true, ttl)
+}
+
+// revoke the family the refresh token belongs to, only a token of the user itself
+func (s *TokenService) RevokeRefreshFamily(userId uint64, refreshToken string) error {
+	stored, err := s.refreshTokenRepo.FindByHash(utils.HashToken(refreshToken))
+	if err != nil {
+		return nil
+	}
+	if stored.UserId != userId {
+		return errors.New("refresh token belongs to another user")
+	}
+	if err := s.sessionRepo.Revoke(stored.FamilyId); err != nil {
+		return err
+	}
+	return s.refreshTokenRepo.RevokeFamily(stored.FamilyId)
+}
+
+// revoke every live access and refresh token of the user
+func (s *TokenService) RevokeUserTokens(userId uint64) error {
+	if err := s.refreshTokenRepo.RevokeByUser(userId); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeByUser(userId); err != nil {
+		return err
+	}
+	//access tokens issued up to now are rejected until the longest one expires. Token times
+	//are whole seconds, so the current second is rejected as a whole
+	ttl := time.Duration(config.GetAppConfig().JWT.AccessTokenExp) * time.Minute
+	return cache.GetGlobalCache().Set(context.Background(), revokedBeforeKey(userId), time.Now().Unix()+1, ttl)
+}
+
+// a token issued right after a revocation has to be issued in the following second
+func waitRevocationCutoff() {
+	now := time.Now()
+	time.Sleep(now.Truncate(time.Second).Add(time.Second).Sub(now))
+}
+
+// check the denylist, the session and the user wide revocation time
+func (s *TokenService) IsAccessTokenRevoked(claims *utils.JWTClaims) (bool, error) {
+	ctx := context.Background()
+	if claims.ID != "" {
+		denied, err := cache.GetGlobalCache().Exists(ctx, denylistKey(claims.ID))
+		if err != nil {
+			return false, err
+		}
+		if denied {
+			return true, nil
+		}
+	}
+	if claims.SessionId != "" {
+		revoked, err := cache.GetGlobalCache().Exists(ctx, sessionRevokedKey(claims.SessionId))
+		if err != nil {
+			return false, err
+		}
+		if revoked {
+			return true, nil
+		}
+	}
+	exists, err := cache.GetGlobalCache().Exists(ctx, revokedBeforeKey(claims.UserId))
+	if err != nil || !exists {
+		return false, err
+	}
+	var revokedBefore int64
+	if err := cache.GetGlobalCache().Get(ctx, revokedBeforeKey(claims.UserId), &revokedBefore); err != nil {
+		return false, err
+	}
+	if claims.IssuedAt == nil {
+		return true, nil
+	}
+	return claims.IssuedAt.Unix() < revokedBefore, nil
+}
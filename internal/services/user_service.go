@@ -1,36 +1,74 @@
 package services
 
 import (
+	"context"
 	"errors"
 
 	"bpf.com/internal/models"
 	"bpf.com/internal/repository"
+	"bpf.com/pkg/datascope"
+	"bpf.com/pkg/tenant"
 )
 
 // user service interface
 type IUserService interface {
+	WithContext(ctx context.Context) IUserService
 	GetUserById(userId uint64) (*models.User, error)
 	GetUserByUsername(username string) (*models.User, error)
 	GetUserByEmail(email string) (*models.User, error)
 	ListUsers(page, pageSize int, search string) ([]*models.User, int64, error)
-	CreateUser(user *models.User) error
-	UpdateUser(user *models.User) error
+	CreateUser(user *models.User, password string, roleIds []uint64) error
+	UpdateUser(user *models.User, roleIds []uint64) error
 	DeleteUser(userId uint64) error
+	UpdateUserStatus(userId uint64, status int) error
+	UnlockUser(userId uint64) error
 	HasPermission(userId uint64, permission string) (bool, error)
 }
 
 // implements IUserService
 type UserService struct {
+	ctx      context.Context
 	userRepo repository.IUserRepository
+	//unscoped, usernames and emails are unique across organizations
+	accountRepo   repository.IUserRepository
+	roleRepo      repository.IRoleRepository
+	deptRepo      repository.IDepartmentRepository
+	tokenService  ITokenService
+	verifyService IEmailVerificationService
+	loginGuard    ILoginGuardService
+	policyService IPasswordPolicyService
+	//principals cache roles and permissions, dropped on every change of them
+	principalService IPrincipalService
 }
 
 // Create UserService
 func NewUserService() IUserService {
+	userRepo := repository.NewUserRepository()
 	return &UserService{
-		userRepo: repository.NewUserRepository(),
+		ctx:              context.Background(),
+		userRepo:         userRepo,
+		accountRepo:      userRepo,
+		roleRepo:         repository.NewRoleRepository(),
+		deptRepo:         repository.NewDepartmentRepository(),
+		tokenService:     NewTokenService(),
+		verifyService:    NewEmailVerificationService(),
+		loginGuard:       NewLoginGuardService(),
+		policyService:    NewPasswordPolicyService(),
+		principalService: NewPrincipalService(),
 	}
 }
 
+// service working on the users of the tenant of ctx, unscoped contexts see every
+// organization and create users in the default one
+func (s *UserService) WithContext(ctx context.Context) IUserService {
+	scoped := *s
+	scoped.ctx = ctx
+	scoped.userRepo = s.accountRepo.WithContext(ctx)
+	scoped.roleRepo = s.roleRepo.WithContext(ctx)
+	scoped.deptRepo = s.deptRepo.WithContext(ctx)
+	return &scoped
+}
+
 // Find user by Id
 func (s *UserService) GetUserById(userId uint64) (*models.User, error) {
 	return s.userRepo.FindById(userId)
@@ -52,21 +90,108 @@ func (s *UserService) ListUsers(page, pageSize int, search string) ([]*models.Us
 	return s.userRepo.List(page, pageSize, search)
 }
 
-// Create User
-func (s *UserService) CreateUser(user *models.User) error {
-	existsUser1, _ := s.userRepo.FindByUsername(user.Username)
+// every role id has to exist in the organization of the user
+func (s *UserService) findRoles(tenantId uint64, roleIds []uint64) ([]*models.Role, error) {
+	roles, err := s.roleRepo.WithContext(tenant.WithTenant(s.ctx, tenantId)).FindByIds(roleIds)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 || len(roles) != len(uniqueIds(roleIds)) {
+		return nil, errors.New("role does not exist")
+	}
+	return roles, nil
+}
+
+// the department, when set, has to exist in the organization of the user
+// and be within the data scope of the caller
+func (s *UserService) checkDepartment(tenantId uint64, deptId *uint64) error {
+	if deptId == nil {
+		return nil
+	}
+	dept, err := s.deptRepo.WithContext(tenant.WithTenant(s.ctx, tenantId)).FindById(*deptId)
+	if err != nil || dept == nil {
+		return errors.New("department does not exist")
+	}
+	if scope, ok := datascope.FromContext(s.ctx); ok && !scope.CoversDepartment(dept.Id, dept.Path) {
+		return errors.New("department is outside your data scope")
+	}
+	return nil
+}
+
+// the superuser role makes a platform admin, only platform admins hand it out or take it
+// away. Nobody changes their own roles, whatever permission allowed the request
+func (s *UserService) checkRoleChange(userId uint64, current, roles []*models.Role) error {
+	caller, ok := models.CallerFromContext(s.ctx)
+	if ok && caller.UserId == userId {
+		return errors.New("can not change your own roles")
+	}
+	if hasRoleCode(current, models.RoleSuperuser) == hasRoleCode(roles, models.RoleSuperuser) {
+		return nil
+	}
+	if !ok || !caller.IsPlatformAdmin() {
+		return errors.New("only platform admins can assign or remove the superuser role")
+	}
+	return nil
+}
+
+func hasRoleCode(roles []*models.Role, code string) bool {
+	for _, role := range roles {
+		if role.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueIds(ids []uint64) map[uint64]struct{} {
+	unique := make(map[uint64]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	return unique
+}
+
+// Create User with its roles, the default roles of the organization when roleIds is empty.
+// The password has to pass the policy
+func (s *UserService) CreateUser(user *models.User, password string, roleIds []uint64) error {
+	existsUser1, _ := s.accountRepo.FindByUsername(user.Username)
 	if existsUser1 != nil {
 		return errors.New("user does not exist")
 	}
-	existsUser2, _ := s.userRepo.FindByEmail(user.Email)
+	existsUser2, _ := s.accountRepo.FindByEmail(user.Email)
 	if existsUser2 != nil {
 		return errors.New("email already exist")
 	}
-	return s.userRepo.Create(user)
+	user.TenantId = tenantOf(s.ctx)
+	var roles []*models.Role
+	var err error
+	if len(roleIds) == 0 {
+		roles, err = defaultRoles(s.roleRepo, user.TenantId)
+	} else {
+		roles, err = s.findRoles(user.TenantId, roleIds)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.checkRoleChange(0, nil, roles); err != nil {
+		return err
+	}
+	if err := s.checkDepartment(user.TenantId, user.DepartmentId); err != nil {
+		return err
+	}
+	user.Roles = roles
+	if err := s.policyService.SetPassword(user, password); err != nil {
+		return err
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return err
+	}
+	syncCasbinUser(user.Id, user.TenantId, roles)
+	return s.verifyService.SendVerification(user)
 }
 
-// Update user
-func (s *UserService) UpdateUser(user *models.User) error {
+// Update user, roles are replaced unless roleIds is nil
+func (s *UserService) UpdateUser(user *models.User, roleIds []uint64) error {
 	existingUser, err := s.userRepo.FindById(user.Id)
 	if err != nil {
 		return err
@@ -75,18 +200,40 @@ func (s *UserService) UpdateUser(user *models.User) error {
 		return errors.New("user does not exist")
 	}
 	if user.Username != existingUser.Username {
-		conflictUser, _ := s.userRepo.FindByUsername(user.Username)
+		conflictUser, _ := s.accountRepo.FindByUsername(user.Username)
 		if conflictUser != nil && conflictUser.Id != user.Id {
 			return errors.New("username already exist")
 		}
 	}
-	if user.Email != existingUser.Email {
-		conflictUser, _ := s.userRepo.FindByEmail(user.Email)
-		if conflictUser != nil && conflictUser.Id != user.Id {
-			return errors.New("email already exist")
+	//a new email waits for verification, the current one stays in use
+	var roles []*models.Role
+	if roleIds != nil {
+		if roles, err = s.findRoles(existingUser.TenantId, roleIds); err != nil {
+			return err
+		}
+		if err := s.checkRoleChange(existingUser.Id, existingUser.Roles, roles); err != nil {
+			return err
+		}
+	}
+	if err := s.checkDepartment(existingUser.TenantId, user.DepartmentId); err != nil {
+		return err
+	}
+	newEmail := user.Email
+	user.Email = existingUser.Email
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	if roles != nil {
+		if err := s.userRepo.ReplaceRoles(user, roles); err != nil {
+			return err
 		}
+		syncCasbinUser(user.Id, existingUser.TenantId, roles)
+	}
+	s.principalService.Invalidate(user.Id)
+	if newEmail != existingUser.Email {
+		return s.verifyService.RequestEmailChange(user, newEmail)
 	}
-	return s.userRepo.Update(user)
+	return nil
 }
 
 // Delete user
@@ -98,17 +245,53 @@ func (s *UserService) DeleteUser(userId uint64) error {
 	if existingUser == nil {
 		return errors.New("user does not exist")
 	}
-	return s.userRepo.Delete(userId)
+	if err := s.userRepo.Delete(userId); err != nil {
+		return err
+	}
+	syncCasbinUser(userId, existingUser.TenantId, nil)
+	s.principalService.Invalidate(userId)
+	return s.tokenService.RevokeUserTokens(userId)
 }
 
-// check user permission
-func (s *UserService) HasPermission(userId uint64, permission string) (bool, error) {
+// Update user status, banning a user invalidates all of the user's tokens
+func (s *UserService) UpdateUserStatus(userId uint64, status int) error {
 	user, err := s.userRepo.FindById(userId)
 	if err != nil {
-		return false, err
+		return err
 	}
 	if user == nil {
+		return errors.New("user does not exist")
+	}
+	switch status {
+	case models.StatusActive, models.StatusInactive, models.StatusBanned:
+	default:
+		return errors.New("invalid user status")
+	}
+	user.Status = status
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	s.principalService.Invalidate(userId)
+	if status != models.StatusActive {
+		return s.tokenService.RevokeUserTokens(userId)
+	}
+	return nil
+}
+
+// Unlock a user locked out by failed logins
+func (s *UserService) UnlockUser(userId uint64) error {
+	user, err := s.userRepo.FindById(userId)
+	if err != nil {
+		return err
+	}
+	return s.loginGuard.Unlock(user.Username)
+}
+
+// check user permission on the cached principal
+func (s *UserService) HasPermission(userId uint64, permission string) (bool, error) {
+	principal, err := s.principalService.Load(userId)
+	if err != nil {
 		return false, errors.New("user does not exist")
 	}
-	return user.HasPermission(permission), nil
+	return s.principalService.HasPermission(principal, permission)
 }
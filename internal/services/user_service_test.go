@@ -0,0 +1,272 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"bpf.com/internal/models"
+	"bpf.com/pkg/tenant"
+)
+
+func TestUpdateUserRoles(t *testing.T) {
+	f := setup(t)
+	root := f.user(t, tenant.Default, "root", models.RoleSuperuser)
+	admin := f.user(t, tenant.Default, "admin", models.RoleAdmin)
+	tests := []struct {
+		name    string
+		caller  *models.User
+		target  func() *models.User
+		roles   []string
+		wantErr bool
+	}{
+		{"admin assigns a role", admin,
+			func() *models.User { return f.user(t, tenant.Default, "alice", models.RoleUser) },
+			[]string{models.RoleGuest}, false},
+		{"admin assigns superuser", admin,
+			func() *models.User { return f.user(t, tenant.Default, "bob", models.RoleUser) },
+			[]string{models.RoleSuperuser}, true},
+		{"admin removes superuser", admin,
+			func() *models.User { return f.user(t, tenant.Default, "carol", models.RoleSuperuser) },
+			[]string{models.RoleUser}, true},
+		{"admin makes itself superuser", admin,
+			func() *models.User { return admin },
+			[]string{models.RoleAdmin, models.RoleSuperuser}, true},
+		{"admin changes its own roles", admin,
+			func() *models.User { return admin },
+			[]string{models.RoleUser}, true},
+		{"platform admin assigns superuser", root,
+			func() *models.User { return f.user(t, tenant.Default, "dave", models.RoleUser) },
+			[]string{models.RoleSuperuser}, false},
+		{"platform admin removes superuser", root,
+			func() *models.User { return f.user(t, tenant.Default, "erin", models.RoleSuperuser) },
+			[]string{models.RoleUser}, false},
+		{"platform admin changes its own roles", root,
+			func() *models.User { return root },
+			[]string{models.RoleAdmin, models.RoleSuperuser}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target()
+			before := roleCodes(f.reload(t, target.Id))
+			var roleIds []uint64
+			for _, code := range tt.roles {
+				roleIds = append(roleIds, f.roles[tenant.Default][code].Id)
+			}
+			update := f.reload(t, target.Id)
+			err := NewUserService().WithContext(f.as(t, tt.caller)).UpdateUser(update, roleIds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			after := roleCodes(f.reload(t, target.Id))
+			if tt.wantErr && len(after) != len(before) {
+				t.Errorf("roles changed from %v to %v", before, after)
+			}
+			if !tt.wantErr && (len(after) != len(tt.roles) || !after[tt.roles[0]]) {
+				t.Errorf("roles = %v, want %v", after, tt.roles)
+			}
+		})
+	}
+}
+
+func TestCreateUserWithSuperuser(t *testing.T) {
+	f := setup(t)
+	root := f.user(t, tenant.Default, "root", models.RoleSuperuser)
+	admin := f.user(t, tenant.Default, "admin", models.RoleAdmin)
+	superuser := []uint64{f.roles[tenant.Default][models.RoleSuperuser].Id}
+
+	user := &models.User{Username: "mallory", Email: "mallory@example.org"}
+	if err := NewUserService().WithContext(f.as(t, admin)).CreateUser(user, testPassword, superuser); err == nil {
+		t.Error("an admin created a superuser")
+	}
+	user = &models.User{Username: "trent", Email: "trent@example.org"}
+	if err := NewUserService().WithContext(f.as(t, root)).CreateUser(user, testPassword, superuser); err != nil {
+		t.Errorf("platform admin CreateUser() error = %v", err)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	f := setup(t)
+	root := f.user(t, tenant.Default, "root", models.RoleSuperuser)
+	alice := f.user(t, tenant.Default, "alice", models.RoleUser)
+	otherAdmin := f.user(t, otherTenant, "other-admin", models.RoleAdmin)
+	bob := f.user(t, otherTenant, "bob", models.RoleUser)
+	users := NewUserService().WithContext(f.as(t, otherAdmin))
+
+	if _, err := users.GetUserById(alice.Id); err == nil {
+		t.Error("GetUserById() found a user of another organization")
+	}
+	list, total, err := users.ListUsers(1, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(list) != 2 {
+		t.Errorf("ListUsers() = %d users, want the 2 of the organization", total)
+	}
+	for _, user := range list {
+		if user.TenantId != otherTenant {
+			t.Errorf("ListUsers() returned %s of organization %d", user.Username, user.TenantId)
+		}
+	}
+	update := f.reload(t, alice.Id)
+	update.Nickname = "changed"
+	if err := users.UpdateUser(update, nil); err == nil {
+		t.Error("UpdateUser() changed a user of another organization")
+	}
+	if err := users.DeleteUser(alice.Id); err == nil {
+		t.Error("DeleteUser() deleted a user of another organization")
+	}
+	if err := users.UpdateUser(f.reload(t, bob.Id), []uint64{f.roles[tenant.Default][models.RoleAdmin].Id}); err == nil {
+		t.Error("UpdateUser() assigned a role of another organization")
+	}
+
+	created := &models.User{Username: "carol", Email: "carol@example.org"}
+	if err := users.CreateUser(created, testPassword, nil); err != nil {
+		t.Fatal(err)
+	}
+	if created.TenantId != otherTenant || !roleCodes(f.reload(t, created.Id))[models.RoleUser] {
+		t.Errorf("CreateUser() = tenant %d roles %v, want the default roles of organization %d",
+			created.TenantId, created.RoleCodes(), otherTenant)
+	}
+	if f.reload(t, created.Id).Roles[0].TenantId != otherTenant {
+		t.Error("CreateUser() gave the default role of another organization")
+	}
+
+	roles, err := NewRoleService().WithContext(f.as(t, otherAdmin)).ListRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range roles {
+		if role.TenantId != otherTenant {
+			t.Errorf("ListRoles() returned %s of organization %d", role.Code, role.TenantId)
+		}
+	}
+
+	//platform admins work across organizations
+	if _, err := NewUserService().WithContext(f.as(t, root)).GetUserById(bob.Id); err != nil {
+		t.Errorf("platform admin GetUserById() error = %v", err)
+	}
+}
+
+func TestCreateUserDefaultRoles(t *testing.T) {
+	f := setup(t)
+	admin := f.user(t, otherTenant, "other-admin", models.RoleAdmin)
+	users := NewUserService().WithContext(f.as(t, admin))
+
+	created := &models.User{Username: "carol", Email: "carol@example.org"}
+	if err := users.CreateUser(created, testPassword, nil); err != nil {
+		t.Fatal(err)
+	}
+	roles := f.reload(t, created.Id).Roles
+	if len(roles) != 1 || roles[0].Id != f.roles[otherTenant][models.RoleUser].Id {
+		t.Errorf("CreateUser() roles = %v, want the default role of the organization", f.reload(t, created.Id).RoleCodes())
+	}
+	guest := &models.User{Username: "dave", Email: "dave@example.org"}
+	if err := users.CreateUser(guest, testPassword, []uint64{f.roles[otherTenant][models.RoleGuest].Id}); err != nil {
+		t.Fatal(err)
+	}
+	if codes := roleCodes(f.reload(t, guest.Id)); len(codes) != 1 || !codes[models.RoleGuest] {
+		t.Errorf("CreateUser() roles = %v, want the given role only", codes)
+	}
+}
+
+// a department of the default organization, below the parent when given
+func (f *fixture) department(t *testing.T, name string, parent *models.Department) *models.Department {
+	t.Helper()
+	dept := &models.Department{TenantId: tenant.Default, Name: name}
+	if parent != nil {
+		dept.ParentId = &parent.Id
+	}
+	if err := f.db.Create(dept).Error; err != nil {
+		t.Fatal(err)
+	}
+	parentPath := ""
+	if parent != nil {
+		parentPath = parent.Path
+	}
+	dept.Path = models.DepartmentPath(parentPath, dept.Id)
+	if err := f.db.Save(dept).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dept
+}
+
+func (f *fixture) assign(t *testing.T, user *models.User, dept *models.Department) {
+	t.Helper()
+	if err := f.db.Model(user).Update("department_id", dept.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	user.DepartmentId = &dept.Id
+}
+
+func TestDepartmentDataScope(t *testing.T) {
+	f := setup(t)
+	engineering := f.department(t, "engineering", nil)
+	backend := f.department(t, "backend", engineering)
+	sales := f.department(t, "sales", nil)
+	f.role(t, "manager", nil, models.PermAll)
+	f.roles[tenant.Default]["manager"].DataScope = models.DataScopeDept
+	f.role(t, "auditor", nil, models.PermAll)
+	f.roles[tenant.Default]["auditor"].DataScope = models.DataScopeCustom
+	f.roles[tenant.Default]["auditor"].DataScopeDepts = models.DepartmentIds{sales.Id}
+	for _, code := range []string{"manager", "auditor"} {
+		if err := f.db.Save(f.roles[tenant.Default][code]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := f.user(t, tenant.Default, "manager", "manager")
+	f.assign(t, manager, engineering)
+	engineer := f.user(t, tenant.Default, "engineer", models.RoleUser)
+	f.assign(t, engineer, engineering)
+	developer := f.user(t, tenant.Default, "developer", models.RoleUser)
+	f.assign(t, developer, backend)
+	seller := f.user(t, tenant.Default, "seller", models.RoleUser)
+	f.assign(t, seller, sales)
+	auditor := f.user(t, tenant.Default, "auditor", "auditor")
+	f.user(t, tenant.Default, "nobody", models.RoleUser)
+
+	tests := []struct {
+		name    string
+		user    *models.User
+		visible []string
+	}{
+		{"own department", manager, []string{"manager", "engineer"}},
+		{"custom departments and own row", auditor, []string{"seller", "auditor"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, total, err := NewUserService().WithContext(f.as(t, tt.user)).ListUsers(1, 10, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, user := range list {
+				got = append(got, user.Username)
+			}
+			if total != int64(len(tt.visible)) || strings.Join(got, ",") != strings.Join(tt.visible, ",") {
+				t.Errorf("ListUsers() = %v (total %d), want %v", got, total, tt.visible)
+			}
+		})
+	}
+
+	users := NewUserService().WithContext(f.as(t, manager))
+	if _, err := users.GetUserById(seller.Id); err == nil {
+		t.Error("GetUserById() found a user outside the data scope")
+	}
+	if err := users.DeleteUser(developer.Id); err == nil {
+		t.Error("DeleteUser() deleted a user of a department below the own one")
+	}
+	outside := &models.User{Username: "carol", Email: "carol@example.org", DepartmentId: &sales.Id}
+	if err := users.CreateUser(outside, testPassword, nil); err == nil {
+		t.Error("CreateUser() put a user into a department outside the data scope")
+	}
+	inside := &models.User{Username: "dave", Email: "dave@example.org", DepartmentId: &engineering.Id}
+	if err := users.CreateUser(inside, testPassword, nil); err != nil {
+		t.Errorf("CreateUser() in the own department error = %v", err)
+	}
+	move := f.reload(t, engineer.Id)
+	move.DepartmentId = &sales.Id
+	if err := users.UpdateUser(move, nil); err == nil {
+		t.Error("UpdateUser() moved a user out of the data scope")
+	}
+}
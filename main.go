@@ -16,6 +16,10 @@ func main() {
 		log.Fatalf("Init logger fail: %v", err)
 	}
 
+	if err := core.InitJWT(); err != nil {
+		log.Fatalf("Init jwt keys fail: %v", err)
+	}
+
 	if err := core.InitDatabase(); err != nil {
 		log.Fatalf("Init database fail: %v", err)
 	}
@@ -24,9 +28,29 @@ func main() {
 		log.Fatalf("Init cache fail: %v", err)
 	}
 
+	if err := core.InitCasbin(); err != nil {
+		log.Fatalf("Init casbin fail: %v", err)
+	}
+
+	if err := core.InitMailer(); err != nil {
+		log.Fatalf("Init mailer fail: %v", err)
+	}
+
+	if err := core.InitOidc(); err != nil {
+		log.Fatalf("Init oidc providers fail: %v", err)
+	}
+
+	if err := core.InitPolicies(); err != nil {
+		log.Fatalf("Init policies fail: %v", err)
+	}
+
 	router := core.InitGin()
 	api.SetupRoutes(router)
 
+	if err := core.InitPermissions(); err != nil {
+		log.Fatalf("Check permissions fail: %v", err)
+	}
+
 	app := core.NewApplication(router)
 	app.Run()
 }
@@ -177,6 +177,40 @@ func (r *RedisCache) Expire(ctx context.Context, key string, expiration time.Dur
 	return nil
 }
 
+// Incr 计数器自增，首次创建时设置过期时间
+func (r *RedisCache) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	prefixedKey := r.prefixKey(key)
+
+	// 自增并在首次创建时设置过期时间
+	count, err := r.client.Incr(ctx, prefixedKey).Result()
+	r.logOperation("INCR", key, err)
+	if err != nil {
+		return 0, fmt.Errorf("计数器自增失败: %w", err)
+	}
+	if count == 1 && expiration > 0 {
+		if err := r.client.Expire(ctx, prefixedKey, expiration).Err(); err != nil {
+			return 0, fmt.Errorf("设置计数器过期时间失败: %w", err)
+		}
+	}
+
+	return count, nil
+}
+
+// TTL 获取剩余过期时间，键不存在时返回负值
+func (r *RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	prefixedKey := r.prefixKey(key)
+
+	// 获取剩余过期时间
+	ttl, err := r.client.TTL(ctx, prefixedKey).Result()
+	r.logOperation("TTL", key, err)
+
+	if err != nil {
+		return 0, fmt.Errorf("获取缓存过期时间失败: %w", err)
+	}
+
+	return ttl, nil
+}
+
 // FlushDB 清空当前数据库
 func (r *RedisCache) FlushDB(ctx context.Context) error {
 	// 清空数据库
@@ -190,6 +224,53 @@ func (r *RedisCache) FlushDB(ctx context.Context) error {
 	return nil
 }
 
+// Publish 发布消息到频道
+func (r *RedisCache) Publish(ctx context.Context, channel string, message string) error {
+	prefixedChannel := r.prefixKey(channel)
+
+	// 发布消息
+	err := r.client.Publish(ctx, prefixedChannel, message).Err()
+	r.logOperation("PUBLISH", channel, err)
+
+	if err != nil {
+		return fmt.Errorf("发布消息失败: %w", err)
+	}
+
+	return nil
+}
+
+// Subscribe 订阅频道，消息在后台协程中交给handler，ctx取消后退订
+func (r *RedisCache) Subscribe(ctx context.Context, channel string, handler func(message string)) error {
+	prefixedChannel := r.prefixKey(channel)
+
+	// 订阅并等待确认
+	pubsub := r.client.Subscribe(ctx, prefixedChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		r.logOperation("SUBSCRIBE", channel, err)
+		pubsub.Close()
+		return fmt.Errorf("订阅频道失败: %w", err)
+	}
+	r.logOperation("SUBSCRIBE", channel, nil)
+
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				handler(msg.Payload)
+			}
+		}
+	}()
+
+	return nil
+}
+
 // Close cache
 func (r *RedisCache) Close() error {
 	if r.client != nil {
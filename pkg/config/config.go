@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -17,6 +19,15 @@ type AppConfig struct {
 	JWT      JWTConfig
 	Log      LogConfig
 	Cache    CacheConfig
+	Mfa      MfaConfig
+	Mail     MailConfig
+	Auth     AuthConfig
+	Oidc     OidcConfig
+	OAuth    OAuthConfig
+	Ldap     LdapConfig
+	Password PasswordConfig
+	Policy   PolicyConfig
+	Casbin   CasbinConfig
 }
 
 // server config
@@ -28,6 +39,7 @@ type ServerConfig struct {
 	WriteTimeout     time.Duration `mapstructure:"writeTimeout"`
 	DisableDebug     bool          `mapstructure:"disableDebug"`
 	EnableRequestLog bool          `mapstructure:"enableRequestLog"`
+	PublicUrl        string        `mapstructure:"publicUrl"`
 }
 
 // db config
@@ -50,11 +62,156 @@ type DatabaseConfig struct {
 
 // jwt config
 type JWTConfig struct {
-	Secret           string        `mapstructure:"secret"`
-	AccessTokenExp   time.Duration `mapstructure:"accessTokenExp"`
-	RefreshTokenExp  time.Duration `mapstructure:"refreshTokenExp"`
-	TokenIssuer      string        `mapstructure:"tokenIssuer"`
-	RefreshTokenSize int           `mapstructure:"refreshTokenSize"`
+	Secret           string         `mapstructure:"secret"`
+	AccessTokenExp   time.Duration  `mapstructure:"accessTokenExp"`
+	RefreshTokenExp  time.Duration  `mapstructure:"refreshTokenExp"`
+	TokenIssuer      string         `mapstructure:"tokenIssuer"`
+	RefreshTokenSize int            `mapstructure:"refreshTokenSize"`
+	ImpersonationExp time.Duration  `mapstructure:"impersonationExp"`
+	Keys             []JWTKeyConfig `mapstructure:"keys"`
+}
+
+// jwt signing key config, the newest key whose activeFrom has passed signs
+// new tokens, every key that is not retired verifies tokens by kid
+type JWTKeyConfig struct {
+	Kid            string `mapstructure:"kid"`
+	Algorithm      string `mapstructure:"algorithm"`
+	PrivateKeyFile string `mapstructure:"privateKeyFile"`
+	Secret         string `mapstructure:"secret"`
+	ActiveFrom     string `mapstructure:"activeFrom"`
+	RetireAt       string `mapstructure:"retireAt"`
+}
+
+// mfa config
+type MfaConfig struct {
+	Issuer            string        `mapstructure:"issuer"`
+	PendingTokenExp   time.Duration `mapstructure:"pendingTokenExp"`
+	MaxAttempts       int           `mapstructure:"maxAttempts"`
+	RecoveryCodeCount int           `mapstructure:"recoveryCodeCount"`
+	RequiredRoles     []string      `mapstructure:"requiredRoles"`
+}
+
+// mail config
+type MailConfig struct {
+	Driver   string `mapstructure:"driver"`
+	From     string `mapstructure:"from"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	TLS      string `mapstructure:"tls"`
+	LogDir   string `mapstructure:"logDir"`
+}
+
+// auth flow config
+type AuthConfig struct {
+	PasswordResetExp      time.Duration `mapstructure:"passwordResetExp"`
+	LinkSecret            string        `mapstructure:"linkSecret"`
+	EmailVerificationExp  time.Duration `mapstructure:"emailVerificationExp"`
+	UnverifiedPolicy      string        `mapstructure:"unverifiedPolicy"`
+	UnverifiedPermissions []string      `mapstructure:"unverifiedPermissions"`
+	MaxLoginFailures      int           `mapstructure:"maxLoginFailures"`
+	MaxIpLoginFailures    int           `mapstructure:"maxIpLoginFailures"`
+	LoginFailureWindow    time.Duration `mapstructure:"loginFailureWindow"`
+	LockoutDuration       time.Duration `mapstructure:"lockoutDuration"`
+	LoginDelayBase        time.Duration `mapstructure:"loginDelayBase"`
+	LoginDelayMax         time.Duration `mapstructure:"loginDelayMax"`
+	Authenticators        []string      `mapstructure:"authenticators"`
+	MagicLinkExp          time.Duration `mapstructure:"magicLinkExp"`
+	PrincipalCacheExp     time.Duration `mapstructure:"principalCacheExp"`
+}
+
+// external identity provider config
+type OidcConfig struct {
+	StateExp  time.Duration        `mapstructure:"stateExp"`
+	Providers []OidcProviderConfig `mapstructure:"providers"`
+}
+
+// oidc providers are discovered from the issuer, oauth2 providers
+// without id tokens read the identity from userInfoUrl
+type OidcProviderConfig struct {
+	Name               string   `mapstructure:"name"`
+	Type               string   `mapstructure:"type"`
+	Issuer             string   `mapstructure:"issuer"`
+	ClientId           string   `mapstructure:"clientId"`
+	ClientSecret       string   `mapstructure:"clientSecret"`
+	Scopes             []string `mapstructure:"scopes"`
+	RedirectUrl        string   `mapstructure:"redirectUrl"`
+	AuthUrl            string   `mapstructure:"authUrl"`
+	TokenUrl           string   `mapstructure:"tokenUrl"`
+	UserInfoUrl        string   `mapstructure:"userInfoUrl"`
+	SubjectField       string   `mapstructure:"subjectField"`
+	EmailField         string   `mapstructure:"emailField"`
+	EmailVerifiedField string   `mapstructure:"emailVerifiedField"`
+	UsernameField      string   `mapstructure:"usernameField"`
+	TrustEmail         bool     `mapstructure:"trustEmail"`
+	AutoRegister       bool     `mapstructure:"autoRegister"`
+}
+
+// oauth2 authorization server config, tokens use the jwt lifetimes
+type OAuthConfig struct {
+	CodeExp time.Duration `mapstructure:"codeExp"`
+}
+
+// ldap directory config, users are found with the service account and
+// authenticated by binding as their own entry
+type LdapConfig struct {
+	Url                string            `mapstructure:"url"`
+	StartTLS           bool              `mapstructure:"startTls"`
+	InsecureSkipVerify bool              `mapstructure:"insecureSkipVerify"`
+	Timeout            time.Duration     `mapstructure:"timeout"`
+	BindDn             string            `mapstructure:"bindDn"`
+	BindPassword       string            `mapstructure:"bindPassword"`
+	BaseDn             string            `mapstructure:"baseDn"`
+	UserFilter         string            `mapstructure:"userFilter"`
+	UsernameAttribute  string            `mapstructure:"usernameAttribute"`
+	EmailAttribute     string            `mapstructure:"emailAttribute"`
+	NameAttribute      string            `mapstructure:"nameAttribute"`
+	GroupAttribute     string            `mapstructure:"groupAttribute"`
+	GroupBaseDn        string            `mapstructure:"groupBaseDn"`
+	GroupFilter        string            `mapstructure:"groupFilter"`
+	GroupRoles         []LdapGroupConfig `mapstructure:"groupRoles"`
+	DefaultRole        string            `mapstructure:"defaultRole"`
+}
+
+// role code given to members of a group, the group is a dn or a cn
+type LdapGroupConfig struct {
+	Group string `mapstructure:"group"`
+	Role  string `mapstructure:"role"`
+}
+
+// password hashing and policy config, hashes with other parameters are upgraded on the next login
+type PasswordConfig struct {
+	Algorithm         string `mapstructure:"algorithm"`
+	BcryptCost        int    `mapstructure:"bcryptCost"`
+	Argon2Memory      uint32 `mapstructure:"argon2Memory"`
+	Argon2Iterations  uint32 `mapstructure:"argon2Iterations"`
+	Argon2Parallelism uint8  `mapstructure:"argon2Parallelism"`
+	MinLength         int    `mapstructure:"minLength"`
+	MaxLength         int    `mapstructure:"maxLength"`
+	RequireUpper      bool   `mapstructure:"requireUpper"`
+	RequireLower      bool   `mapstructure:"requireLower"`
+	RequireDigit      bool   `mapstructure:"requireDigit"`
+	RequireSymbol     bool   `mapstructure:"requireSymbol"`
+	DisallowUsername  bool   `mapstructure:"disallowUsername"`
+	HistorySize       int    `mapstructure:"historySize"`
+	MaxAge            int    `mapstructure:"maxAge"`
+	ChangeTokenExp    int    `mapstructure:"changeTokenExp"`
+	BreachedDir       string `mapstructure:"breachedDir"`
+}
+
+// attribute based policy config, rules live in their own yaml file
+type PolicyConfig struct {
+	File string `mapstructure:"file"`
+}
+
+// casbin authorization backend, when enabled the permission and role middleware
+// ask the enforcer instead of the role table
+type CasbinConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	ModelFile string `mapstructure:"modelFile"`
+	Domain    string `mapstructure:"domain"`
+	Channel   string `mapstructure:"channel"`
 }
 
 // cache config
@@ -89,6 +246,8 @@ type LogConfig struct {
 	EnableConsole bool   `mapstructure:"enableConsole"`
 }
 
+const minLinkSecretLength = 32
+
 // Init all config
 func InitConfig(configPath string) error {
 	viper.SetConfigFile(configPath)
@@ -102,6 +261,13 @@ func InitConfig(configPath string) error {
 	if err := viper.Unmarshal(&globalConfig); err != nil {
 		return fmt.Errorf("parse the config fail: %w", err)
 	}
+	//anyone knowing the link secret can forge verification links
+	if len(globalConfig.Auth.LinkSecret) < minLinkSecretLength {
+		return fmt.Errorf("auth.linkSecret must be at least %d characters", minLinkSecretLength)
+	}
+	if strings.Contains(strings.ToLower(globalConfig.Auth.LinkSecret), "change-me") {
+		return errors.New("auth.linkSecret still holds the example value")
+	}
 	log.Println("config file process successfully!")
 	return nil
 }
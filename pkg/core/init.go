@@ -10,10 +10,16 @@ import (
 	"syscall"
 	"time"
 
+	"bpf.com/internal/services"
 	"bpf.com/pkg/cache"
 	"bpf.com/pkg/config"
 	"bpf.com/pkg/database"
 	"bpf.com/pkg/logger"
+	"bpf.com/pkg/mailer"
+	"bpf.com/pkg/oidc"
+	"bpf.com/pkg/permission"
+	"bpf.com/pkg/policy"
+	"bpf.com/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -38,6 +44,45 @@ func InitDatabase() error {
 	return database.InitDatabase()
 }
 
+// Init jwt key ring
+func InitJWT() error {
+	return utils.InitKeyRing()
+}
+
+// Init Mailer
+func InitMailer() error {
+	return mailer.InitMailer()
+}
+
+// Init external identity providers
+func InitOidc() error {
+	return oidc.InitOidc()
+}
+
+// Init attribute based policies
+func InitPolicies() error {
+	return policy.Load(config.GetAppConfig().Policy.File)
+}
+
+// check routes, roles, policies and config only use declared permissions, call after the routes are set up
+func InitPermissions() error {
+	if err := permission.ValidateReferences(); err != nil {
+		return err
+	}
+	if err := permission.Validate(policy.Permissions()...); err != nil {
+		return fmt.Errorf("policies reference an %w", err)
+	}
+	if err := permission.Validate(config.GetAppConfig().Auth.UnverifiedPermissions...); err != nil {
+		return fmt.Errorf("auth.unverifiedPermissions has an %w", err)
+	}
+	return services.NewRoleService().CheckPermissions()
+}
+
+// Init casbin enforcer, needs the database and the cache
+func InitCasbin() error {
+	return services.InitCasbin()
+}
+
 // Init Cache
 func InitCache() error {
 	return cache.InitRedisCache()
@@ -2,25 +2,109 @@
 package database
 
 import (
+	"time"
+
 	"bpf.com/internal/models"
 	"bpf.com/pkg/logger"
+	"bpf.com/pkg/tenant"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 func RunMigrations() error {
 	logger.GetLogger().Info("开始执行数据库迁移...")
+	//邮箱验证上线前创建的用户视为已验证
+	backfillEmailVerified := DB.Migrator().HasTable(&models.User{}) &&
+		!DB.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+	//多角色上线前的单个 role_id 迁入用户角色关联表
+	moveUserRoles := DB.Migrator().HasColumn(&models.User{}, "role_id")
 	if err := DB.AutoMigrate(
+		&models.Organization{},
+		&models.Department{},
 		&models.User{},
 		&models.Role{},
+		&models.RefreshToken{},
+		&models.MfaRecoveryCode{},
+		&models.PasswordReset{},
+		&models.PersonalAccessToken{},
+		&models.Session{},
+		&models.UserIdentity{},
+		&models.OAuthClient{},
+		&models.OAuthConsent{},
+		&models.PasswordHistory{},
+		&models.ImpersonationLog{},
+		&models.MagicLink{},
+		&models.CasbinRule{},
 	); err != nil {
 		logger.GetLogger().Error("数据库迁移失败", zap.Error(err))
 		return err
 	}
+	if moveUserRoles {
+		if err := migrateUserRoles(); err != nil {
+			logger.GetLogger().Error("迁移用户角色失败", zap.Error(err))
+			return err
+		}
+	}
+	if err := migrateOrganizations(); err != nil {
+		logger.GetLogger().Error("迁移组织失败", zap.Error(err))
+		return err
+	}
+	if backfillEmailVerified {
+		if err := DB.Model(&models.User{}).
+			Where("email_verified_at IS NULL").
+			Update("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			logger.GetLogger().Error("回填邮箱验证时间失败", zap.Error(err))
+			return err
+		}
+	}
 
 	logger.GetLogger().Info("数据库迁移完成")
 	return nil
 }
 
+// copy role_id into t_sys_user_roles, then drop the column and its foreign key
+func migrateUserRoles() error {
+	err := DB.Exec("INSERT IGNORE INTO t_sys_user_roles (user_id, role_id) " +
+		"SELECT u.id, u.role_id FROM t_sys_users u JOIN t_sys_roles r ON r.id = u.role_id").Error
+	if err != nil {
+		return err
+	}
+	if DB.Migrator().HasConstraint(&models.User{}, "fk_t_sys_users_role") {
+		if err := DB.Exec("ALTER TABLE t_sys_users DROP FOREIGN KEY fk_t_sys_users_role").Error; err != nil {
+			return err
+		}
+	}
+	return DB.Migrator().DropColumn(&models.User{}, "role_id")
+}
+
+// existing users and roles default to tenant_id 1, make sure that organization exists.
+// Role names and codes used to be unique on their own, now they are within the organization
+func migrateOrganizations() error {
+	var count int64
+	if err := DB.Model(&models.Organization{}).Where("id = ?", tenant.Default).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		org := &models.Organization{
+			Name:        "默认组织",
+			Code:        "default",
+			Description: "多租户上线前的用户和角色所属组织",
+		}
+		org.Id = tenant.Default
+		if err := DB.Create(org).Error; err != nil {
+			return err
+		}
+	}
+	for _, index := range []string{"idx_t_sys_roles_name", "idx_t_sys_roles_code"} {
+		if DB.Migrator().HasIndex(&models.Role{}, index) {
+			if err := DB.Migrator().DropIndex(&models.Role{}, index); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func InitAdminUser() error {
 	if err := initRoles(); err != nil {
 		return err
@@ -92,19 +176,29 @@ func initRoles() error {
 func initAdmin() error {
 	logger.GetLogger().Info("检查并初始化管理员账户...")
 	var count int64
-	if err := DB.Model(&models.User{}).Where("role_id = ?", 1).Count(&count).Error; err != nil {
+	var superuserRole models.Role
+	if err := DB.Where("code = ?", models.RoleSuperuser).First(&superuserRole).Error; err != nil {
+		logger.GetLogger().Error("查询超级管理员角色失败", zap.Error(err))
+		return err
+	}
+	if err := DB.Model(&models.User{}).
+		Joins("JOIN t_sys_user_roles ur ON ur.user_id = t_sys_users.id").
+		Where("ur.role_id = ?", superuserRole.Id).
+		Count(&count).Error; err != nil {
 		logger.GetLogger().Error("查询管理员账户失败", zap.Error(err))
 		return err
 	}
 
 	if count == 0 {
 		logger.GetLogger().Info("创建默认管理员账户...")
+		now := time.Now()
 		admin := &models.User{
-			Username: "admin",
-			Email:    "admin@example.com",
-			Nickname: "系统管理员",
-			RoleId:   1, // 管理员角色ID为1
-			Status:   models.StatusActive,
+			Username:        "admin",
+			Email:           "admin@example.com",
+			Nickname:        "系统管理员",
+			Roles:           []*models.Role{&superuserRole},
+			Status:          models.StatusActive,
+			EmailVerifiedAt: &now,
 		}
 		if err := admin.SetPassword("123456"); err != nil {
 			logger.GetLogger().Error("设置管理员密码失败", zap.Error(err))
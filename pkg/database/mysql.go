@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"bpf.com/pkg/config"
+	"bpf.com/pkg/datascope"
 	"bpf.com/pkg/logger"
+	"bpf.com/pkg/tenant"
 	"go.uber.org/zap"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -64,6 +66,14 @@ func InitDatabase() error {
 	if err != nil {
 		return fmt.Errorf("connector db fail: %w", err)
 	}
+	// scoped statements only see the rows of their tenant
+	if err := tenant.Register(DB); err != nil {
+		return fmt.Errorf("register tenant callbacks fail: %w", err)
+	}
+	// and restricted ones the rows of their data scope
+	if err := datascope.Register(DB); err != nil {
+		return fmt.Errorf("register data scope callbacks fail: %w", err)
+	}
 
 	sqlDB, err := DB.DB()
 	if err != nil {
@@ -0,0 +1,135 @@
+package datascope
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// column of the models whose rows belong to a department
+const field = "DepartmentId"
+
+const departmentTable = "t_sys_departments"
+
+const filteredKey = "datascope:filtered"
+
+// rows a user may see of the models having a department, built from the data scopes of its roles.
+// The zero value is unrestricted
+type Scope struct {
+	Restricted bool   `json:"restricted,omitempty"`
+	UserId     uint64 `json:"user_id,omitempty"`
+	//rows of exactly these departments
+	Departments []uint64 `json:"departments,omitempty"`
+	//rows of these departments and every department below them
+	Subtrees []uint64 `json:"subtrees,omitempty"`
+}
+
+// the department with its tree path, as /1/4/9/, is one of the departments or
+// below one of the subtrees. Own rows only do not cover any department
+func (s Scope) CoversDepartment(id uint64, path string) bool {
+	if !s.Restricted {
+		return true
+	}
+	for _, deptId := range s.Departments {
+		if deptId == id {
+			return true
+		}
+	}
+	for _, rootId := range s.Subtrees {
+		if strings.Contains(path, "/"+strconv.FormatUint(rootId, 10)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// models naming the column that holds the user owning a row, users always see their own rows
+type Owned interface {
+	OwnerColumn() string
+}
+
+type ctxKey struct{}
+
+// restrict the context to the scope, unrestricted scopes leave it as is
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	if !scope.Restricted {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKey{}, scope)
+}
+
+// restricted scope of the context
+func FromContext(ctx context.Context) (Scope, bool) {
+	if ctx == nil {
+		return Scope{}, false
+	}
+	scope, ok := ctx.Value(ctxKey{}).(Scope)
+	return scope, ok && scope.Restricted
+}
+
+// register the callbacks filtering the models having a department column.
+// Statements run with a restricted context (db.WithContext) only reach the rows of the scope
+func Register(db *gorm.DB) error {
+	callback := db.Callback()
+	if err := callback.Query().Before("gorm:query").Register("datascope:query", filter); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("datascope:update", filter); err != nil {
+		return err
+	}
+	return callback.Delete().Before("gorm:delete").Register("datascope:delete", filter)
+}
+
+// add the scope condition once per statement: own rows, rows of the departments
+// and rows of the department subtrees, any of them
+func filter(db *gorm.DB) {
+	if db.Statement.Schema == nil {
+		return
+	}
+	column := db.Statement.Schema.LookUpField(field)
+	if column == nil {
+		return
+	}
+	scope, ok := FromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+	if _, done := db.Statement.Settings.LoadOrStore(filteredKey, true); done {
+		return
+	}
+	table := db.Statement.Table
+	department := clause.Column{Table: table, Name: column.DBName}
+	var conditions []clause.Expression
+	if owned, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(Owned); ok && scope.UserId != 0 {
+		conditions = append(conditions, clause.Eq{Column: clause.Column{Table: table, Name: owned.OwnerColumn()}, Value: scope.UserId})
+	}
+	if len(scope.Departments) > 0 {
+		values := make([]interface{}, 0, len(scope.Departments))
+		for _, id := range scope.Departments {
+			values = append(values, id)
+		}
+		conditions = append(conditions, clause.IN{Column: department, Values: values})
+	}
+	if len(scope.Subtrees) > 0 {
+		conditions = append(conditions, clause.Expr{
+			SQL: "? IN (SELECT d.id FROM " + departmentTable + " d JOIN " + departmentTable +
+				" p ON d.path LIKE CONCAT(p.path, '%') WHERE p.id IN ? AND d.deleted_at IS NULL AND p.deleted_at IS NULL)",
+			Vars: []interface{}{department, scope.Subtrees},
+		})
+	}
+	if len(conditions) == 0 {
+		//nothing is in scope
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "1 = 0"}}})
+		return
+	}
+	//a single condition stays bare, gorm would join a one element OR to the other conditions with OR
+	condition := conditions[0]
+	if len(conditions) > 1 {
+		condition = clause.Or(conditions...)
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{condition}})
+}
@@ -0,0 +1,166 @@
+package datascope
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type account struct {
+	Id           uint64
+	Name         string
+	DepartmentId *uint64
+	CreatedBy    uint64
+}
+
+func (account) TableName() string {
+	return "accounts"
+}
+
+func (account) OwnerColumn() string {
+	return "created_by"
+}
+
+type unowned struct {
+	Id           uint64
+	DepartmentId *uint64
+}
+
+func (unowned) TableName() string {
+	return "unowned"
+}
+
+type setting struct {
+	Id  uint64
+	Key string
+}
+
+func (setting) TableName() string {
+	return "settings"
+}
+
+// statements are only rendered, the database is never reached
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:1)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFilter(t *testing.T) {
+	db := dryRunDB(t)
+	tests := []struct {
+		name  string
+		scope Scope
+		model interface{}
+		want  []string
+		not   []string
+	}{
+		{"unrestricted", Scope{}, &account{},
+			nil, []string{"WHERE"}},
+		{"nothing in scope", Scope{Restricted: true}, &unowned{},
+			[]string{"WHERE 1 = 0"}, nil},
+		{"own rows", Scope{Restricted: true, UserId: 7}, &account{},
+			[]string{"`accounts`.`created_by` = 7"}, []string{"1 = 0"}},
+		{"own rows need an owner column", Scope{Restricted: true, UserId: 7}, &unowned{},
+			[]string{"WHERE 1 = 0"}, []string{"created_by"}},
+		{"departments", Scope{Restricted: true, Departments: []uint64{3, 4}}, &account{},
+			[]string{"`accounts`.`department_id` IN (3,4)"}, []string{"created_by"}},
+		{"subtrees skip deleted departments", Scope{Restricted: true, Subtrees: []uint64{2}}, &account{},
+			[]string{"`accounts`.`department_id` IN (SELECT d.id FROM t_sys_departments d JOIN t_sys_departments p ON d.path LIKE CONCAT(p.path, '%') WHERE p.id IN (2) AND d.deleted_at IS NULL AND p.deleted_at IS NULL)"}, nil},
+		{"any of them", Scope{Restricted: true, UserId: 7, Departments: []uint64{3}, Subtrees: []uint64{2}}, &account{},
+			[]string{"(`accounts`.`created_by` = 7 OR `accounts`.`department_id` = 3 OR (`accounts`.`department_id` IN (SELECT"}, nil},
+		{"models without department", Scope{Restricted: true, UserId: 7}, &setting{},
+			nil, []string{"WHERE"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithScope(context.Background(), tt.scope)
+			sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				return tx.WithContext(ctx).Find(tt.model)
+			})
+			for _, want := range tt.want {
+				if !strings.Contains(sql, want) {
+					t.Errorf("query %q does not contain %q", sql, want)
+				}
+			}
+			for _, not := range tt.not {
+				if strings.Contains(sql, not) {
+					t.Errorf("query %q contains %q", sql, not)
+				}
+			}
+		})
+	}
+}
+
+// the scope narrows the conditions of the statement, it never widens them
+func TestFilterIsAnded(t *testing.T) {
+	db := dryRunDB(t)
+	tests := []struct {
+		name  string
+		scope Scope
+		want  string
+	}{
+		{"single condition", Scope{Restricted: true, Departments: []uint64{3}},
+			"WHERE name = 'a' AND `accounts`.`department_id` = 3"},
+		{"several conditions", Scope{Restricted: true, UserId: 7, Departments: []uint64{3}},
+			"WHERE name = 'a' AND (`accounts`.`created_by` = 7 OR `accounts`.`department_id` = 3)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithScope(context.Background(), tt.scope)
+			for _, sql := range []string{
+				db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+					return tx.WithContext(ctx).Where("name = ?", "a").Find(&account{})
+				}),
+				db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+					return tx.WithContext(ctx).Model(&account{}).Where("name = ?", "a").Update("name", "b")
+				}),
+				db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+					return tx.WithContext(ctx).Where("name = ?", "a").Delete(&account{})
+				}),
+			} {
+				if !strings.HasSuffix(sql, tt.want) {
+					t.Errorf("statement %q should end with %q", sql, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCoversDepartment(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope Scope
+		id    uint64
+		path  string
+		want  bool
+	}{
+		{"unrestricted", Scope{}, 9, "/1/4/9/", true},
+		{"listed department", Scope{Restricted: true, Departments: []uint64{9}}, 9, "/1/4/9/", true},
+		{"listed parent only", Scope{Restricted: true, Departments: []uint64{4}}, 9, "/1/4/9/", false},
+		{"subtree root", Scope{Restricted: true, Subtrees: []uint64{4}}, 4, "/1/4/", true},
+		{"below subtree", Scope{Restricted: true, Subtrees: []uint64{4}}, 9, "/1/4/9/", true},
+		{"id prefix is not an ancestor", Scope{Restricted: true, Subtrees: []uint64{4}}, 41, "/1/41/", false},
+		{"above subtree", Scope{Restricted: true, Subtrees: []uint64{4}}, 1, "/1/", false},
+		{"own rows only", Scope{Restricted: true, UserId: 7}, 9, "/1/4/9/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.CoversDepartment(tt.id, tt.path); got != tt.want {
+				t.Errorf("CoversDepartment(%d, %q) = %v, want %v", tt.id, tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"bpf.com/pkg/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// hash algorithms
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// argon2id defaults, the OWASP recommended minimum is m=19456,t=2,p=1
+const (
+	defaultArgon2Memory      = 64 * 1024
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+// hash algorithm with its cost parameters
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) bool
+	NeedsRehash(encoded string) bool
+}
+
+// argon2id hasher, hashes are PHC strings: $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+type Argon2Hasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// bcrypt hasher, hashes keep the modular crypt format: $2a$10$...
+type BcryptHasher struct {
+	Cost int
+}
+
+// hasher of PasswordConfig.Algorithm, argon2id by default
+func Current() Hasher {
+	cfg := config.GetAppConfig().Password
+	if cfg.Algorithm == Bcrypt {
+		cost := cfg.BcryptCost
+		if cost == 0 {
+			cost = bcrypt.DefaultCost
+		}
+		return &BcryptHasher{Cost: cost}
+	}
+	hasher := &Argon2Hasher{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+	}
+	if hasher.Memory == 0 {
+		hasher.Memory = defaultArgon2Memory
+	}
+	if hasher.Iterations == 0 {
+		hasher.Iterations = defaultArgon2Iterations
+	}
+	if hasher.Parallelism == 0 {
+		hasher.Parallelism = defaultArgon2Parallelism
+	}
+	return hasher
+}
+
+// hash a password with the current hasher
+func Hash(password string) (string, error) {
+	return Current().Hash(password)
+}
+
+// check a password against a hash of any supported algorithm
+func Verify(password, encoded string) bool {
+	switch {
+	case strings.HasPrefix(encoded, "$"+Argon2id+"$"):
+		return (&Argon2Hasher{}).Verify(password, encoded)
+	case isBcrypt(encoded):
+		return (&BcryptHasher{}).Verify(password, encoded)
+	default:
+		return false
+	}
+}
+
+// the hash uses another algorithm or other parameters than the current hasher
+func NeedsRehash(encoded string) bool {
+	return Current().NeedsRehash(encoded)
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *Argon2Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version,
+		h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// parameters come from the hash, not from the hasher
+func (h *Argon2Hasher) Verify(password, encoded string) bool {
+	params, salt, key, err := decodeArgon2(encoded)
+	if err != nil {
+		return false
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+func (h *Argon2Hasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2(encoded)
+	if err != nil {
+		return true
+	}
+	return *params != *h
+}
+
+// split a PHC argon2id string into its parameters, salt and key
+func decodeArgon2(encoded string) (*Argon2Hasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return nil, nil, nil, errors.New("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, errors.New("unsupported argon2 version")
+	}
+	params := &Argon2Hasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, errors.New("invalid argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, errors.New("invalid argon2id salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, errors.New("invalid argon2id key")
+	}
+	return params, salt, key, nil
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	if !isBcrypt(encoded) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
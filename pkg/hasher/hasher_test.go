@@ -0,0 +1,128 @@
+package hasher
+
+import (
+	"strings"
+	"testing"
+
+	"bpf.com/pkg/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// password config for one test, restored afterwards
+func useConfig(t *testing.T, password config.PasswordConfig) {
+	t.Helper()
+	cfg := config.GetAppConfig()
+	saved := cfg.Password
+	cfg.Password = password
+	t.Cleanup(func() { cfg.Password = saved })
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher Hasher
+		prefix string
+	}{
+		{"argon2id", &Argon2Hasher{Memory: 1024, Iterations: 1, Parallelism: 1}, "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{"bcrypt", &BcryptHasher{Cost: bcrypt.MinCost}, "$2a$04$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(encoded, tt.prefix) {
+				t.Errorf("Hash() = %q, want prefix %q", encoded, tt.prefix)
+			}
+			if !tt.hasher.Verify("correct horse", encoded) || !Verify("correct horse", encoded) {
+				t.Error("Verify() rejected the password")
+			}
+			if tt.hasher.Verify("wrong horse", encoded) || Verify("wrong horse", encoded) {
+				t.Error("Verify() accepted a wrong password")
+			}
+			if tt.hasher.NeedsRehash(encoded) {
+				t.Error("NeedsRehash() = true for a hash of the same hasher")
+			}
+			again, err := tt.hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again == encoded {
+				t.Error("Hash() is not salted")
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsInvalidHashes(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"plain",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$",
+		"$2a$04$short",
+	} {
+		if Verify("password", encoded) {
+			t.Errorf("Verify() accepted %q", encoded)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weakArgon, err := (&Argon2Hasher{Memory: 1024, Iterations: 1, Parallelism: 1}).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strongArgon, err := (&Argon2Hasher{Memory: 2048, Iterations: 2, Parallelism: 1}).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakBcrypt, err := (&BcryptHasher{Cost: bcrypt.MinCost}).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonConfig := config.PasswordConfig{Argon2Memory: 2048, Argon2Iterations: 2, Argon2Parallelism: 1}
+	bcryptConfig := config.PasswordConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1}
+	tests := []struct {
+		name    string
+		config  config.PasswordConfig
+		encoded string
+		want    bool
+	}{
+		{"argon2id current", argonConfig, strongArgon, false},
+		{"argon2id weaker parameters", argonConfig, weakArgon, true},
+		{"bcrypt to argon2id", argonConfig, weakBcrypt, true},
+		{"argon2id to bcrypt", bcryptConfig, strongArgon, true},
+		{"bcrypt lower cost", bcryptConfig, weakBcrypt, true},
+		{"unknown format", argonConfig, "plain", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, tt.config)
+			if got := NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	useConfig(t, config.PasswordConfig{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+	legacy, err := Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useConfig(t, config.PasswordConfig{Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1})
+	if !Verify("password", legacy) || !NeedsRehash(legacy) {
+		t.Fatal("a bcrypt hash has to verify and ask for a rehash under argon2id")
+	}
+	upgraded, err := Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(upgraded, "$argon2id$") || !Verify("password", upgraded) || NeedsRehash(upgraded) {
+		t.Errorf("upgraded hash %q does not verify as the current argon2id", upgraded)
+	}
+}
@@ -0,0 +1,193 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"bpf.com/pkg/config"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// wrong password, or no single entry matches the username
+var ErrInvalidCredentials = errors.New("invalid ldap credentials")
+
+// directory entry of an authenticated user
+type Entry struct {
+	DN       string
+	Username string
+	Email    string
+	Name     string
+	Groups   []string
+}
+
+// authenticate a user by binding as the entry found for the username
+func Authenticate(username, password string) (*Entry, error) {
+	cfg := config.GetAppConfig().Ldap
+	//an empty password would be an unauthenticated bind that always succeeds
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := serviceBind(conn, cfg); err != nil {
+		return nil, err
+	}
+	entry, err := findUser(conn, cfg, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap bind fail: %w", err)
+	}
+	if cfg.GroupFilter != "" {
+		//group search runs as the service account again
+		if err := serviceBind(conn, cfg); err != nil {
+			return nil, err
+		}
+		groups, err := searchGroups(conn, cfg, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		entry.Groups = append(entry.Groups, groups...)
+	}
+	return entry, nil
+}
+
+// connect to the directory
+func dial(cfg config.LdapConfig) (*goldap.Conn, error) {
+	timeout := cfg.Timeout * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	conn, err := goldap.DialURL(cfg.Url,
+		goldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		goldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap connect fail: %w", err)
+	}
+	conn.SetTimeout(timeout)
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls fail: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// bind as the service account, anonymous when no bind dn is configured
+func serviceBind(conn *goldap.Conn, cfg config.LdapConfig) error {
+	var err error
+	if cfg.BindDn == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(cfg.BindDn, cfg.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("ldap service bind fail: %w", err)
+	}
+	return nil
+}
+
+// find the single entry of a username
+func findUser(conn *goldap.Conn, cfg config.LdapConfig, username string) (*Entry, error) {
+	filter := cfg.UserFilter
+	if filter == "" {
+		filter = "(uid=%s)"
+	}
+	usernameAttr := attributeOr(cfg.UsernameAttribute, "uid")
+	emailAttr := attributeOr(cfg.EmailAttribute, "mail")
+	nameAttr := attributeOr(cfg.NameAttribute, "cn")
+	attributes := []string{usernameAttr, emailAttr, nameAttr}
+	if cfg.GroupAttribute != "" {
+		attributes = append(attributes, cfg.GroupAttribute)
+	}
+	result, err := conn.Search(goldap.NewSearchRequest(
+		cfg.BaseDn, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(filter, goldap.EscapeFilter(username)),
+		attributes, nil,
+	))
+	if err != nil {
+		//several matches, or servers answering no match with no such object
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) ||
+			goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap search fail: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	found := result.Entries[0]
+	entry := &Entry{
+		DN:       found.DN,
+		Username: found.GetAttributeValue(usernameAttr),
+		Email:    found.GetAttributeValue(emailAttr),
+		Name:     found.GetAttributeValue(nameAttr),
+	}
+	if cfg.GroupAttribute != "" {
+		entry.Groups = found.GetAttributeValues(cfg.GroupAttribute)
+	}
+	if entry.Username == "" {
+		entry.Username = username
+	}
+	return entry, nil
+}
+
+// dns of the groups listing the user as a member
+func searchGroups(conn *goldap.Conn, cfg config.LdapConfig, userDn string) ([]string, error) {
+	baseDn := cfg.GroupBaseDn
+	if baseDn == "" {
+		baseDn = cfg.BaseDn
+	}
+	result, err := conn.Search(goldap.NewSearchRequest(
+		baseDn, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(cfg.GroupFilter, goldap.EscapeFilter(userDn)),
+		[]string{"dn"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search fail: %w", err)
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
+
+// configured attribute name or the default
+func attributeOr(attribute, def string) string {
+	if attribute != "" {
+		return attribute
+	}
+	return def
+}
+
+// check whether a group dn matches a configured group, given as a dn or a cn
+func GroupMatches(groupDn, group string) bool {
+	if strings.EqualFold(groupDn, group) {
+		return true
+	}
+	dn, err := goldap.ParseDN(groupDn)
+	if err != nil || len(dn.RDNs) == 0 {
+		return false
+	}
+	for _, attr := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") && strings.EqualFold(attr.Value, group) {
+			return true
+		}
+	}
+	return false
+}
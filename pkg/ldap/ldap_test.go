@@ -0,0 +1,301 @@
+package ldap
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"bpf.com/pkg/config"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// a directory entry of the stub, password is empty for entries that can not bind
+type stubEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// minimal ldap server answering simple binds and equality or wildcard searches
+type stubDirectory struct {
+	entries  []stubEntry
+	listener net.Listener
+	mu       sync.Mutex
+	filters  []string
+}
+
+func newStubDirectory(t *testing.T, entries ...stubEntry) *stubDirectory {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &stubDirectory{entries: entries, listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+func (d *stubDirectory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+// search filters received, in order
+func (d *stubDirectory) searches() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.filters...)
+}
+
+func (d *stubDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageId := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		var responses []*ber.Packet
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			responses = append(responses, result(goldap.ApplicationBindResponse, d.bind(op)))
+		case goldap.ApplicationSearchRequest:
+			responses = d.search(op)
+		case goldap.ApplicationUnbindRequest:
+			return
+		default:
+			responses = append(responses, result(goldap.ApplicationExtendedResponse, goldap.LDAPResultUnwillingToPerform))
+		}
+		for _, response := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageId, ""))
+			envelope.AppendChild(response)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func result(tag ber.Tag, code uint16) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return packet
+}
+
+func (d *stubDirectory) bind(op *ber.Packet) uint16 {
+	dn := op.Children[1].Value.(string)
+	password := op.Children[2].Data.String()
+	if dn == "" && password == "" {
+		return goldap.LDAPResultSuccess
+	}
+	for _, entry := range d.entries {
+		if strings.EqualFold(entry.dn, dn) && entry.password != "" && entry.password == password {
+			return goldap.LDAPResultSuccess
+		}
+	}
+	return goldap.LDAPResultInvalidCredentials
+}
+
+func (d *stubDirectory) search(op *ber.Packet) []*ber.Packet {
+	baseDn := strings.ToLower(op.Children[0].Value.(string))
+	filter, err := goldap.DecompileFilter(op.Children[6])
+	if err != nil {
+		return []*ber.Packet{result(goldap.ApplicationSearchResultDone, goldap.LDAPResultProtocolError)}
+	}
+	d.mu.Lock()
+	d.filters = append(d.filters, filter)
+	d.mu.Unlock()
+	attribute, value, _ := strings.Cut(strings.Trim(filter, "()"), "=")
+	var responses []*ber.Packet
+	for _, entry := range d.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.dn), baseDn) || !matchesAny(entry.attributes[attribute], value) {
+			continue
+		}
+		found := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "")
+		found.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, ""))
+		attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		for name, values := range entry.attributes {
+			attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+			for _, v := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+			}
+			attr.AppendChild(set)
+			attributes.AppendChild(attr)
+		}
+		found.AppendChild(attributes)
+		responses = append(responses, found)
+	}
+	return append(responses, result(goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess))
+}
+
+// equality, or a wildcard pattern when the filter was not escaped
+func matchesAny(values []string, pattern string) bool {
+	for _, value := range values {
+		if !strings.Contains(pattern, "*") {
+			if strings.EqualFold(value, pattern) {
+				return true
+			}
+			continue
+		}
+		rest := strings.ToLower(value)
+		parts := strings.Split(strings.ToLower(pattern), "*")
+		if !strings.HasPrefix(rest, parts[0]) {
+			continue
+		}
+		rest = rest[len(parts[0]):]
+		matched := true
+		for _, part := range parts[1:] {
+			index := strings.Index(rest, part)
+			if index < 0 {
+				matched = false
+				break
+			}
+			rest = rest[index+len(part):]
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	serviceDn = "cn=service,dc=example,dc=org"
+	aliceDn   = "uid=alice,ou=people,dc=example,dc=org"
+	adminsDn  = "cn=admins,ou=groups,dc=example,dc=org"
+	staffDn   = "cn=staff,ou=groups,dc=example,dc=org"
+)
+
+func testDirectory(t *testing.T) *stubDirectory {
+	return newStubDirectory(t,
+		stubEntry{dn: serviceDn, password: "service-secret"},
+		stubEntry{dn: aliceDn, password: "alice-secret", attributes: map[string][]string{
+			"uid":      {"alice"},
+			"mail":     {"alice@example.org"},
+			"cn":       {"Alice Liddell"},
+			"memberOf": {staffDn},
+		}},
+		stubEntry{dn: "uid=twin,ou=people,dc=example,dc=org", password: "twin-secret", attributes: map[string][]string{
+			"uid": {"twin"},
+		}},
+		stubEntry{dn: "uid=twin,ou=contractors,dc=example,dc=org", password: "twin-secret", attributes: map[string][]string{
+			"uid": {"twin"},
+		}},
+		stubEntry{dn: adminsDn, attributes: map[string][]string{
+			"member": {aliceDn},
+		}},
+	)
+}
+
+// ldap config for one test, restored afterwards
+func useLdapConfig(t *testing.T, ldap config.LdapConfig) {
+	t.Helper()
+	cfg := config.GetAppConfig()
+	saved := cfg.Ldap
+	cfg.Ldap = ldap
+	t.Cleanup(func() { cfg.Ldap = saved })
+}
+
+func TestAuthenticate(t *testing.T) {
+	directory := testDirectory(t)
+	useLdapConfig(t, config.LdapConfig{
+		Url:            directory.url(),
+		BindDn:         serviceDn,
+		BindPassword:   "service-secret",
+		BaseDn:         "dc=example,dc=org",
+		GroupAttribute: "memberOf",
+		GroupBaseDn:    "ou=groups,dc=example,dc=org",
+		GroupFilter:    "(member=%s)",
+	})
+
+	entry, err := Authenticate("alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.DN != aliceDn || entry.Username != "alice" || entry.Email != "alice@example.org" || entry.Name != "Alice Liddell" {
+		t.Errorf("Authenticate() = %+v", entry)
+	}
+	if strings.Join(entry.Groups, ";") != staffDn+";"+adminsDn {
+		t.Errorf("groups = %v, want the memberOf group then the searched one", entry.Groups)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{"wrong password", "alice", "wrong"},
+		{"unknown user", "bob", "alice-secret"},
+		{"empty password", "alice", ""},
+		{"empty username", "", "alice-secret"},
+		{"ambiguous username", "twin", "twin-secret"},
+		{"wildcard username", "al*", "alice-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Authenticate(tt.username, tt.password); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Authenticate(%q) error = %v, want ErrInvalidCredentials", tt.username, err)
+			}
+		})
+	}
+	for _, filter := range directory.searches() {
+		if strings.Contains(filter, "al*") {
+			t.Errorf("username reached the directory unescaped: %s", filter)
+		}
+	}
+}
+
+func TestAuthenticateServiceBindFails(t *testing.T) {
+	directory := testDirectory(t)
+	useLdapConfig(t, config.LdapConfig{
+		Url:          directory.url(),
+		BindDn:       serviceDn,
+		BindPassword: "wrong",
+		BaseDn:       "dc=example,dc=org",
+	})
+	_, err := Authenticate("alice", "alice-secret")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() error = %v, want a service bind failure", err)
+	}
+}
+
+func TestGroupMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		groupDn string
+		group   string
+		want    bool
+	}{
+		{"same dn", adminsDn, adminsDn, true},
+		{"dn in other case", adminsDn, strings.ToUpper(adminsDn), true},
+		{"cn", adminsDn, "admins", true},
+		{"cn in other case", adminsDn, "Admins", true},
+		{"other cn", adminsDn, "staff", false},
+		{"cn of a parent", "cn=team,cn=admins,dc=example,dc=org", "admins", false},
+		{"not a dn", "admins", "staff", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GroupMatches(tt.groupDn, tt.group); got != tt.want {
+				t.Errorf("GroupMatches(%q, %q) = %v, want %v", tt.groupDn, tt.group, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bpf.com/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// LogMailer writes mail to the log and optionally to .eml files, for development
+type LogMailer struct {
+	dir string
+}
+
+// create LogMailer, an empty dir only logs
+func NewLogMailer(dir string) (*LogMailer, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &LogMailer{dir: dir}, nil
+}
+
+// send message
+func (m *LogMailer) Send(msg *Message) error {
+	logger.GetLogger().Info("mail",
+		zap.Strings("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("text", msg.Text))
+	if m.dir == "" {
+		return nil
+	}
+	data, err := buildMIME("go-bpf <dev@localhost>", msg)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), sanitize(strings.Join(msg.To, "_")))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0644)
+}
+
+// keep file names portable
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
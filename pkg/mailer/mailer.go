@@ -0,0 +1,105 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/logger"
+	"go.uber.org/zap"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// mail message
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends mail messages
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// global mailer
+var globalMailer Mailer
+
+// Init mailer from MailConfig.Driver
+func InitMailer() error {
+	cfg := config.GetAppConfig().Mail
+	switch cfg.Driver {
+	case "smtp":
+		globalMailer = NewSMTPMailer(cfg)
+	case "log", "":
+		mailer, err := NewLogMailer(cfg.LogDir)
+		if err != nil {
+			return err
+		}
+		globalMailer = mailer
+	default:
+		return fmt.Errorf("unsupported mail driver: %s", cfg.Driver)
+	}
+	logger.GetLogger().Info("mailer init successfully", zap.String("driver", cfg.Driver))
+	return nil
+}
+
+// get mailer
+func GetMailer() Mailer {
+	return globalMailer
+}
+
+// render templates/<name>.txt.tmpl and templates/<name>.html.tmpl into a message
+func Render(name, subject string, data interface{}) (*Message, error) {
+	textTpl, err := texttemplate.ParseFS(templateFS, "templates/"+name+".txt.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	htmlTpl, err := htmltemplate.ParseFS(templateFS, "templates/"+name+".html.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	var text, html bytes.Buffer
+	if err := textTpl.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if err := htmlTpl.Execute(&html, data); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// render a template and send it to one recipient
+func SendTemplate(to, name, subject string, data interface{}) error {
+	if globalMailer == nil {
+		return errors.New("mailer not initialized")
+	}
+	msg, err := Render(name, subject, data)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{to}
+	return globalMailer.Send(msg)
+}
+
+// send in the background so response time does not depend on the mail server
+func SendTemplateAsync(to, name, subject string, data interface{}) {
+	go func() {
+		if err := SendTemplate(to, name, subject, data); err != nil {
+			logger.GetLogger().Error("send mail fail",
+				zap.String("template", name),
+				zap.Error(err))
+		}
+	}()
+}
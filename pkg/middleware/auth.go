@@ -1,16 +1,26 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
+	"bpf.com/internal/models"
 	"bpf.com/internal/services"
+	"bpf.com/pkg/logger"
+	perm "bpf.com/pkg/permission"
 	"bpf.com/pkg/utils"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-// Auth middleware
+// how the request was authenticated, stored as ctx "authType"
+const (
+	AuthTypeJwt         = "jwt"
+	AuthTypeAccessToken = "access_token"
+	AuthTypeOAuth       = "oauth"
+)
+
+// Auth middleware, accepts JWT access tokens and personal access tokens
 func JwtAuth() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authHeader := ctx.GetHeader("Authorization")
@@ -34,6 +44,10 @@ func JwtAuth() gin.HandlerFunc {
 			return
 		}
 		token := parts[1]
+		if models.IsPersonalAccessToken(token) {
+			accessTokenAuth(ctx, token)
+			return
+		}
 		claims, err := utils.ParseAccessToken(token)
 		if err != nil {
 			ctx.JSON(http.StatusUnauthorized, gin.H{
@@ -43,47 +57,234 @@ func JwtAuth() gin.HandlerFunc {
 			ctx.Abort()
 			return
 		}
+		// check denylist
+		revoked, err := services.NewTokenService().IsAccessTokenRevoked(claims)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "check token fail: " + err.Error(),
+			})
+			ctx.Abort()
+			return
+		}
+		if revoked {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": "token has been revoked",
+			})
+			ctx.Abort()
+			return
+		}
+		if claims.ClientId != "" {
+			oauthTokenAuth(ctx, claims)
+			return
+		}
+		// last seen of the session, failures must not block the request
+		if err := services.NewSessionService().Touch(claims.SessionId, ctx.ClientIP()); err != nil {
+			logger.GetLogger().Error("touch session fail", zap.Error(err))
+		}
 		// set user to ctx
 		ctx.Set("userId", claims.UserId)
 		ctx.Set("username", claims.Username)
+		ctx.Set("roles", claims.Roles)
+		ctx.Set("claims", claims)
+		ctx.Set("authType", AuthTypeJwt)
+		if !scopeRequest(ctx, claims) {
+			return
+		}
+		if claims.Actor != nil {
+			impersonationAuth(ctx, claims)
+			return
+		}
 
 		ctx.Next()
 	}
 }
 
-// Role auth middleware
-func RoleAuth(roleCode string) gin.HandlerFunc {
+// an admin acting as the user, both identities go to the ctx and every request is recorded
+func impersonationAuth(ctx *gin.Context, claims *utils.JWTClaims) {
+	actorId := claims.ActorId()
+	ctx.Set("actorId", actorId)
+	ctx.Set("actorUsername", claims.Actor.Username)
+
+	ctx.Next()
+
+	services.NewImpersonationService().Record(&models.ImpersonationLog{
+		ActorId:   actorId,
+		UserId:    claims.UserId,
+		TokenId:   claims.ID,
+		Action:    models.ImpersonationRequest,
+		Method:    ctx.Request.Method,
+		Path:      ctx.Request.URL.Path,
+		Status:    ctx.Writer.Status(),
+		Ip:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	})
+}
+
+// authenticate a personal access token, its scopes cap every permission check
+func accessTokenAuth(ctx *gin.Context, token string) {
+	record, user, err := services.NewPersonalAccessTokenService().Authenticate(token)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "invalid token: " + err.Error(),
+		})
+		ctx.Abort()
+		return
+	}
+	ctx.Set("userId", user.Id)
+	ctx.Set("username", user.Username)
+	ctx.Set("tokenScopes", record.Scopes)
+	ctx.Set("authType", AuthTypeAccessToken)
+	if !scopeRequest(ctx, nil) {
+		return
+	}
+	ctx.Next()
+}
+
+// authenticate an access token issued to an oauth client, its scopes cap every permission check
+func oauthTokenAuth(ctx *gin.Context, claims *utils.JWTClaims) {
+	if claims.UserId == 0 {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "client credentials tokens can not act as a user",
+		})
+		ctx.Abort()
+		return
+	}
+	ctx.Set("userId", claims.UserId)
+	ctx.Set("claims", claims)
+	ctx.Set("tokenScopes", models.Permissions(strings.Fields(claims.Scope)))
+	ctx.Set("authType", AuthTypeOAuth)
+	if !scopeRequest(ctx, claims) {
+		return
+	}
+	ctx.Next()
+}
+
+// reject personal access tokens and oauth client tokens, for routes that need an interactive login
+func DenyAccessToken() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		userId, exists := ctx.Get("userId")
-		if !exists {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "unauthorization",
+		if ctx.GetString("authType") != AuthTypeJwt {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "only interactive logins can use this route",
 			})
 			ctx.Abort()
 			return
 		}
-		userService := services.NewUserService()
-		user, err := userService.GetUserById(userId.(uint64))
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "get user fail: " + err.Error(),
+		ctx.Next()
+	}
+}
+
+// reject impersonation tokens, for routes that change credentials or grant access
+func DenyImpersonation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, exists := ctx.Get("actorId"); exists {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "not allowed while impersonating a user",
 			})
 			ctx.Abort()
 			return
 		}
+		ctx.Next()
+	}
+}
 
-		if user == nil {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "user not found",
-			})
-			ctx.Abort()
+// personal access tokens and oauth tokens only grant their scopes, role checks need the * scope
+func scopeAllows(ctx *gin.Context, permission string) bool {
+	scopes, exists := ctx.Get("tokenScopes")
+	if !exists {
+		return true
+	}
+	return scopes.(models.Permissions).HasPermission(permission)
+}
+
+// principal of the authenticated user, loaded once per request and kept on the ctx
+// as "principal". The request is answered and aborted when it can not be loaded
+func loadPrincipal(ctx *gin.Context) (*models.Principal, bool) {
+	if principal, exists := ctx.Get("principal"); exists {
+		return principal.(*models.Principal), true
+	}
+	userId, exists := ctx.Get("userId")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "unauthorization",
+		})
+		ctx.Abort()
+		return nil, false
+	}
+	principal, err := services.NewPrincipalService().Load(userId.(uint64))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "user not found",
+		})
+		ctx.Abort()
+		return nil, false
+	}
+	ctx.Set("principal", principal)
+	return principal, true
+}
+
+// role check of the principal, answers 500 and aborts on failure
+func checkRole(ctx *gin.Context, principal *models.Principal, roleCode string) (bool, bool) {
+	hasRole, err := services.NewPrincipalService().HasRole(principal, roleCode)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "check role fail: " + err.Error(),
+		})
+		ctx.Abort()
+		return false, false
+	}
+	return hasRole && scopeAllows(ctx, models.PermAll), true
+}
+
+// permission check of the principal, answers 500 and aborts on failure
+func checkPermission(ctx *gin.Context, principal *models.Principal, permission string) (bool, bool) {
+	hasPermission, err := services.NewPrincipalService().HasPermission(principal, permission)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "check permission fail: " + err.Error(),
+		})
+		ctx.Abort()
+		return false, false
+	}
+	return hasPermission && scopeAllows(ctx, permission), true
+}
+
+// permission check for handlers where only some requests need the permission, such as
+// a body field. The principal is the one loaded by JwtAuth, failures grant nothing
+func HasPermission(ctx *gin.Context, permission string) bool {
+	principal, exists := ctx.Get("principal")
+	if !exists {
+		return false
+	}
+	hasPermission, err := services.NewPrincipalService().HasPermission(principal.(*models.Principal), permission)
+	if err != nil {
+		logger.GetLogger().Error("check permission fail", zap.Error(err))
+		return false
+	}
+	return hasPermission && scopeAllows(ctx, permission)
+}
+
+// Role auth middleware
+func RoleAuth(roleCode string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal, ok := loadPrincipal(ctx)
+		if !ok {
 			return
 		}
-		fmt.Println("User Role:", user.Role.Code, "Required Role:", roleCode)
-		if user.Role == nil || user.Role.Code != roleCode {
+		hasRole, ok := checkRole(ctx, principal, roleCode)
+		if !ok {
+			return
+		}
+		if !hasRole {
 			ctx.JSON(http.StatusForbidden, gin.H{
 				"code":    403,
 				"message": "access control require role: " + roleCode + " 角色",
@@ -97,27 +298,16 @@ func RoleAuth(roleCode string) gin.HandlerFunc {
 
 // Permission Auth middleware
 func PermissionAuth(permission string) gin.HandlerFunc {
+	perm.Reference(permission)
 	return func(ctx *gin.Context) {
-		userId, exists := ctx.Get("userId")
-		if !exists {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "unauthenticated user",
-			})
-			ctx.Abort()
+		principal, ok := loadPrincipal(ctx)
+		if !ok {
 			return
 		}
-		userService := services.NewUserService()
-		hasPermission, err := userService.HasPermission(userId.(uint64), permission)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "permission check fail: " + err.Error(),
-			})
-			ctx.Abort()
+		hasPermission, ok := checkPermission(ctx, principal, permission)
+		if !ok {
 			return
 		}
-
 		if !hasPermission {
 			ctx.JSON(http.StatusForbidden, gin.H{
 				"code":    403,
@@ -132,38 +322,17 @@ func PermissionAuth(permission string) gin.HandlerFunc {
 
 // need role and permission
 func RoleAndPermissionAuth(roleCode string, permission string) gin.HandlerFunc {
+	perm.Reference(permission)
 	return func(ctx *gin.Context) {
-		userId, exists := ctx.Get("userId")
-		if !exists {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "unauthen",
-			})
-			ctx.Abort()
+		principal, ok := loadPrincipal(ctx)
+		if !ok {
 			return
 		}
-
-		userService := services.NewUserService()
-		user, err := userService.GetUserById(userId.(uint64))
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "get user fail: " + err.Error(),
-			})
-			ctx.Abort()
+		hasRole, ok := checkRole(ctx, principal, roleCode)
+		if !ok {
 			return
 		}
-
-		if user == nil {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "user not found",
-			})
-			ctx.Abort()
-			return
-		}
-
-		if user.Role == nil || user.Role.Code != roleCode {
+		if !hasRole {
 			ctx.JSON(http.StatusForbidden, gin.H{
 				"code":    403,
 				"message": "access control require role: " + roleCode,
@@ -171,14 +340,8 @@ func RoleAndPermissionAuth(roleCode string, permission string) gin.HandlerFunc {
 			ctx.Abort()
 			return
 		}
-
-		hasPermission, err := userService.HasPermission(userId.(uint64), permission)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "check permission fail: " + err.Error(),
-			})
-			ctx.Abort()
+		hasPermission, ok := checkPermission(ctx, principal, permission)
+		if !ok {
 			return
 		}
 		if !hasPermission {
@@ -195,47 +358,20 @@ func RoleAndPermissionAuth(roleCode string, permission string) gin.HandlerFunc {
 
 // Role or Permession
 func RoleOrPermissionAuth(roleCode string, permission string) gin.HandlerFunc {
+	perm.Reference(permission)
 	return func(ctx *gin.Context) {
-		userId, exists := ctx.Get("userId")
-		if !exists {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "unauthorization",
-			})
-			ctx.Abort()
+		principal, ok := loadPrincipal(ctx)
+		if !ok {
 			return
 		}
-		userService := services.NewUserService()
-		user, err := userService.GetUserById(userId.(uint64))
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "get user info fail: " + err.Error(),
-			})
-			ctx.Abort()
+		hasRole, ok := checkRole(ctx, principal, roleCode)
+		if !ok {
 			return
 		}
-
-		if user == nil {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "user not found",
-			})
-			ctx.Abort()
+		hasPermission, ok := checkPermission(ctx, principal, permission)
+		if !ok {
 			return
 		}
-
-		hasRole := user.Role != nil && user.Role.Code == roleCode
-		hasPermission, err := userService.HasPermission(userId.(uint64), permission)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "check permission fail: " + err.Error(),
-			})
-			ctx.Abort()
-			return
-		}
-
 		if !hasRole && !hasPermission {
 			ctx.JSON(http.StatusForbidden, gin.H{
 				"code":    403,
@@ -250,24 +386,19 @@ func RoleOrPermissionAuth(roleCode string, permission string) gin.HandlerFunc {
 
 // At least one authorization is required
 func AnyPermissionAuth(permissions ...string) gin.HandlerFunc {
+	perm.Reference(permissions...)
 	return func(ctx *gin.Context) {
-		userId, exists := ctx.Get("userId")
-		if !exists {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "unauthorization",
-			})
-			ctx.Abort()
+		principal, ok := loadPrincipal(ctx)
+		if !ok {
 			return
 		}
-
-		userService := services.NewUserService()
+		principalService := services.NewPrincipalService()
 		for _, permission := range permissions {
-			hasPermission, err := userService.HasPermission(userId.(uint64), permission)
+			hasPermission, err := principalService.HasPermission(principal, permission)
 			if err != nil {
 				continue
 			}
-			if hasPermission {
+			if hasPermission && scopeAllows(ctx, permission) {
 				ctx.Next()
 				return
 			}
@@ -283,30 +414,18 @@ func AnyPermissionAuth(permissions ...string) gin.HandlerFunc {
 }
 
 func AllPermissionsAuth(permissions ...string) gin.HandlerFunc {
+	perm.Reference(permissions...)
 	return func(ctx *gin.Context) {
-		userId, exists := ctx.Get("userId")
-		if !exists {
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": "unauthorization",
-			})
-			ctx.Abort()
+		principal, ok := loadPrincipal(ctx)
+		if !ok {
 			return
 		}
-
-		userService := services.NewUserService()
 		for _, permission := range permissions {
-			hasPermission, err := userService.HasPermission(userId.(uint64), permission)
-			if err != nil {
-				ctx.JSON(http.StatusInternalServerError, gin.H{
-					"code":    500,
-					"message": "check permission fail: " + err.Error(),
-				})
-				ctx.Abort()
+			hasPermission, ok := checkPermission(ctx, principal, permission)
+			if !ok {
 				return
 			}
 			if !hasPermission {
-
 				ctx.JSON(http.StatusForbidden, gin.H{
 					"code":    403,
 					"message": "access control require permission : " + permission,
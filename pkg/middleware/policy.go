@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"bpf.com/internal/services"
+	perm "bpf.com/pkg/permission"
+	"bpf.com/pkg/policy"
+	"github.com/gin-gonic/gin"
+)
+
+// loads the attributes of the resource a route works on, rules refer to them as resource.<key>
+type ResourceLoader func(ctx *gin.Context) (map[string]interface{}, error)
+
+// the user of the :id path param, owned by itself
+func UserResource(ctx *gin.Context) (map[string]interface{}, error) {
+	userId, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	user, err := services.NewUserService().WithContext(ctx.Request.Context()).GetUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"id":       user.Id,
+		"owner_id": user.Id,
+		"status":   user.Status,
+		"roles":    user.RoleCodes(),
+	}, nil
+}
+
+// need the permission on the resource, checked against the policy rules and the
+// role permissions, the :own variant of the permission is enough for the owner.
+// ctx "ownerAccess" is set when only ownership allowed the request
+func ResourceAuth(permission string, loader ResourceLoader) gin.HandlerFunc {
+	perm.Reference(permission)
+	return func(ctx *gin.Context) {
+		principal, ok := loadPrincipal(ctx)
+		if !ok {
+			return
+		}
+		var resource map[string]interface{}
+		if loader != nil {
+			var err error
+			if resource, err = loader(ctx); err != nil {
+				ctx.JSON(http.StatusNotFound, gin.H{
+					"code":    404,
+					"message": "resource not found",
+				})
+				ctx.Abort()
+				return
+			}
+		}
+		env := policy.Env(ctx.ClientIP(), time.Now())
+		access := services.NewPolicyService().Authorize(principal, permission, resource, env)
+		granted := permission
+		if access.Owner {
+			granted = permission + ":own"
+		}
+		if !access.Allowed || !scopeAllows(ctx, granted) {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "access control require permission: " + permission,
+			})
+			ctx.Abort()
+			return
+		}
+		ctx.Set("ownerAccess", access.Owner)
+		ctx.Next()
+	}
+}
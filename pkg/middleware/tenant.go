@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"bpf.com/internal/models"
+	"bpf.com/internal/services"
+	"bpf.com/pkg/datascope"
+	"bpf.com/pkg/tenant"
+	"bpf.com/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// scope the request to the organization and the data scope of the user, the request
+// context carries both and the user itself so the services built WithContext only see their rows. Platform
+// admins work on every organization, or on the one named by the X-Tenant-Id header.
+// ctx "tenantId" is the scoped tenant, 0 for a platform admin working across tenants
+func scopeRequest(ctx *gin.Context, claims *utils.JWTClaims) bool {
+	principal, ok := loadPrincipal(ctx)
+	if !ok {
+		return false
+	}
+	//login tokens name the organization, users moved to another one log in again
+	if claims != nil && claims.ClientId == "" && claims.TenantId != principal.TenantId {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "token does not belong to the organization of the user",
+		})
+		ctx.Abort()
+		return false
+	}
+	ctx.Request = ctx.Request.WithContext(datascope.WithScope(models.WithCaller(ctx.Request.Context(), principal), principal.DataScope))
+	tenantId := principal.TenantId
+	if principal.IsPlatformAdmin() && scopeAllows(ctx, models.PermAll) {
+		header := ctx.GetHeader(tenant.Header)
+		if header == "" {
+			ctx.Set("tenantId", uint64(0))
+			return true
+		}
+		var err error
+		if tenantId, err = tenant.Parse(header); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": err.Error(),
+			})
+			ctx.Abort()
+			return false
+		}
+	}
+	ctx.Set("tenantId", tenantId)
+	ctx.Request = ctx.Request.WithContext(tenant.WithTenant(ctx.Request.Context(), tenantId))
+	return true
+}
+
+// only the platform tier, for routes managing organizations and other shared settings
+func PlatformAdmin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal, ok := loadPrincipal(ctx)
+		if !ok {
+			return
+		}
+		if !principal.IsPlatformAdmin() || !scopeAllows(ctx, models.PermAll) {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "access control require a platform admin",
+			})
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// the user of the :id path param has to belong to the scoped organization,
+// for admin routes whose services look users up without a tenant
+func TenantUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		userId, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "invalid userId",
+			})
+			ctx.Abort()
+			return
+		}
+		if _, err := services.NewUserService().WithContext(ctx.Request.Context()).GetUserById(userId); err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": "user not found",
+			})
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
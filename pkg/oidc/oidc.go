@@ -0,0 +1,295 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"bpf.com/pkg/config"
+	"bpf.com/pkg/logger"
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// provider types
+const (
+	TypeOidc   = "oidc"
+	TypeOAuth2 = "oauth2"
+)
+
+// http client used to talk to providers
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// identity asserted by a provider
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+}
+
+// configured identity provider, oidc discovery runs on first use
+type Provider struct {
+	cfg          config.OidcProviderConfig
+	mu           sync.Mutex
+	oidcProvider *gooidc.Provider
+}
+
+// global providers by name
+var providers = map[string]*Provider{}
+
+// Init providers from OidcConfig.Providers
+func InitOidc() error {
+	loaded := map[string]*Provider{}
+	for _, cfg := range config.GetAppConfig().Oidc.Providers {
+		if cfg.Name == "" || cfg.ClientId == "" {
+			return errors.New("oidc provider requires name and clientId")
+		}
+		if cfg.Type == "" {
+			cfg.Type = TypeOidc
+		}
+		switch cfg.Type {
+		case TypeOidc:
+			if cfg.Issuer == "" {
+				return fmt.Errorf("oidc provider %s requires issuer", cfg.Name)
+			}
+		case TypeOAuth2:
+			if cfg.AuthUrl == "" || cfg.TokenUrl == "" || cfg.UserInfoUrl == "" {
+				return fmt.Errorf("oauth2 provider %s requires authUrl, tokenUrl and userInfoUrl", cfg.Name)
+			}
+		default:
+			return fmt.Errorf("unsupported provider type %s of %s", cfg.Type, cfg.Name)
+		}
+		if _, ok := loaded[cfg.Name]; ok {
+			return fmt.Errorf("duplicate oidc provider %s", cfg.Name)
+		}
+		loaded[cfg.Name] = &Provider{cfg: cfg}
+	}
+	providers = loaded
+	logger.GetLogger().Info("oidc providers init successfully", zap.Int("count", len(loaded)))
+	return nil
+}
+
+// get provider by name
+func GetProvider(name string) (*Provider, bool) {
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// names of the configured providers
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// provider name
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// callback url registered at the provider
+func (p *Provider) RedirectUrl() string {
+	if p.cfg.RedirectUrl != "" {
+		return p.cfg.RedirectUrl
+	}
+	return config.GetAppConfig().Server.PublicUrl + "/api/v1/auth/oidc/" + p.cfg.Name + "/callback"
+}
+
+// context carrying the provider http client
+func clientContext(ctx context.Context) context.Context {
+	return gooidc.ClientContext(ctx, httpClient)
+}
+
+// discover the oidc provider, a failed discovery is retried on the next call
+func (p *Provider) discover() (*gooidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oidcProvider != nil {
+		return p.oidcProvider, nil
+	}
+	//the key set of the provider keeps this context, it must not be canceled
+	provider, err := gooidc.NewProvider(clientContext(context.Background()), p.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover oidc provider %s fail: %w", p.cfg.Name, err)
+	}
+	p.oidcProvider = provider
+	return provider, nil
+}
+
+// oauth2 client config of the provider
+func (p *Provider) oauth2Config() (*oauth2.Config, error) {
+	cfg := &oauth2.Config{
+		ClientID:     p.cfg.ClientId,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.RedirectUrl(),
+		Scopes:       p.cfg.Scopes,
+	}
+	if p.cfg.Type == TypeOAuth2 {
+		cfg.Endpoint = oauth2.Endpoint{AuthURL: p.cfg.AuthUrl, TokenURL: p.cfg.TokenUrl}
+		return cfg, nil
+	}
+	provider, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Endpoint = provider.Endpoint()
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{gooidc.ScopeOpenID, "email", "profile"}
+	}
+	return cfg, nil
+}
+
+// authorization url of the code flow, protected by pkce and for oidc a nonce
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) (string, error) {
+	cfg, err := p.oauth2Config()
+	if err != nil {
+		return "", err
+	}
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}
+	if p.cfg.Type == TypeOidc {
+		opts = append(opts, gooidc.Nonce(nonce))
+	}
+	return cfg.AuthCodeURL(state, opts...), nil
+}
+
+// exchange the authorization code and resolve the identity
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	cfg, err := p.oauth2Config()
+	if err != nil {
+		return nil, err
+	}
+	ctx = clientContext(ctx)
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange authorization code fail: %w", err)
+	}
+	var identity *Identity
+	if p.cfg.Type == TypeOidc {
+		identity, err = p.identityFromIdToken(ctx, token, nonce)
+	} else {
+		identity, err = p.identityFromUserInfo(ctx, cfg, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("provider returned no subject")
+	}
+	identity.Provider = p.cfg.Name
+	//some providers do not mark emails they already verified
+	if p.cfg.TrustEmail && identity.Email != "" {
+		identity.EmailVerified = true
+	}
+	return identity, nil
+}
+
+// validate the id token against the provider jwks
+func (p *Provider) identityFromIdToken(ctx context.Context, token *oauth2.Token, nonce string) (*Identity, error) {
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIdToken == "" {
+		return nil, errors.New("id_token missing in token response")
+	}
+	provider, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := provider.Verifier(&gooidc.Config{ClientID: p.cfg.ClientId}).Verify(ctx, rawIdToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("invalid id_token: nonce mismatch")
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	return &Identity{
+		Subject:       idToken.Subject,
+		Email:         claimString(claims, fieldOr(p.cfg.EmailField, "email")),
+		EmailVerified: claimBool(claims, fieldOr(p.cfg.EmailVerifiedField, "email_verified")),
+		Name:          claimString(claims, "name"),
+		Username:      claimString(claims, fieldOr(p.cfg.UsernameField, "preferred_username")),
+	}, nil
+}
+
+// read the identity from the userinfo endpoint of a plain oauth2 provider
+func (p *Provider) identityFromUserInfo(ctx context.Context, cfg *oauth2.Config, token *oauth2.Token) (*Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.UserInfoUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := cfg.Client(ctx, token).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch userinfo fail: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch userinfo fail: status %d", resp.StatusCode)
+	}
+	var claims map[string]interface{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("decode userinfo fail: %w", err)
+	}
+	identity := &Identity{
+		Subject:  claimString(claims, fieldOr(p.cfg.SubjectField, "sub")),
+		Email:    claimString(claims, fieldOr(p.cfg.EmailField, "email")),
+		Name:     claimString(claims, "name"),
+		Username: claimString(claims, fieldOr(p.cfg.UsernameField, "preferred_username")),
+	}
+	if p.cfg.EmailVerifiedField != "" {
+		identity.EmailVerified = claimBool(claims, p.cfg.EmailVerifiedField)
+	}
+	return identity, nil
+}
+
+// configured claim name or the default
+func fieldOr(field, def string) string {
+	if field != "" {
+		return field
+	}
+	return def
+}
+
+// claim as string, numeric ids are formatted
+func claimString(claims map[string]interface{}, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// claim as bool, some providers send "true"
+func claimBool(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		verified, _ := strconv.ParseBool(value)
+		return verified
+	default:
+		return false
+	}
+}
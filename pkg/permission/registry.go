@@ -0,0 +1,196 @@
+package permission
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// matches every permission
+const All = "*"
+
+// a permission string with what it allows, holding it also grants the implied permissions
+type Permission struct {
+	Code        string   `json:"code"`
+	Description string   `json:"description"`
+	Implies     []string `json:"implies,omitempty"`
+}
+
+// permissions declared by one module
+type Group struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+}
+
+var (
+	mu         sync.RWMutex
+	groups     []*Group
+	known      = map[string]bool{All: true}
+	implies    = map[string][]string{}
+	referenced = map[string]bool{}
+)
+
+// declare the permissions of a module, a code declared twice is a programming error
+func Register(name, description string, permissions ...Permission) {
+	mu.Lock()
+	defer mu.Unlock()
+	var group *Group
+	for _, g := range groups {
+		if g.Name == name {
+			group = g
+			break
+		}
+	}
+	if group == nil {
+		group = &Group{Name: name, Description: description}
+		groups = append(groups, group)
+	}
+	for _, p := range permissions {
+		if known[p.Code] {
+			panic("permission registered twice: " + p.Code)
+		}
+		known[p.Code] = true
+		if len(p.Implies) > 0 {
+			implies[p.Code] = p.Implies
+		}
+		group.Permissions = append(group.Permissions, p)
+	}
+}
+
+// the permission has been declared
+func Exists(code string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return known[code]
+}
+
+// error naming every undeclared permission of the list,
+// a wildcard pattern is known when it matches a declared permission
+func Validate(codes ...string) error {
+	mu.RLock()
+	defer mu.RUnlock()
+	var unknown []string
+	for _, code := range codes {
+		if !known[code] && !matchesKnown(code) {
+			unknown = append(unknown, code)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown permission: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func matchesKnown(pattern string) bool {
+	if !strings.Contains(pattern, "*") {
+		return false
+	}
+	for code := range known {
+		if code != All && Match(pattern, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// check a granted permission against a required one.
+// Segments are separated by ':' and a '*' segment matches any one segment,
+// a trailing '*' also matches every deeper segment: user:* grants user:view
+// and user:profile:edit, content:*:own grants content:edit:own
+func Match(granted, required string) bool {
+	if granted == All || granted == required {
+		return true
+	}
+	if !strings.Contains(granted, "*") {
+		return false
+	}
+	grantedSegments := strings.Split(granted, ":")
+	requiredSegments := strings.Split(required, ":")
+	for i, segment := range grantedSegments {
+		if i >= len(requiredSegments) {
+			return false
+		}
+		last := i == len(grantedSegments)-1
+		if segment == "*" {
+			if last {
+				return true
+			}
+			continue
+		}
+		if segment != requiredSegments[i] {
+			return false
+		}
+	}
+	return len(grantedSegments) == len(requiredSegments)
+}
+
+// every permission implied by a permission, following implications transitively
+func Implied(code string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(implies[code]) == 0 {
+		return nil
+	}
+	var implied []string
+	seen := map[string]bool{code: true}
+	queue := append([]string(nil), implies[code]...)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if seen[next] {
+			continue
+		}
+		seen[next] = true
+		implied = append(implied, next)
+		queue = append(queue, implies[next]...)
+	}
+	return implied
+}
+
+// remember permissions required by a route, checked by ValidateReferences
+func Reference(codes ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, code := range codes {
+		referenced[code] = true
+	}
+}
+
+// check every permission referenced by routes or implied by another has been declared
+func ValidateReferences() error {
+	mu.RLock()
+	codes := make([]string, 0, len(referenced))
+	for code := range referenced {
+		codes = append(codes, code)
+	}
+	impliedBy := make(map[string][]string, len(implies))
+	for code, implied := range implies {
+		impliedBy[code] = implied
+	}
+	mu.RUnlock()
+	sort.Strings(codes)
+	if err := Validate(codes...); err != nil {
+		return fmt.Errorf("routes reference an %w", err)
+	}
+	for code, implied := range impliedBy {
+		if err := Validate(implied...); err != nil {
+			return fmt.Errorf("%s implies an %w", code, err)
+		}
+	}
+	return nil
+}
+
+// the catalog in registration order
+func Groups() []Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	catalog := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		group := *g
+		group.Permissions = append([]Permission(nil), g.Permissions...)
+		catalog = append(catalog, group)
+	}
+	return catalog
+}
@@ -0,0 +1,71 @@
+package permission
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  string
+		required string
+		want     bool
+	}{
+		{"all", "*", "user:update", true},
+		{"all own", "*", "user:update:own", true},
+		{"exact", "user:update", "user:update", true},
+		{"other action", "user:update", "user:delete", false},
+		{"no implicit own", "user:update", "user:update:own", false},
+		{"own does not grant any", "user:update:own", "user:update", false},
+		{"own exact", "user:update:own", "user:update:own", true},
+		{"trailing wildcard", "user:*", "user:update", true},
+		{"trailing wildcard deeper", "user:*", "user:profile:edit", true},
+		{"trailing wildcard own", "user:*", "user:update:own", true},
+		{"trailing wildcard needs a segment", "user:*", "user", false},
+		{"wildcard other module", "user:*", "role:update", false},
+		{"prefix is not a segment", "user:*", "users:update", false},
+		{"plain prefix", "user", "user:update", false},
+		{"partial segment", "user:up", "user:update", false},
+		{"middle wildcard own", "content:*:own", "content:edit:own", true},
+		{"middle wildcard needs own", "content:*:own", "content:edit", false},
+		{"middle wildcard other last", "content:*:own", "content:edit:all", false},
+		{"middle wildcard too deep", "content:*:own", "content:edit:own:x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.granted, tt.required); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImplied(t *testing.T) {
+	Register("implied-test", "implications",
+		Permission{Code: "doc:manage", Implies: []string{"doc:update", "doc:read"}},
+		Permission{Code: "doc:update", Implies: []string{"doc:read", "doc:update:own"}},
+		Permission{Code: "doc:read"},
+		Permission{Code: "doc:update:own"},
+		Permission{Code: "loop:a", Implies: []string{"loop:b"}},
+		Permission{Code: "loop:b", Implies: []string{"loop:a"}},
+	)
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{"transitive", "doc:manage", []string{"doc:update", "doc:read", "doc:update:own"}},
+		{"direct", "doc:update", []string{"doc:read", "doc:update:own"}},
+		{"nothing", "doc:read", nil},
+		{"undeclared", "doc:delete", nil},
+		{"cycle", "loop:a", []string{"loop:b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Implied(tt.code); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Implied(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"bpf.com/pkg/permission"
+	"gopkg.in/yaml.v3"
+)
+
+// rule effects
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// result of evaluating the rules for a permission
+type Decision int
+
+const (
+	//no rule matched, the role permissions decide
+	NotApplicable Decision = iota
+	Allowed
+	Denied
+)
+
+// a rule applies to the permissions it lists, wildcards included, when every
+// condition holds. A deny rule refuses the request even if a role grants the
+// permission, an allow rule grants it without one. Deny rules fail closed, a
+// condition that can not be evaluated, such as one on a missing attribute, holds.
+type Rule struct {
+	Name        string   `yaml:"name"`
+	Effect      string   `yaml:"effect"`
+	Permissions []string `yaml:"permissions"`
+	When        []string `yaml:"when"`
+	conditions  []*condition
+}
+
+// attributes a rule is evaluated against, conditions name them as
+// subject.<key>, resource.<key> and env.<key>
+type Input struct {
+	Subject  map[string]interface{}
+	Resource map[string]interface{}
+	Env      map[string]interface{}
+}
+
+// <attribute> <op> <literal or attribute>
+type condition struct {
+	text  string
+	left  operand
+	op    string
+	right operand
+	nets  []*net.IPNet
+}
+
+// an attribute path, or a literal when path is empty
+type operand struct {
+	path  []string
+	value interface{}
+}
+
+var (
+	mu    sync.RWMutex
+	rules []*Rule
+
+	conditionPattern = regexp.MustCompile(`^\s*(\S+)\s+(\S+)\s+(.+?)\s*$`)
+	pathPattern      = regexp.MustCompile(`^(subject|resource|env)(\.[A-Za-z0-9_]+)+$`)
+	operators        = map[string]bool{
+		"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+		"in": true, "not_in": true, "contains": true, "in_cidr": true, "not_in_cidr": true,
+	}
+
+	//the subject owns the resource, the check behind :own permissions
+	ownership = mustParse("subject.id == resource.owner_id")
+)
+
+// read the policy file, an empty path runs without rules
+func Load(path string) error {
+	var loaded []*Rule
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read policy file fail: %w", err)
+		}
+		var file struct {
+			Rules []*Rule `yaml:"rules"`
+		}
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("parse policy file fail: %w", err)
+		}
+		for i, rule := range file.Rules {
+			if rule.Name == "" {
+				rule.Name = fmt.Sprintf("rule-%d", i+1)
+			}
+			if rule.Effect != Allow && rule.Effect != Deny {
+				return fmt.Errorf("policy %s: effect must be allow or deny", rule.Name)
+			}
+			if len(rule.Permissions) == 0 {
+				return fmt.Errorf("policy %s: no permissions", rule.Name)
+			}
+			for _, text := range rule.When {
+				cond, err := parse(text)
+				if err != nil {
+					return fmt.Errorf("policy %s: %w", rule.Name, err)
+				}
+				rule.conditions = append(rule.conditions, cond)
+			}
+		}
+		loaded = file.Rules
+	}
+	mu.Lock()
+	rules = loaded
+	mu.Unlock()
+	return nil
+}
+
+// permissions named by the rules, checked against the registry at startup
+func Permissions() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var codes []string
+	for _, rule := range rules {
+		codes = append(codes, rule.Permissions...)
+	}
+	return codes
+}
+
+// evaluate the rules for a permission, deny rules win over allow rules.
+// The name of the deciding rule is returned with the decision
+func Evaluate(required string, input Input) (Decision, string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	allowedBy := ""
+	for _, rule := range rules {
+		if !rule.appliesTo(required) || !rule.holds(input) {
+			continue
+		}
+		if rule.Effect == Deny {
+			return Denied, rule.Name
+		}
+		if allowedBy == "" {
+			allowedBy = rule.Name
+		}
+	}
+	if allowedBy != "" {
+		return Allowed, allowedBy
+	}
+	return NotApplicable, ""
+}
+
+// the subject id equals the resource owner_id
+func IsOwner(input Input) bool {
+	return ownership.holds(input, false)
+}
+
+// request environment: the client ip, the local time as 15:04, the hour and the weekday as mon..sun
+func Env(ip string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"ip":      ip,
+		"time":    now.Format("15:04"),
+		"hour":    now.Hour(),
+		"weekday": strings.ToLower(now.Weekday().String()[:3]),
+	}
+}
+
+func (r *Rule) appliesTo(required string) bool {
+	for _, pattern := range r.Permissions {
+		if permission.Match(pattern, required) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) holds(input Input) bool {
+	for _, cond := range r.conditions {
+		if !cond.holds(input, r.Effect == Deny) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParse(text string) *condition {
+	cond, err := parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return cond
+}
+
+func parse(text string) (*condition, error) {
+	parts := conditionPattern.FindStringSubmatch(text)
+	if parts == nil {
+		return nil, fmt.Errorf("condition %q is not <attribute> <op> <value>", text)
+	}
+	if !pathPattern.MatchString(parts[1]) {
+		return nil, fmt.Errorf("condition %q must start with a subject, resource or env attribute", text)
+	}
+	if !operators[parts[2]] {
+		return nil, fmt.Errorf("condition %q has an unknown operator %s", text, parts[2])
+	}
+	cond := &condition{
+		text: text,
+		left: operand{path: strings.Split(parts[1], ".")},
+		op:   parts[2],
+	}
+	if pathPattern.MatchString(parts[3]) {
+		cond.right = operand{path: strings.Split(parts[3], ".")}
+	} else if err := yaml.Unmarshal([]byte(parts[3]), &cond.right.value); err != nil {
+		return nil, fmt.Errorf("condition %q has an invalid value: %w", text, err)
+	}
+	if cond.op == "in_cidr" || cond.op == "not_in_cidr" {
+		if cond.right.path != nil {
+			return nil, fmt.Errorf("condition %q needs a list of networks", text)
+		}
+		for _, value := range list(cond.right.value) {
+			_, network, err := net.ParseCIDR(fmt.Sprint(value))
+			if err != nil {
+				return nil, fmt.Errorf("condition %q: %w", text, err)
+			}
+			cond.nets = append(cond.nets, network)
+		}
+	}
+	return cond, nil
+}
+
+// undecided is the result when the condition can not be evaluated, a missing
+// attribute or values that do not compare
+func (c *condition) holds(input Input, undecided bool) bool {
+	left, ok := c.left.resolve(input)
+	if !ok {
+		return undecided
+	}
+	right, ok := c.right.resolve(input)
+	if !ok {
+		return undecided
+	}
+	switch c.op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	case "<", "<=", ">", ">=":
+		cmp, err := compare(left, right)
+		if err != nil {
+			return undecided
+		}
+		switch c.op {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		default:
+			return cmp >= 0
+		}
+	case "in":
+		return member(list(right), left)
+	case "not_in":
+		return !member(list(right), left)
+	case "contains":
+		return member(list(left), right)
+	case "in_cidr", "not_in_cidr":
+		ip := net.ParseIP(fmt.Sprint(left))
+		if ip == nil {
+			return undecided
+		}
+		inside := false
+		for _, network := range c.nets {
+			if network.Contains(ip) {
+				inside = true
+				break
+			}
+		}
+		return inside == (c.op == "in_cidr")
+	}
+	return false
+}
+
+func (o operand) resolve(input Input) (interface{}, bool) {
+	if o.path == nil {
+		return o.value, true
+	}
+	var current interface{}
+	switch o.path[0] {
+	case "subject":
+		current = input.Subject
+	case "resource":
+		current = input.Resource
+	case "env":
+		current = input.Env
+	}
+	for _, key := range o.path[1:] {
+		attributes, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = attributes[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, current != nil
+}
+
+// numbers of any type compare by value
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(a, b interface{}) (int, error) {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	x, okA := a.(string)
+	y, okB := b.(string)
+	if !okA || !okB {
+		return 0, errors.New("values can not be compared")
+	}
+	return strings.Compare(x, y), nil
+}
+
+func number(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// a slice of any element type, a single value is a list of one
+func list(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []interface{}{value}
+	}
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
+
+func member(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testRules = `
+rules:
+  - name: directory-profiles
+    effect: deny
+    permissions: ["user:update:own"]
+    when: ["subject.auth_source == 'ldap'"]
+  - name: office-network
+    effect: deny
+    permissions: ["user:delete"]
+    when: ["env.ip not_in_cidr ['10.0.0.0/8']"]
+  - name: locked-users
+    effect: deny
+    permissions: ["user:*"]
+    when: ["resource.status == 2"]
+  - name: verified-editors
+    effect: allow
+    permissions: ["user:read"]
+    when: ["subject.roles contains 'editor'", "subject.email_verified == true"]
+  - name: senior-staff
+    effect: allow
+    permissions: ["report:read"]
+    when: ["subject.level >= 3"]
+`
+
+func loadRules(t *testing.T, content string) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Load("") })
+	return Load(path)
+}
+
+func TestEvaluate(t *testing.T) {
+	if err := loadRules(t, testRules); err != nil {
+		t.Fatal(err)
+	}
+	editor := map[string]interface{}{"id": 1, "roles": []string{"editor"}, "email_verified": true}
+	active := map[string]interface{}{"status": 1}
+	tests := []struct {
+		name       string
+		permission string
+		input      Input
+		want       Decision
+		rule       string
+	}{
+		{"allow when all conditions hold", "user:read",
+			Input{Subject: editor, Resource: active}, Allowed, "verified-editors"},
+		{"allow needs every condition", "user:read",
+			Input{Subject: map[string]interface{}{"roles": []string{"editor"}, "email_verified": false}, Resource: active}, NotApplicable, ""},
+		{"allow on a missing attribute does not match", "report:read",
+			Input{Subject: editor}, NotApplicable, ""},
+		{"allow compares numbers of any type", "report:read",
+			Input{Subject: map[string]interface{}{"level": uint8(3)}}, Allowed, "senior-staff"},
+		{"other permission", "role:read",
+			Input{Subject: editor}, NotApplicable, ""},
+		{"deny matches", "user:update:own",
+			Input{Subject: map[string]interface{}{"auth_source": "ldap"}}, Denied, "directory-profiles"},
+		{"deny does not match", "user:update:own",
+			Input{Subject: map[string]interface{}{"auth_source": "local"}, Resource: active}, NotApplicable, ""},
+		{"deny wins over allow", "user:read",
+			Input{Subject: editor, Resource: map[string]interface{}{"status": 2}}, Denied, "locked-users"},
+		{"deny fails closed on a missing subject attribute", "user:update:own",
+			Input{Subject: map[string]interface{}{}, Resource: active}, Denied, "directory-profiles"},
+		{"deny fails closed without a resource", "user:update",
+			Input{Subject: editor}, Denied, "locked-users"},
+		{"deny fails closed on an invalid ip", "user:delete",
+			Input{Resource: active, Env: map[string]interface{}{"ip": "unknown"}}, Denied, "office-network"},
+		{"cidr inside", "user:delete",
+			Input{Resource: active, Env: map[string]interface{}{"ip": "10.1.2.3"}}, NotApplicable, ""},
+		{"cidr outside", "user:delete",
+			Input{Resource: active, Env: map[string]interface{}{"ip": "192.168.1.1"}}, Denied, "office-network"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rule := Evaluate(tt.permission, tt.input)
+			if got != tt.want || rule != tt.rule {
+				t.Errorf("Evaluate(%q) = %v %q, want %v %q", tt.permission, got, rule, tt.want, tt.rule)
+			}
+		})
+	}
+}
+
+func TestIsOwner(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Input
+		want  bool
+	}{
+		{"owner", Input{Subject: map[string]interface{}{"id": uint64(7)}, Resource: map[string]interface{}{"owner_id": 7}}, true},
+		{"other user", Input{Subject: map[string]interface{}{"id": uint64(7)}, Resource: map[string]interface{}{"owner_id": 8}}, false},
+		{"no resource", Input{Subject: map[string]interface{}{"id": uint64(7)}}, false},
+		{"no owner", Input{Subject: map[string]interface{}{"id": uint64(7)}, Resource: map[string]interface{}{}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsOwner(tt.input); got != tt.want {
+				t.Errorf("IsOwner() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{"unknown effect", "rules:\n  - effect: maybe\n    permissions: [\"user:read\"]\n"},
+		{"no permissions", "rules:\n  - effect: deny\n"},
+		{"unknown attribute root", "rules:\n  - effect: deny\n    permissions: [\"user:read\"]\n    when: [\"user.id == 1\"]\n"},
+		{"unknown operator", "rules:\n  - effect: deny\n    permissions: [\"user:read\"]\n    when: [\"subject.id ~= 1\"]\n"},
+		{"invalid network", "rules:\n  - effect: deny\n    permissions: [\"user:read\"]\n    when: [\"env.ip in_cidr ['10.0.0.0/33']\"]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := loadRules(t, tt.rules); err == nil {
+				t.Error("Load() accepted an invalid rule")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package pwned
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bpf.com/pkg/config"
+)
+
+// check a password against the offline pwned passwords list.
+// The list uses the k-anonymity range layout: one file per 5 character
+// sha1 prefix, named <PREFIX>.txt, holding SUFFIX:COUNT lines.
+// An empty password.breachedDir disables the check.
+func IsBreached(password string) (bool, error) {
+	dir := config.GetAppConfig().Password.BreachedDir
+	if dir == "" {
+		return false, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := openRange(dir, prefix)
+	if err != nil {
+		//a prefix without a file has no breached passwords
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, count, _ := strings.Cut(line, ":")
+		//padding entries of the range api have a zero count
+		if count == "0" {
+			continue
+		}
+		if strings.EqualFold(candidate, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// range file of a prefix, with or without the .txt extension
+func openRange(dir, prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Open(filepath.Join(dir, prefix))
+	}
+	return file, err
+}
@@ -0,0 +1,123 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// organization rows created before multi tenancy belong to
+const Default uint64 = 1
+
+// platform admins pick the tenant they act on with this header
+const Header = "X-Tenant-Id"
+
+// column of the models owned by a tenant
+const field = "TenantId"
+
+const filteredKey = "tenant:filtered"
+
+var ErrCrossTenant = errors.New("record belongs to another tenant")
+
+type ctxKey struct{}
+
+// scope the context to a tenant, queries run with it only see the rows of the tenant
+func WithTenant(ctx context.Context, tenantId uint64) context.Context {
+	return context.WithValue(ctx, ctxKey{}, tenantId)
+}
+
+// tenant of the context, false for unscoped contexts which see every tenant
+func FromContext(ctx context.Context) (uint64, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	tenantId, ok := ctx.Value(ctxKey{}).(uint64)
+	return tenantId, ok && tenantId != 0
+}
+
+// parse a tenant id as sent in the header
+func Parse(value string) (uint64, error) {
+	tenantId, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || tenantId == 0 {
+		return 0, errors.New("invalid tenant id")
+	}
+	return tenantId, nil
+}
+
+// register the callbacks filtering and stamping the tenant column of every model having one.
+// Statements run with a scoped context (db.WithContext) are restricted to its tenant
+func Register(db *gorm.DB) error {
+	callback := db.Callback()
+	if err := callback.Query().Before("gorm:query").Register("tenant:query", filter); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("tenant:update", filter); err != nil {
+		return err
+	}
+	if err := callback.Delete().Before("gorm:delete").Register("tenant:delete", filter); err != nil {
+		return err
+	}
+	return callback.Create().Before("gorm:create").Register("tenant:create", stamp)
+}
+
+// tenant column of the statement model and the tenant of its context
+func scoped(db *gorm.DB) (*schema.Field, uint64, bool) {
+	if db.Statement.Schema == nil {
+		return nil, 0, false
+	}
+	column := db.Statement.Schema.LookUpField(field)
+	if column == nil {
+		return nil, 0, false
+	}
+	tenantId, ok := FromContext(db.Statement.Context)
+	if !ok {
+		return nil, 0, false
+	}
+	return column, tenantId, true
+}
+
+// add the tenant condition once per statement, chained queries such as count then find share it
+func filter(db *gorm.DB) {
+	column, tenantId, ok := scoped(db)
+	if !ok {
+		return
+	}
+	if _, done := db.Statement.Settings.LoadOrStore(filteredKey, true); done {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: db.Statement.Table, Name: column.DBName}, Value: tenantId},
+	}})
+}
+
+// new rows get the tenant of the context, rows of another tenant are refused
+func stamp(db *gorm.DB) {
+	column, tenantId, ok := scoped(db)
+	if !ok {
+		return
+	}
+	set := func(value reflect.Value) {
+		current, zero := column.ValueOf(db.Statement.Context, value)
+		if zero {
+			db.AddError(column.Set(db.Statement.Context, value, tenantId))
+			return
+		}
+		if current != tenantId {
+			db.AddError(ErrCrossTenant)
+		}
+	}
+	value := db.Statement.ReflectValue
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			set(reflect.Indirect(value.Index(i)))
+		}
+	case reflect.Struct:
+		set(value)
+	}
+}
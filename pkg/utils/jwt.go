@@ -2,58 +2,143 @@ package utils
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"bpf.com/pkg/config"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// custom the jwt claim
+// custom the jwt claim, the jti is carried by RegisteredClaims.ID
 type JWTClaims struct {
-	UserId   uint64 `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserId    uint64   `json:"user_id"`
+	Username  string   `json:"username"`
+	TenantId  uint64   `json:"tid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	SessionId string   `json:"sid,omitempty"`
+	//tokens of an oauth client carry the client and the granted scopes
+	ClientId string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	//impersonation tokens name the admin acting as the user
+	Actor *ActorClaims `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// generator access token
-func GenerateAccessToken(userId uint64) (string, error) {
+// the real identity behind an impersonation token, as the RFC 8693 act claim
+type ActorClaims struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username,omitempty"`
+}
+
+// user id of the acting admin, 0 when the token is not impersonating
+func (c *JWTClaims) ActorId() uint64 {
+	if c.Actor == nil {
+		return 0
+	}
+	actorId, _ := strconv.ParseUint(c.Actor.Subject, 10, 64)
+	return actorId
+}
+
+// generator access token of a login session, roles are the codes assigned to the user
+// within the organization tenantId
+func GenerateAccessToken(userId, tenantId uint64, sessionId string, roles []string) (string, error) {
 	cfg := config.GetAppConfig().JWT
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
 	claims := JWTClaims{
-		UserId: userId,
+		UserId:    userId,
+		TenantId:  tenantId,
+		Roles:     roles,
+		SessionId: sessionId,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(cfg.AccessTokenExp) * time.Minute)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    cfg.TokenIssuer,
 		},
 	}
-	//create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	//sign token
-	tokenString, err := token.SignedString([]byte(cfg.Secret))
+	return SignClaims(claims)
+}
+
+// generator access token for an admin acting as a user, it has no session
+// and no refresh token so it ends at expiresAt
+func GenerateImpersonationToken(userId, tenantId uint64, roles []string, actorId uint64, actorUsername string, expiresAt time.Time) (string, *JWTClaims, error) {
+	cfg := config.GetAppConfig().JWT
+	jti, err := GenerateRandomToken(16)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return tokenString, nil
+	claims := &JWTClaims{
+		UserId:   userId,
+		TenantId: tenantId,
+		Roles:    roles,
+		Actor: &ActorClaims{
+			Subject:  strconv.FormatUint(actorId, 10),
+			Username: actorUsername,
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.FormatUint(userId, 10),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    cfg.TokenIssuer,
+		},
+	}
+	token, err := SignClaims(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
 }
 
-// generate the refreshtoken
-func GenerateRefreshToken(userId uint64) (string, error) {
+// generator access token of an oauth client, userId is 0 for the client's own token,
+// grantId is the refresh token family so revoking the grant revokes its access tokens
+func GenerateOAuthAccessToken(userId uint64, clientId, grantId string, scopes []string) (string, error) {
 	cfg := config.GetAppConfig().JWT
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	subject := clientId
+	if userId != 0 {
+		subject = strconv.FormatUint(userId, 10)
+	}
 	claims := JWTClaims{
-		UserId: userId,
+		UserId:    userId,
+		SessionId: grantId,
+		ClientId:  clientId,
+		Scope:     strings.Join(scopes, " "),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(cfg.RefreshTokenExp) * time.Minute)),
+			ID:        jti,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{clientId},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(cfg.AccessTokenExp) * time.Minute)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    cfg.TokenIssuer,
 		},
 	}
+	return SignClaims(claims)
+}
+
+// sign claims with the current key of the key ring
+func SignClaims(claims jwt.Claims) (string, error) {
+	key, err := GetKeyRing().SigningKey()
+	if err != nil {
+		return "", err
+	}
 	//create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	//sign the token
-	tokenString, err := token.SignedString([]byte(cfg.Secret))
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.Kid != "" {
+		token.Header["kid"] = key.Kid
+	}
+	//sign token
+	tokenString, err := token.SignedString(key.SignKey)
 	if err != nil {
 		return "", err
 	}
@@ -65,22 +150,9 @@ func ParseAccessToken(tokenString string) (*JWTClaims, error) {
 	return parseToken(tokenString)
 }
 
-// parse refreshtoken
-func ParseRefreshToken(refreshTokenString string) (*JWTClaims, error) {
-	return parseToken(refreshTokenString)
-}
-
 // parse token
 func parseToken(tokenString string) (*JWTClaims, error) {
-	cfg := config.GetAppConfig().JWT
-
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// check sign
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signature")
-		}
-		return []byte(cfg.Secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, verifyKeyFunc)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +163,20 @@ func parseToken(tokenString string) (*JWTClaims, error) {
 	return nil, errors.New("invalid token")
 }
 
+// select the verify key by kid and check the token uses the key's algorithm
+func verifyKeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := GetKeyRing().VerifyKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	// check sign
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("invalid signature")
+	}
+	return key.VerifyKey, nil
+}
+
 // validate token
 func ValidateToken(tokenString string) bool {
 	_, err := ParseAccessToken(tokenString)
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"bpf.com/pkg/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// one key of the key ring
+type SigningKey struct {
+	Kid        string
+	Method     jwt.SigningMethod
+	SignKey    interface{}
+	VerifyKey  interface{}
+	ActiveFrom time.Time
+	RetireAt   time.Time
+}
+
+// asymmetric keys are published in the jwks, hmac secrets never are
+func (k *SigningKey) IsPublic() bool {
+	return k.Method.Alg() != AlgHS256
+}
+
+// key is used for signing once active and until retired
+func (k *SigningKey) isActive(now time.Time) bool {
+	return !now.Before(k.ActiveFrom) && !k.isRetired(now)
+}
+
+func (k *SigningKey) isRetired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// KeyRing holds every configured key, selected by kid
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys []*SigningKey
+}
+
+var globalKeyRing = &KeyRing{}
+
+// Init key ring from JWTConfig.Keys, falls back to the HS256 secret
+func InitKeyRing() error {
+	cfg := config.GetAppConfig().JWT
+	var keys []*SigningKey
+	if len(cfg.Keys) == 0 {
+		if cfg.Secret == "" {
+			return errors.New("jwt secret or keys must be configured")
+		}
+		keys = append(keys, &SigningKey{
+			Method:    jwt.SigningMethodHS256,
+			SignKey:   []byte(cfg.Secret),
+			VerifyKey: []byte(cfg.Secret),
+		})
+	}
+	for _, keyCfg := range cfg.Keys {
+		key, err := loadSigningKey(keyCfg)
+		if err != nil {
+			return fmt.Errorf("load jwt key %s fail: %w", keyCfg.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+	//newest activation first so the signing key is the first active one
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].ActiveFrom.After(keys[j].ActiveFrom)
+	})
+	globalKeyRing.mu.Lock()
+	globalKeyRing.keys = keys
+	globalKeyRing.mu.Unlock()
+	return nil
+}
+
+// get key ring
+func GetKeyRing() *KeyRing {
+	return globalKeyRing
+}
+
+// current signing key, the newest key whose activation time has passed
+func (k *KeyRing) SigningKey() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := time.Now()
+	for _, key := range k.keys {
+		if key.isActive(now) {
+			return key, nil
+		}
+	}
+	return nil, errors.New("no active signing key")
+}
+
+// key used to verify a token signed with kid
+func (k *KeyRing) VerifyKey(kid string) (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := time.Now()
+	for _, key := range k.keys {
+		if key.Kid == kid && !key.isRetired(now) {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key: %s", kid)
+}
+
+// public keys that are not retired, including keys scheduled for later
+// activation so verifiers can cache them before rotation happens
+func (k *KeyRing) PublicKeys() []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := time.Now()
+	var keys []*SigningKey
+	for _, key := range k.keys {
+		if key.IsPublic() && !key.isRetired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// build a key from its config
+func loadSigningKey(keyCfg config.JWTKeyConfig) (*SigningKey, error) {
+	if keyCfg.Kid == "" {
+		return nil, errors.New("kid is required")
+	}
+	key := &SigningKey{Kid: keyCfg.Kid}
+	var err error
+	if keyCfg.ActiveFrom != "" {
+		if key.ActiveFrom, err = time.Parse(time.RFC3339, keyCfg.ActiveFrom); err != nil {
+			return nil, fmt.Errorf("invalid activeFrom: %w", err)
+		}
+	}
+	if keyCfg.RetireAt != "" {
+		if key.RetireAt, err = time.Parse(time.RFC3339, keyCfg.RetireAt); err != nil {
+			return nil, fmt.Errorf("invalid retireAt: %w", err)
+		}
+	}
+
+	if keyCfg.Algorithm == AlgHS256 {
+		if keyCfg.Secret == "" {
+			return nil, errors.New("secret is required for HS256")
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.SignKey = []byte(keyCfg.Secret)
+		key.VerifyKey = []byte(keyCfg.Secret)
+		return key, nil
+	}
+
+	privateKey, err := readPrivateKey(keyCfg.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	switch keyCfg.Algorithm {
+	case AlgRS256:
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("RS256 requires an RSA private key")
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.SignKey = rsaKey
+		key.VerifyKey = &rsaKey.PublicKey
+	case AlgES256:
+		ecKey, ok := privateKey.(*ecdsa.PrivateKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 requires a P-256 EC private key")
+		}
+		key.Method = jwt.SigningMethodES256
+		key.SignKey = ecKey
+		key.VerifyKey = &ecKey.PublicKey
+	case AlgEdDSA:
+		edKey, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("EdDSA requires an Ed25519 private key")
+		}
+		key.Method = jwt.SigningMethodEdDSA
+		key.SignKey = edKey
+		key.VerifyKey = edKey.Public()
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", keyCfg.Algorithm)
+	}
+	return key, nil
+}
+
+// read a PEM encoded PKCS#8, PKCS#1 or SEC1 private key
+func readPrivateKey(filename string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
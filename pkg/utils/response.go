@@ -10,22 +10,24 @@ import (
 * Http request response common util
  */
 const (
-	SUCCESS        int = 200
-	ERROR          int = 500
-	INVALID_PARAMS int = 400
-	UNAUTHORIZED   int = 401
-	FORBIDDEN      int = 403
-	NOT_FOUND      int = 404
+	SUCCESS           int = 200
+	ERROR             int = 500
+	INVALID_PARAMS    int = 400
+	UNAUTHORIZED      int = 401
+	FORBIDDEN         int = 403
+	NOT_FOUND         int = 404
+	TOO_MANY_REQUESTS int = 429
 )
 
 // response message
 var ResMsg = map[int]string{
-	SUCCESS:        "成功",
-	ERROR:          "服务器内部错误",
-	INVALID_PARAMS: "请求参数错误",
-	UNAUTHORIZED:   "未授权访问",
-	FORBIDDEN:      "禁止访问",
-	NOT_FOUND:      "资源不存在",
+	SUCCESS:           "成功",
+	ERROR:             "服务器内部错误",
+	INVALID_PARAMS:    "请求参数错误",
+	UNAUTHORIZED:      "未授权访问",
+	FORBIDDEN:         "禁止访问",
+	NOT_FOUND:         "资源不存在",
+	TOO_MANY_REQUESTS: "请求过于频繁",
 }
 
 // Response struct
@@ -96,6 +98,8 @@ func getHttpStatusByCode(code int) int {
 		return http.StatusForbidden
 	case NOT_FOUND:
 		return http.StatusNotFound
+	case TOO_MANY_REQUESTS:
+		return http.StatusTooManyRequests
 	case ERROR:
 		return http.StatusInternalServerError
 	default:
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// payload envelope of a signed value
+type signedEnvelope struct {
+	Data      json.RawMessage `json:"d"`
+	ExpiresAt int64           `json:"e"`
+}
+
+// sign a value into an url-safe "payload.signature" string valid until exp
+func SignValue(value interface{}, secret string, exp time.Duration) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	envelope, err := json.Marshal(signedEnvelope{
+		Data:      data,
+		ExpiresAt: time.Now().Add(exp).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(envelope)
+	return payload + "." + signPayload(payload, secret), nil
+}
+
+// verify a signed string and decode its value into dest
+func VerifySignedValue(token, secret string, dest interface{}) error {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signPayload(payload, secret))) {
+		return errors.New("invalid signature")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return errors.New("invalid payload")
+	}
+	var envelope signedEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return errors.New("invalid payload")
+	}
+	if time.Now().Unix() > envelope.ExpiresAt {
+		return errors.New("link expired")
+	}
+	return json.Unmarshal(envelope.Data, dest)
+}
+
+func signPayload(payload, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"bpf.com/pkg/config"
+)
+
+// default opaque refresh token size (bytes)
+const defaultRefreshTokenSize = 32
+
+// generate a random url-safe token of size bytes
+func GenerateRandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// generate an opaque refresh token sized by JWTConfig.RefreshTokenSize
+func GenerateRefreshToken() (string, error) {
+	size := config.GetAppConfig().JWT.RefreshTokenSize
+	if size <= 0 {
+		size = defaultRefreshTokenSize
+	}
+	return GenerateRandomToken(size)
+}
+
+// hash a token before it is stored server side
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}